@@ -12,10 +12,13 @@ import (
 	"time"
 
 	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
 	"github.com/anmaslov/calendar/internal/handler"
+	"github.com/anmaslov/calendar/internal/repository"
 	"github.com/anmaslov/calendar/internal/repository/postgres"
 	"github.com/anmaslov/calendar/internal/service"
 	"github.com/anmaslov/calendar/internal/sync"
+	"github.com/anmaslov/calendar/internal/webhook"
 	"go.uber.org/zap"
 )
 
@@ -60,12 +63,44 @@ func main() {
 	// Initialize repositories
 	eventRepo := postgres.NewEventRepository(db)
 	eventSyncRepo := postgres.NewEventSyncRepository(db)
+	calendarRepo := postgres.NewCalendarRepository(db)
+	syncRunRepo := postgres.NewSyncRunRepository(db)
+	changeRepo := postgres.NewChangeRepository(db)
+	webhookRepo := postgres.NewWebhookRepository(db)
+
+	// Initialize calendar sources
+	sources := sync.NewSourceFactory(cfg.Exchange, cfg.ICal, logger)
+	probes.SetExchangeCircuit(sources.ExchangeCircuit)
+
+	// Initialize sync worker if enabled
+	var (
+		syncWorker *sync.Worker
+		wakeSync   func()
+	)
+	if cfg.Sync.Enabled {
+		var lock repository.LeaderLock
+		if cfg.Sync.LeaderElection {
+			lock = postgres.NewSyncLock(db)
+		}
+		syncWorker = sync.NewWorker(eventSyncRepo, calendarRepo, syncRunRepo, changeRepo, sources, lock, cfg.Sync, logger)
+		wakeSync = syncWorker.Wake
+	}
 
 	// Initialize services
-	eventService := service.NewEventService(eventRepo, logger)
+	eventService := service.NewEventService(eventRepo, eventSyncRepo, calendarRepo, sources, logger)
+	calendarService := service.NewCalendarService(calendarRepo, logger)
+	syncService := service.NewSyncService(syncRunRepo, calendarRepo, sources, cfg.Sync, wakeSync, logger)
+	changeBroker := service.NewChangeBroker(changeRepo, postgres.NewChangeListener(cfg.Database, logger), logger)
+	changeService := service.NewChangeService(changeRepo, changeBroker, logger)
+	webhookService := service.NewWebhookService(webhookRepo, calendarRepo, webhook.NewTargetPolicy(cfg.Webhooks.AllowedHosts), logger)
+
+	// Register configured calendars
+	if err := calendarService.EnsureCalendars(context.Background(), calendarsFromConfig(cfg)); err != nil {
+		logger.Fatal("failed to register calendars", zap.Error(err))
+	}
 
 	// Initialize HTTP handler
-	h := handler.New(eventService, logger, probes)
+	h := handler.New(eventService, calendarService, syncService, changeService, webhookService, logger, probes)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -79,11 +114,22 @@ func main() {
 	// Create context for background workers
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Start delivering event changes to stream subscribers; streams end when
+	// ctx is cancelled, so that they do not hold up the server shutdown
+	changeBroker.Start(ctx)
+
+	// Start webhook dispatcher if enabled
+	var dispatcher *webhook.Dispatcher
+	if cfg.Webhooks.Enabled {
+		dispatcher = webhook.NewDispatcher(webhookRepo, cfg.Webhooks, logger)
+		dispatcher.Start(ctx)
+	} else {
+		logger.Info("webhook dispatcher is disabled")
+	}
+
 	// Start sync worker if enabled
-	var syncWorker *sync.Worker
-	if cfg.Sync.Enabled {
-		exchangeClient := sync.NewExchangeClient(cfg.Exchange, logger)
-		syncWorker = sync.NewWorker(eventSyncRepo, exchangeClient, cfg.Sync, logger)
+	if syncWorker != nil {
+		probes.SetSyncLeader(syncWorker.IsLeader)
 		syncWorker.Start(ctx)
 	} else {
 		logger.Info("sync worker is disabled")
@@ -117,6 +163,11 @@ func main() {
 		syncWorker.Stop()
 	}
 
+	// Stop webhook dispatcher after the last sync cycle was committed
+	if dispatcher != nil {
+		dispatcher.Stop()
+	}
+
 	// Cancel context for all background workers
 	cancel()
 
@@ -141,3 +192,21 @@ func main() {
 
 	logger.Info("graceful shutdown completed")
 }
+
+// calendarsFromConfig converts the configured calendars to domain calendars.
+func calendarsFromConfig(cfg *config.Config) []*domain.Calendar {
+	configured := cfg.Calendars()
+	calendars := make([]*domain.Calendar, len(configured))
+	for i, c := range configured {
+		calendars[i] = &domain.Calendar{
+			Name:        c.Name,
+			SourceType:  c.Source,
+			Mailbox:     c.Mailbox,
+			URL:         c.URL,
+			DisplayName: c.DisplayName,
+			Enabled:     c.IsEnabled(),
+			SyncDays:    c.SyncDays,
+		}
+	}
+	return calendars
+}
@@ -3,12 +3,14 @@ module github.com/anmaslov/calendar
 go 1.24.0
 
 require (
+	github.com/Azure/go-ntlmssp v0.1.1
 	github.com/Masterminds/squirrel v1.5.4
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/golang-migrate/migrate/v4 v4.19.1
 	github.com/google/uuid v1.6.0
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/lib/pq v1.10.9
+	github.com/teambition/rrule-go v1.8.2
 	go.uber.org/zap v1.27.0
 	gopkg.in/yaml.v3 v3.0.1
 )
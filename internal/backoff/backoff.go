@@ -0,0 +1,29 @@
+// Package backoff computes delays between retries of failed calls.
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+)
+
+// Delay returns the delay before the retry following the given attempt,
+// counted from 1: the initial backoff doubled for every attempt, capped at
+// the maximum backoff and jittered by up to a half so that replicas and
+// calendars do not retry in lockstep.
+func Delay(cfg config.RetryConfig, attempt int) time.Duration {
+	d := min(cfg.InitialBackoff, cfg.MaxBackoff)
+	for i := 1; i < attempt && d < cfg.MaxBackoff; i++ {
+		// Doubling past the cap could overflow
+		if d > cfg.MaxBackoff/2 {
+			d = cfg.MaxBackoff
+			break
+		}
+		d *= 2
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
@@ -0,0 +1,32 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+)
+
+func TestDelay(t *testing.T) {
+	cfg := config.RetryConfig{InitialBackoff: 30 * time.Second, MaxBackoff: time.Hour}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{8, time.Hour},
+		// 30s<<40 overflows time.Duration
+		{41, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			if d := Delay(cfg, tt.attempt); d < tt.want/2 || d >= tt.want {
+				t.Fatalf("Delay(%d) = %s, want within [%s, %s)", tt.attempt, d, tt.want/2, tt.want)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -13,7 +14,9 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Database DatabaseConfig `yaml:"database"`
 	Exchange ExchangeConfig `yaml:"exchange"`
+	ICal     ICalConfig     `yaml:"ical"`
 	Sync     SyncConfig     `yaml:"sync"`
+	Webhooks WebhookConfig  `yaml:"webhooks"`
 	Logging  LoggingConfig  `yaml:"logging"`
 }
 
@@ -44,14 +47,120 @@ type ExchangeConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	Domain   string `yaml:"domain"`
+	// AuthType selects the authentication scheme: "ntlm" or "basic"
+	AuthType string `yaml:"auth_type"`
+	// BasicFallback allows Basic auth when the server does not offer NTLM
+	BasicFallback bool `yaml:"basic_fallback"`
+	// Retry controls retries of transient Exchange failures
+	Retry RetryConfig `yaml:"retry"`
+	// CircuitBreaker stops calls to Exchange while it keeps failing
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
 }
 
+// RetryConfig holds retry configuration for transient failures.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts including the first one, 1 disables retries
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff is the delay before the first retry, doubled for every next one
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// CircuitBreakerConfig holds circuit breaker configuration.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed calls that opens the circuit, 0 disables it
+	FailureThreshold int `yaml:"failure_threshold"`
+	// OpenTimeout defines how long the circuit stays open before a trial call
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+}
+
+// ICalConfig holds iCalendar feed configuration.
+type ICalConfig struct {
+	// URL is an http(s) or webcal URL or a local file path of the feed
+	URL string `yaml:"url"`
+	// MaxSize is the largest feed in bytes that is parsed
+	MaxSize int64 `yaml:"max_size"`
+}
+
+// Sync sources.
+const (
+	SyncSourceExchange = "exchange"
+	SyncSourceICal     = "ical"
+)
+
+// CalendarConfig describes a calendar to synchronize.
+type CalendarConfig struct {
+	// Name identifies the calendar; it must be unique and should not change
+	Name string `yaml:"name"`
+	// Source is either "exchange" or "ical"
+	Source string `yaml:"source"`
+	// Mailbox is the SMTP address of a shared or delegated Exchange mailbox,
+	// empty for the calendar of the configured account
+	Mailbox string `yaml:"mailbox"`
+	// URL is the iCalendar feed URL or file path
+	URL         string `yaml:"url"`
+	DisplayName string `yaml:"display_name"`
+	// Enabled defaults to true
+	Enabled *bool `yaml:"enabled"`
+	// SyncDays overrides sync.sync_days when positive
+	SyncDays int `yaml:"sync_days"`
+}
+
+// IsEnabled returns true unless the calendar is explicitly disabled.
+func (c CalendarConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Sync modes.
+const (
+	SyncModeFull        = "full"
+	SyncModeIncremental = "incremental"
+)
+
 // SyncConfig holds synchronization configuration.
 type SyncConfig struct {
 	Enabled  bool          `yaml:"enabled"`
 	Interval time.Duration `yaml:"interval"`
 	// SyncDays defines how many days ahead to sync events
 	SyncDays int `yaml:"sync_days"`
+	// Mode is either "full" (refetch the whole window) or "incremental" (SyncFolderItems)
+	Mode string `yaml:"mode"`
+	// Source is either "exchange" or "ical" (iCalendar feed); used when no calendars are listed
+	Source string `yaml:"source"`
+	// Calendars lists the calendars to synchronize
+	Calendars []CalendarConfig `yaml:"calendars"`
+	// Concurrency limits how many calendars are synchronized at the same time
+	Concurrency int `yaml:"concurrency"`
+	// LeaderElection lets only the replica holding a database lock synchronize
+	LeaderElection bool `yaml:"leader_election"`
+	// LeaderRetryInterval defines how often a standby replica tries to take over
+	LeaderRetryInterval time.Duration `yaml:"leader_retry_interval"`
+	// RunRetention defines how long sync run history is kept, 0 keeps it forever
+	RunRetention time.Duration `yaml:"run_retention"`
+	// ChangeRetention defines how long the event change log is kept, 0 keeps it forever
+	ChangeRetention time.Duration `yaml:"change_retention"`
+	// TriggerPollInterval defines how often the leader checks for runs requested through the API
+	TriggerPollInterval time.Duration `yaml:"trigger_poll_interval"`
+	// RunTimeout defines after how long a run still marked running, e.g. by a
+	// crashed leader, is marked failed
+	RunTimeout time.Duration `yaml:"run_timeout"`
+}
+
+// WebhookConfig holds webhook delivery configuration.
+type WebhookConfig struct {
+	// Enabled turns on delivery; webhooks can be managed through the API regardless
+	Enabled bool `yaml:"enabled"`
+	// PollInterval defines how often new changes and due deliveries are checked
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// Timeout limits a single delivery attempt
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry defines the attempts of a delivery before it is dead-lettered and the backoff between them
+	Retry RetryConfig `yaml:"retry"`
+	// DeliveryRetention defines how long delivered and dead deliveries are kept, 0 keeps them forever
+	DeliveryRetention time.Duration `yaml:"delivery_retention"`
+	// AllowedHosts may be webhook targets although they are or resolve to loopback, link-local or private addresses
+	AllowedHosts []string `yaml:"allowed_hosts"`
 }
 
 // LoggingConfig holds logging configuration.
@@ -89,6 +198,8 @@ func Load(configPath string) (*Config, error) {
 	// Override with environment variables for sensitive data
 	cfg.overrideFromEnv()
 
+	cfg.normalize()
+
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
@@ -111,12 +222,53 @@ func (c *Config) setDefaults() {
 	c.Database.MaxOpenConns = 25
 	c.Database.MaxIdleConns = 5
 
+	c.Exchange.AuthType = "ntlm"
+	c.Exchange.Retry.MaxAttempts = 4
+	c.Exchange.Retry.InitialBackoff = time.Second
+	c.Exchange.Retry.MaxBackoff = 30 * time.Second
+	c.Exchange.CircuitBreaker.FailureThreshold = 5
+	c.Exchange.CircuitBreaker.OpenTimeout = 5 * time.Minute
+
+	c.ICal.MaxSize = 10 << 20
+
 	c.Logging.Level = "info"
 	c.Logging.Format = "json"
 
 	c.Sync.Enabled = false
 	c.Sync.Interval = 5 * time.Minute
 	c.Sync.SyncDays = 30
+	c.Sync.Mode = SyncModeFull
+	c.Sync.Source = SyncSourceExchange
+	c.Sync.Concurrency = 4
+	c.Sync.LeaderElection = true
+	c.Sync.LeaderRetryInterval = 30 * time.Second
+	c.Sync.RunRetention = 30 * 24 * time.Hour
+	c.Sync.ChangeRetention = 30 * 24 * time.Hour
+	c.Sync.TriggerPollInterval = 5 * time.Second
+	c.Sync.RunTimeout = time.Hour
+
+	c.Webhooks.Enabled = false
+	c.Webhooks.PollInterval = 5 * time.Second
+	c.Webhooks.Timeout = 10 * time.Second
+	c.Webhooks.Retry.MaxAttempts = 8
+	c.Webhooks.Retry.InitialBackoff = 30 * time.Second
+	c.Webhooks.Retry.MaxBackoff = time.Hour
+	c.Webhooks.DeliveryRetention = 30 * 24 * time.Hour
+}
+
+// Calendars returns the configured calendars. Without a calendars list a
+// single calendar named after sync.source is derived from the exchange or
+// ical section.
+func (c *Config) Calendars() []CalendarConfig {
+	if len(c.Sync.Calendars) > 0 {
+		return c.Sync.Calendars
+	}
+
+	calendar := CalendarConfig{Name: c.Sync.Source, Source: c.Sync.Source}
+	if c.Sync.Source == SyncSourceICal {
+		calendar.URL = c.ICal.URL
+	}
+	return []CalendarConfig{calendar}
 }
 
 // overrideFromEnv allows overriding sensitive values from environment variables.
@@ -129,6 +281,11 @@ func (c *Config) overrideFromEnv() {
 	}
 }
 
+// normalize brings case-insensitive values to their canonical form.
+func (c *Config) normalize() {
+	c.Exchange.AuthType = strings.ToLower(strings.TrimSpace(c.Exchange.AuthType))
+}
+
 func (c *Config) validate() error {
 	if c.Database.Password == "" {
 		return fmt.Errorf("database password is required (set in config or DB_PASSWORD env)")
@@ -136,5 +293,78 @@ func (c *Config) validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
+	if c.Sync.Source != SyncSourceExchange && c.Sync.Source != SyncSourceICal {
+		return fmt.Errorf("invalid sync source: %s", c.Sync.Source)
+	}
+	if c.ICal.MaxSize <= 0 {
+		return fmt.Errorf("invalid ical max size: %d", c.ICal.MaxSize)
+	}
+	if err := c.validateCalendars(); err != nil {
+		return err
+	}
+	if c.Sync.Concurrency <= 0 {
+		return fmt.Errorf("invalid sync concurrency: %d", c.Sync.Concurrency)
+	}
+	if c.Sync.LeaderElection && c.Sync.LeaderRetryInterval <= 0 {
+		return fmt.Errorf("invalid sync leader retry interval: %s", c.Sync.LeaderRetryInterval)
+	}
+	if c.Sync.TriggerPollInterval <= 0 {
+		return fmt.Errorf("invalid sync trigger poll interval: %s", c.Sync.TriggerPollInterval)
+	}
+	if c.Sync.RunTimeout <= 0 {
+		return fmt.Errorf("invalid sync run timeout: %s", c.Sync.RunTimeout)
+	}
+	if c.Exchange.AuthType != "ntlm" && c.Exchange.AuthType != "basic" {
+		return fmt.Errorf("invalid exchange auth type: %s", c.Exchange.AuthType)
+	}
+	if r := c.Exchange.Retry; r.MaxAttempts <= 0 || r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("invalid exchange retry: max_attempts %d, initial_backoff %s, max_backoff %s", r.MaxAttempts, r.InitialBackoff, r.MaxBackoff)
+	}
+	if cb := c.Exchange.CircuitBreaker; cb.FailureThreshold < 0 || (cb.FailureThreshold > 0 && cb.OpenTimeout <= 0) {
+		return fmt.Errorf("invalid exchange circuit breaker: failure_threshold %d, open_timeout %s", cb.FailureThreshold, cb.OpenTimeout)
+	}
+	if c.Sync.Mode != SyncModeFull && c.Sync.Mode != SyncModeIncremental {
+		return fmt.Errorf("invalid sync mode: %s", c.Sync.Mode)
+	}
+	if c.Webhooks.PollInterval <= 0 {
+		return fmt.Errorf("invalid webhooks poll interval: %s", c.Webhooks.PollInterval)
+	}
+	if c.Webhooks.Timeout <= 0 {
+		return fmt.Errorf("invalid webhooks timeout: %s", c.Webhooks.Timeout)
+	}
+	if r := c.Webhooks.Retry; r.MaxAttempts <= 0 || r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("invalid webhooks retry: max_attempts %d, initial_backoff %s, max_backoff %s", r.MaxAttempts, r.InitialBackoff, r.MaxBackoff)
+	}
+	return nil
+}
+
+func (c *Config) validateCalendars() error {
+	names := make(map[string]struct{})
+	for _, cal := range c.Calendars() {
+		if cal.Name == "" {
+			return fmt.Errorf("calendar name is required")
+		}
+		if _, ok := names[cal.Name]; ok {
+			return fmt.Errorf("duplicate calendar name: %s", cal.Name)
+		}
+		names[cal.Name] = struct{}{}
+
+		switch cal.Source {
+		case SyncSourceExchange:
+			if c.Sync.Enabled && cal.IsEnabled() && c.Exchange.URL == "" {
+				return fmt.Errorf("exchange url is required to sync calendar %s", cal.Name)
+			}
+		case SyncSourceICal:
+			if c.Sync.Enabled && cal.IsEnabled() && cal.URL == "" {
+				return fmt.Errorf("ical url is required to sync calendar %s", cal.Name)
+			}
+		default:
+			return fmt.Errorf("invalid source of calendar %s: %s", cal.Name, cal.Source)
+		}
+
+		if cal.SyncDays < 0 {
+			return fmt.Errorf("invalid sync days of calendar %s: %d", cal.Name, cal.SyncDays)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Calendar represents a synchronized calendar: the calendar folder of an
+// Exchange mailbox or an iCalendar feed. Name identifies the calendar in the
+// configuration. An empty Mailbox is the calendar of the Exchange account
+// itself. SyncDays overrides the global sync window when positive.
+type Calendar struct {
+	ID          uuid.UUID
+	Name        string
+	SourceType  string
+	Mailbox     string
+	URL         string
+	DisplayName string
+	Enabled     bool
+	SyncDays    int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Calendar source types.
+const (
+	CalendarSourceExchange = "exchange"
+	CalendarSourceICal     = "ical"
+)
+
+// IsWritable returns true if events of the calendar can be changed through Exchange.
+func (c *Calendar) IsWritable() bool {
+	return c.SourceType == CalendarSourceExchange
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// CircuitState describes the circuit breaker guarding calls to Exchange on
+// this replica. While the circuit is open calls fail without reaching
+// Exchange; after RetryAt a single trial call decides whether it closes.
+type CircuitState struct {
+	State               string
+	ConsecutiveFailures int
+	OpenedAt            *time.Time
+	RetryAt             *time.Time
+}
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
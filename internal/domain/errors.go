@@ -4,13 +4,17 @@ import "errors"
 
 // Domain errors.
 var (
-	ErrEventNotFound = errors.New("event not found")
-	ErrInvalidInput  = errors.New("invalid input")
-	ErrSyncFailed    = errors.New("sync failed")
-	ErrDatabaseError = errors.New("database error")
-	ErrExchangeError = errors.New("exchange server error")
-	ErrUnauthorized  = errors.New("unauthorized")
-	ErrForbidden     = errors.New("forbidden")
-	ErrConflict      = errors.New("conflict")
-	ErrInternalError = errors.New("internal error")
+	ErrEventNotFound    = errors.New("event not found")
+	ErrCalendarNotFound = errors.New("calendar not found")
+	ErrSyncRunNotFound  = errors.New("sync run not found")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrSyncFailed       = errors.New("sync failed")
+	ErrDatabaseError    = errors.New("database error")
+	ErrExchangeError    = errors.New("exchange server error")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrConflict         = errors.New("conflict")
+	ErrInternalError    = errors.New("internal error")
 )
@@ -1,30 +1,162 @@
 package domain
 
 import (
+	"bytes"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 // Event represents a calendar event.
+//
+// A recurring series is stored as a master carrying the Recurrence rule.
+// Occurrences and exceptions (occurrences modified on their own) reference the
+// master by SeriesMasterID and keep the start time the rule gave them in
+// OriginalStart. TimeZone is the IANA zone the event was scheduled in.
+// Exchange IDs are unique within the calendar identified by CalendarID.
 type Event struct {
-	ID          uuid.UUID
-	ExchangeID  string
-	Subject     string
-	Body        string
-	Location    string
-	StartTime   time.Time
-	EndTime     time.Time
-	IsAllDay    bool
-	Organizer   string
-	Attendees   []string
-	Categories  []string
-	Importance  string
-	Sensitivity string
-	Status      string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	SyncedAt    *time.Time
+	ID             uuid.UUID
+	ExchangeID     string
+	ChangeKey      string
+	CalendarID     uuid.UUID
+	Subject        string
+	Body           string
+	Location       string
+	StartTime      time.Time
+	EndTime        time.Time
+	IsAllDay       bool
+	Organizer      string
+	Attendees      []Attendee
+	Categories     []string
+	Importance     string
+	Sensitivity    string
+	Status         string
+	TimeZone       string
+	Recurrence     *Recurrence
+	SeriesMasterID string
+	OriginalStart  *time.Time
+	IsException    bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SyncedAt       *time.Time
+	// Match is set when the event was found by a full-text query.
+	Match *SearchMatch
+}
+
+// SearchMatch describes how an event matched a full-text query.
+type SearchMatch struct {
+	// Rank orders events by relevance, higher is better.
+	Rank float64
+	// Highlights maps the searchable fields that contain a match (subject,
+	// location, organizer, body) to fragments with the matched words marked.
+	Highlights map[string]string
+}
+
+// Attendee represents an event participant.
+type Attendee struct {
+	Email          string
+	Name           string
+	ResponseStatus string
+}
+
+// Attendee response statuses.
+const (
+	ResponseStatusUnknown   = "unknown"
+	ResponseStatusOrganizer = "organizer"
+	ResponseStatusAccepted  = "accepted"
+	ResponseStatusTentative = "tentative"
+	ResponseStatusDeclined  = "declined"
+	ResponseStatusNone      = "none"
+)
+
+// Recurrence describes the recurrence pattern of a series master.
+type Recurrence struct {
+	// Rule is an RFC 5545 RRULE value, e.g. "FREQ=WEEKLY;BYDAY=MO".
+	Rule string
+	// ExcludedDates are original start times of deleted occurrences.
+	ExcludedDates []time.Time
+}
+
+// IsSeriesMaster returns true if the event defines a recurring series.
+func (e *Event) IsSeriesMaster() bool {
+	return e.Recurrence != nil && e.Recurrence.Rule != ""
+}
+
+// EventInput holds client-supplied event fields for create and update
+// operations. On update nil fields are left unchanged.
+type EventInput struct {
+	Subject     *string
+	Body        *string
+	Location    *string
+	StartTime   *time.Time
+	EndTime     *time.Time
+	IsAllDay    *bool
+	TimeZone    *string
+	Attendees   *[]Attendee
+	Categories  *[]string
+	Importance  *string
+	Sensitivity *string
+}
+
+// Event statuses.
+const (
+	EventStatusConfirmed = "confirmed"
+	EventStatusTentative = "tentative"
+	EventStatusCancelled = "cancelled"
+)
+
+// Event importance levels.
+const (
+	ImportanceLow    = "low"
+	ImportanceNormal = "normal"
+	ImportanceHigh   = "high"
+)
+
+// Event sensitivity levels.
+const (
+	SensitivityNormal       = "normal"
+	SensitivityPersonal     = "personal"
+	SensitivityPrivate      = "private"
+	SensitivityConfidential = "confidential"
+)
+
+// Apply copies the set fields of the input to the event.
+func (in EventInput) Apply(e *Event) {
+	if in.Subject != nil {
+		e.Subject = *in.Subject
+	}
+	if in.Body != nil {
+		e.Body = *in.Body
+	}
+	if in.Location != nil {
+		e.Location = *in.Location
+	}
+	if in.StartTime != nil {
+		e.StartTime = in.StartTime.UTC()
+	}
+	if in.EndTime != nil {
+		e.EndTime = in.EndTime.UTC()
+	}
+	if in.IsAllDay != nil {
+		e.IsAllDay = *in.IsAllDay
+	}
+	if in.TimeZone != nil {
+		e.TimeZone = *in.TimeZone
+	}
+	if in.Attendees != nil {
+		e.Attendees = *in.Attendees
+	}
+	if in.Categories != nil {
+		e.Categories = *in.Categories
+	}
+	if in.Importance != nil {
+		e.Importance = *in.Importance
+	}
+	if in.Sensitivity != nil {
+		e.Sensitivity = *in.Sensitivity
+	}
 }
 
 // NewEvent creates a new event with generated UUID.
@@ -38,8 +170,166 @@ func NewEvent() *Event {
 type EventFilter struct {
 	StartDate *time.Time
 	EndDate   *time.Time
+	// RangeMode defines how events are matched against the date range,
+	// RangeOverlap if empty.
+	RangeMode string
 	Subject   string
-	Status    string
-	Limit     int
-	Offset    int
+	// Query is a full-text query over subject, location, organizer and body
+	// in web search syntax: words, "quoted phrases", or and -exclusions.
+	// Matching events are ordered by relevance.
+	Query string
+	// Location matches events whose location contains the string, ignoring case.
+	Location string
+	// Organizer matches events organized by the email address, ignoring case.
+	Organizer string
+	// Attendees matches events any of the email addresses is invited to,
+	// ignoring case.
+	Attendees []string
+	// Categories matches events having any of the categories, ignoring case.
+	Categories  []string
+	Status      ValueFilter
+	Importance  ValueFilter
+	Sensitivity ValueFilter
+	IsAllDay    *bool
+	// CalendarIDs restricts events to the given calendars, all if empty.
+	CalendarIDs []uuid.UUID
+	Limit       int
+	Offset      int
+	// Cursor returns events following the cursor instead of skipping Offset events.
+	Cursor *EventCursor
+	// SkipCount leaves the total number of matching events uncounted.
+	SkipCount bool
+	// ExpandRecurring returns occurrences of recurring series within the date
+	// range instead of series masters. Requires both StartDate and EndDate.
+	ExpandRecurring bool
+}
+
+// ValueFilter matches a field that is one of In, if given, and none of NotIn.
+type ValueFilter struct {
+	In    []string
+	NotIn []string
+}
+
+// Matches returns true if the value passes the filter.
+func (f ValueFilter) Matches(value string) bool {
+	if len(f.In) > 0 && !slices.Contains(f.In, value) {
+		return false
+	}
+	return !slices.Contains(f.NotIn, value)
+}
+
+// EventCursor is the position of an event in a listing ordered by search
+// rank (with a full-text query), start time and ID.
+type EventCursor struct {
+	Rank      float64
+	StartTime time.Time
+	ID        uuid.UUID
+}
+
+// NewEventCursor returns the cursor positioned at the event.
+func NewEventCursor(e *Event) *EventCursor {
+	c := &EventCursor{StartTime: e.StartTime, ID: e.ID}
+	if e.Match != nil {
+		c.Rank = e.Match.Rank
+	}
+	return c
+}
+
+// Before returns true if the event at c is listed before the event at other.
+func (c *EventCursor) Before(other *EventCursor) bool {
+	if c.Rank != other.Rank {
+		return c.Rank > other.Rank
+	}
+	if !c.StartTime.Equal(other.StartTime) {
+		return c.StartTime.Before(other.StartTime)
+	}
+	return bytes.Compare(c.ID[:], other.ID[:]) < 0
+}
+
+// EventPage is a page of listed events.
+type EventPage struct {
+	Events []*Event
+	// Total is the number of matching events, nil if they were not counted.
+	Total *int64
+	// Next is the cursor of the following page, nil on the last page.
+	Next *EventCursor
+}
+
+// Date range modes define how events are matched against the filter date range.
+const (
+	// RangeOverlap matches events taking place within [StartDate, EndDate):
+	// starting before its end and ending after its start. An event without
+	// duration matches when it happens within the range.
+	RangeOverlap = "overlap"
+	// RangeContained matches events lying entirely within [StartDate, EndDate].
+	RangeContained = "contained"
+	// RangeStartsWithin matches events starting within [StartDate, EndDate).
+	RangeStartsWithin = "starts_within"
+)
+
+// InRange returns true if an event with the given bounds matches the filter date range.
+func (f EventFilter) InRange(start, end time.Time) bool {
+	switch f.RangeMode {
+	case RangeContained:
+		if f.StartDate != nil && start.Before(*f.StartDate) {
+			return false
+		}
+		if f.EndDate != nil && end.After(*f.EndDate) {
+			return false
+		}
+	case RangeStartsWithin:
+		if f.StartDate != nil && start.Before(*f.StartDate) {
+			return false
+		}
+		if f.EndDate != nil && !start.Before(*f.EndDate) {
+			return false
+		}
+	default:
+		if f.EndDate != nil && !start.Before(*f.EndDate) {
+			return false
+		}
+		if f.StartDate != nil && !end.After(*f.StartDate) && !(start.Equal(end) && start.Equal(*f.StartDate)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the event matches the filter the way a listing
+// would return it. With ExpandRecurring a series master matches when the
+// series starts before the end of the date range, as its occurrences may
+// fall into the range.
+func (f EventFilter) Matches(e *Event) bool {
+	if len(f.CalendarIDs) > 0 && !slices.Contains(f.CalendarIDs, e.CalendarID) {
+		return false
+	}
+	if !f.Status.Matches(e.Status) || !f.Importance.Matches(e.Importance) || !f.Sensitivity.Matches(e.Sensitivity) {
+		return false
+	}
+	if f.IsAllDay != nil && e.IsAllDay != *f.IsAllDay {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(e.Subject), strings.ToLower(f.Subject)) {
+		return false
+	}
+	if f.Location != "" && !strings.Contains(strings.ToLower(e.Location), strings.ToLower(f.Location)) {
+		return false
+	}
+	if f.Organizer != "" && !strings.EqualFold(e.Organizer, f.Organizer) {
+		return false
+	}
+	if len(f.Attendees) > 0 && !slices.ContainsFunc(e.Attendees, func(a Attendee) bool {
+		return slices.ContainsFunc(f.Attendees, func(email string) bool { return strings.EqualFold(a.Email, email) })
+	}) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.ContainsFunc(e.Categories, func(c string) bool {
+		return slices.ContainsFunc(f.Categories, func(category string) bool { return strings.EqualFold(c, category) })
+	}) {
+		return false
+	}
+	if f.ExpandRecurring && e.IsSeriesMaster() {
+		return f.EndDate == nil || e.StartTime.Before(*f.EndDate)
+	}
+	return f.InRange(e.StartTime, e.EndTime)
 }
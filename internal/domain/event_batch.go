@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventBatch holds the changes of one sync cycle of a calendar, applied in a
+// single transaction.
+type EventBatch struct {
+	CalendarID uuid.UUID
+	// Events are created or updated by calendar and Exchange ID.
+	Events []*Event
+	// DeletedIDs are Exchange IDs of deleted events. Deleting a series master
+	// deletes its exceptions as well.
+	DeletedIDs []string
+	// WindowStart and WindowEnd bound a full sync when set: events of the
+	// calendar overlapping the window that are not among Events are deleted.
+	WindowStart *time.Time
+	WindowEnd   *time.Time
+	// SyncState is stored as the incremental sync state when not empty and
+	// all events were stored.
+	SyncState string
+}
+
+// EventBatchResult counts the changes applied by an event batch. Unchanged
+// events matched their stored content and were not written. Failed holds
+// events that could not be stored, by Exchange ID; they are skipped while
+// the rest of the batch is applied.
+type EventBatchResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Deleted   int
+	Failed    map[string]error
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventChange is an entry of the event change log. Entries are written in
+// the transaction that changes the event and are ordered by Seq, which only
+// grows in commit order, so a consumer can resume after the last Seq it saw.
+type EventChange struct {
+	Seq        int64
+	Operation  string
+	EventID    uuid.UUID
+	CalendarID uuid.UUID
+	ExchangeID string
+	ChangedAt  time.Time
+	// Event is the current state of the event; nil for deletions and for
+	// events deleted by a later change.
+	Event *Event
+}
+
+// Matches returns true if the change concerns an event matching the filter.
+// The content of deleted events is unknown, so deletions only need to match
+// the calendars of the filter.
+func (c *EventChange) Matches(f EventFilter) bool {
+	if c.Event == nil {
+		return len(f.CalendarIDs) == 0 || slices.Contains(f.CalendarIDs, c.CalendarID)
+	}
+	return f.Matches(c.Event)
+}
+
+// Event change operations.
+const (
+	ChangeOperationInsert = "insert"
+	ChangeOperationUpdate = "update"
+	ChangeOperationDelete = "delete"
+)
+
+// ChangeFilter represents filters for reading the change log: changes after
+// the Since sequence number, oldest first.
+type ChangeFilter struct {
+	Since int64
+	Limit int
+}
+
+// ChangePage is a page of the change log. NextSince is the sequence number
+// to request the following page with; HasMore reports whether more changes
+// are already available.
+type ChangePage struct {
+	Changes   []*EventChange
+	NextSince int64
+	HasMore   bool
+}
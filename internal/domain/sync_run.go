@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncRun records the synchronization of one calendar within a sync cycle.
+// Created, Updated and Deleted count local changes; Unchanged counts fetched
+// events that were already up to date and Failed those that could not be stored.
+//
+// Runs requested through the API are pending until the sync leader picks
+// them up; until then StartedAt is the time of the request. RangeStart and
+// RangeEnd replace the sync window when set.
+type SyncRun struct {
+	ID           uuid.UUID
+	CalendarID   uuid.UUID
+	CalendarName string
+	Trigger      string
+	Mode         string
+	Status       string
+	RangeStart   *time.Time
+	RangeEnd     *time.Time
+	StartedAt    time.Time
+	FinishedAt   *time.Time
+	Fetched      int
+	Created      int
+	Updated      int
+	Unchanged    int
+	Deleted      int
+	Failed       int
+	Error        string
+}
+
+// Sync run statuses.
+const (
+	SyncRunStatusPending   = "pending"
+	SyncRunStatusRunning   = "running"
+	SyncRunStatusSucceeded = "succeeded"
+	SyncRunStatusFailed    = "failed"
+)
+
+// Sync run triggers.
+const (
+	SyncTriggerSchedule = "schedule"
+	SyncTriggerManual   = "manual"
+)
+
+// SyncRequest requests an immediate sync of all enabled calendars or of
+// CalendarID only. StartDate and EndDate replace the sync window when set.
+type SyncRequest struct {
+	CalendarID *uuid.UUID
+	StartDate  *time.Time
+	EndDate    *time.Time
+}
+
+// SyncRunFilter represents filters for querying sync runs.
+type SyncRunFilter struct {
+	CalendarID *uuid.UUID
+	Status     string
+	Limit      int
+	Offset     int
+}
+
+// SyncStatus summarizes the state of synchronization.
+type SyncStatus struct {
+	Enabled     bool
+	Interval    time.Duration
+	LastSuccess *SyncRun
+	LastFailure *SyncRun
+	// NextRunAt is when the next cycle is expected, based on the latest run.
+	NextRunAt *time.Time
+	// Exchange is the state of the Exchange circuit breaker on this replica.
+	Exchange  CircuitState
+	Calendars []CalendarSyncStatus
+}
+
+// CalendarSyncStatus summarizes the state of synchronization of one calendar.
+type CalendarSyncStatus struct {
+	Calendar    *Calendar
+	LastSuccess *SyncRun
+	LastFailure *SyncRun
+}
@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a subscription of an external system to event changes. Changes
+// of events matching the filter are POSTed to URL as JSON signed with Secret.
+// Empty filter fields match all events.
+type Webhook struct {
+	ID      uuid.UUID
+	URL     string
+	Secret  string
+	Enabled bool
+	// CalendarID restricts the webhook to one calendar.
+	CalendarID *uuid.UUID
+	// Subject matches events whose subject contains it, case-insensitively.
+	Subject string
+	// Categories match events having at least one of them.
+	Categories []string
+	// StartSeq is the end of the change log when the webhook was created;
+	// only later changes are delivered to it.
+	StartSeq  int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Matches returns true if the change concerns an event matching the filter of
+// the webhook. The content of deleted events is unknown, so deletions only
+// need to match the calendar.
+func (w *Webhook) Matches(c *EventChange) bool {
+	if w.CalendarID != nil && *w.CalendarID != c.CalendarID {
+		return false
+	}
+	if c.Event == nil {
+		return true
+	}
+	if w.Subject != "" && !strings.Contains(strings.ToLower(c.Event.Subject), strings.ToLower(w.Subject)) {
+		return false
+	}
+	if len(w.Categories) > 0 && !slices.ContainsFunc(c.Event.Categories, func(category string) bool {
+		return slices.ContainsFunc(w.Categories, func(wanted string) bool {
+			return strings.EqualFold(category, wanted)
+		})
+	}) {
+		return false
+	}
+	return true
+}
+
+// WebhookInput holds client-supplied webhook fields for create and update
+// operations. On update nil fields are left unchanged; an empty CalendarID
+// pointer target (uuid.Nil) removes the calendar restriction.
+type WebhookInput struct {
+	URL        *string
+	Secret     *string
+	Enabled    *bool
+	CalendarID *uuid.UUID
+	Subject    *string
+	Categories *[]string
+}
+
+// Apply copies the set fields of the input to the webhook.
+func (in WebhookInput) Apply(w *Webhook) {
+	if in.URL != nil {
+		w.URL = *in.URL
+	}
+	if in.Secret != nil {
+		w.Secret = *in.Secret
+	}
+	if in.Enabled != nil {
+		w.Enabled = *in.Enabled
+	}
+	if in.CalendarID != nil {
+		w.CalendarID = in.CalendarID
+		if *in.CalendarID == uuid.Nil {
+			w.CalendarID = nil
+		}
+	}
+	if in.Subject != nil {
+		w.Subject = *in.Subject
+	}
+	if in.Categories != nil {
+		w.Categories = *in.Categories
+	}
+}
+
+// WebhookDelivery is a POST of event changes to a webhook. Failed attempts
+// are retried with backoff; a delivery that fails every attempt is dead and
+// stays in the history until redelivered. URL and Secret are those of the
+// webhook when the delivery is claimed for sending.
+type WebhookDelivery struct {
+	ID        uuid.UUID
+	WebhookID uuid.UUID
+	Status    string
+	// Payload is the JSON body, fixed when the delivery is created.
+	Payload json.RawMessage
+	// FirstSeq and LastSeq are the sequence numbers of the delivered changes.
+	FirstSeq       int64
+	LastSeq        int64
+	Changes        int
+	Attempts       int
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+	URL            string
+	Secret         string
+}
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDeliveryFilter represents filters for querying webhook deliveries.
+type WebhookDeliveryFilter struct {
+	WebhookID uuid.UUID
+	Status    string
+	Limit     int
+	Offset    int
+}
@@ -0,0 +1,18 @@
+package handler
+
+import "net/http"
+
+func (h *Handler) listCalendars(w http.ResponseWriter, r *http.Request) {
+	calendars, err := h.calendarService.ListCalendars(r.Context())
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to list calendars")
+		return
+	}
+
+	result := make([]*CalendarResponse, len(calendars))
+	for i, c := range calendars {
+		result[i] = toCalendarResponse(c)
+	}
+
+	h.respondJSON(w, http.StatusOK, ListCalendarsResponse{Calendars: result})
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+
+	// streamHeartbeatInterval is how often an idle event stream sends a comment.
+	streamHeartbeatInterval = 30 * time.Second
+)
+
+// streamEventTypes are the Server-Sent Event types of change operations.
+var streamEventTypes = map[string]string{
+	domain.ChangeOperationInsert: "created",
+	domain.ChangeOperationUpdate: "updated",
+	domain.ChangeOperationDelete: "deleted",
+}
+
+// listChanges returns the event change log after the since sequence number.
+// Consumers pass next_since of the response as since of the next request.
+func (h *Handler) listChanges(w http.ResponseWriter, r *http.Request) {
+	p := newQueryParser(r.URL.Query())
+	filter := domain.ChangeFilter{
+		Since: p.int64("since", 0, 0),
+		Limit: p.limit(defaultChangesLimit, maxChangesLimit),
+	}
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+
+	page, err := h.changeService.ListChanges(r.Context(), filter)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to list changes")
+		return
+	}
+
+	result := make([]*ChangeResponse, len(page.Changes))
+	for i, c := range page.Changes {
+		result[i] = toChangeResponse(c)
+	}
+
+	h.respondJSON(w, http.StatusOK, ListChangesResponse{
+		Changes:   result,
+		NextSince: page.NextSince,
+		HasMore:   page.HasMore,
+	})
+}
+
+// streamEvents streams changes of events matching the list filters as
+// Server-Sent Events. The event ID is the change sequence number, so a client
+// reconnecting with Last-Event-ID receives the changes it missed first.
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	p := newQueryParser(r.URL.Query())
+	filter := parseEventFilter(p)
+	if filter.Query != "" {
+		// Full-text matching is done by PostgreSQL and cannot be applied to single changes
+		p.fail("q", "not supported by the event stream")
+	}
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+
+	var since *int64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		seq, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || seq < 0 {
+			h.respondProblem(w, r, problemInvalidLastEventID, "Last-Event-ID must be a non-negative sequence number")
+			return
+		}
+		since = &seq
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Warn("failed to clear stream write deadline", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		h.logger.Error("failed to start event stream", zap.Error(err))
+		return
+	}
+
+	changes := h.changeService.Subscribe(r.Context(), filter, since)
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(toChangeResponse(c))
+			if err != nil {
+				h.logger.Error("failed to encode change", zap.Int64("seq", c.Seq), zap.Error(err))
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Seq, streamEventTypes[c.Operation], data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Comments keep proxies from closing an idle stream
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/anmaslov/calendar/internal/domain"
@@ -9,65 +11,296 @@ import (
 
 // EventResponse represents an event in API response.
 type EventResponse struct {
-	ID          uuid.UUID  `json:"id"`
-	ExchangeID  string     `json:"exchange_id"`
-	Subject     string     `json:"subject"`
-	Body        string     `json:"body,omitempty"`
-	Location    string     `json:"location,omitempty"`
-	StartTime   time.Time  `json:"start_time"`
-	EndTime     time.Time  `json:"end_time"`
-	IsAllDay    bool       `json:"is_all_day"`
-	Organizer   string     `json:"organizer,omitempty"`
-	Attendees   []string   `json:"attendees,omitempty"`
-	Categories  []string   `json:"categories,omitempty"`
-	Importance  string     `json:"importance,omitempty"`
-	Sensitivity string     `json:"sensitivity,omitempty"`
-	Status      string     `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	SyncedAt    *time.Time `json:"synced_at,omitempty"`
+	ID             uuid.UUID           `json:"id"`
+	ExchangeID     string              `json:"exchange_id"`
+	CalendarID     uuid.UUID           `json:"calendar_id"`
+	Subject        string              `json:"subject"`
+	Body           string              `json:"body,omitempty"`
+	Location       string              `json:"location,omitempty"`
+	StartTime      time.Time           `json:"start_time"`
+	EndTime        time.Time           `json:"end_time"`
+	IsAllDay       bool                `json:"is_all_day"`
+	Organizer      string              `json:"organizer,omitempty"`
+	Attendees      []AttendeeResponse  `json:"attendees,omitempty"`
+	Categories     []string            `json:"categories,omitempty"`
+	Importance     string              `json:"importance,omitempty"`
+	Sensitivity    string              `json:"sensitivity,omitempty"`
+	Status         string              `json:"status"`
+	TimeZone       string              `json:"time_zone,omitempty"`
+	Recurrence     *RecurrenceResponse `json:"recurrence,omitempty"`
+	SeriesMasterID string              `json:"series_master_id,omitempty"`
+	OriginalStart  *time.Time          `json:"original_start,omitempty"`
+	IsException    bool                `json:"is_exception,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	SyncedAt       *time.Time          `json:"synced_at,omitempty"`
+	Search         *SearchResponse     `json:"search,omitempty"`
+}
+
+// SearchResponse describes how an event matched the full-text query q.
+type SearchResponse struct {
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// AttendeeResponse represents an event attendee in API response.
+type AttendeeResponse struct {
+	Email          string `json:"email"`
+	Name           string `json:"name,omitempty"`
+	ResponseStatus string `json:"response_status,omitempty"`
+}
+
+// RecurrenceResponse represents the recurrence pattern of a series master in API response.
+type RecurrenceResponse struct {
+	Rule          string      `json:"rule"`
+	ExcludedDates []time.Time `json:"excluded_dates,omitempty"`
 }
 
 // ListEventsResponse represents the response for listing events.
 type ListEventsResponse struct {
-	Events []*EventResponse `json:"events"`
-	Total  int64            `json:"total"`
-	Limit  int              `json:"limit"`
-	Offset int              `json:"offset"`
+	Events     []*EventResponse `json:"events"`
+	Total      *int64           `json:"total,omitempty"`
+	Limit      int              `json:"limit"`
+	Offset     int              `json:"offset"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// EventRequest represents the body of create and update event requests.
+// Omitted fields keep their current values on update. CalendarID selects the
+// calendar of a new event and cannot be changed.
+type EventRequest struct {
+	CalendarID  *uuid.UUID         `json:"calendar_id"`
+	Subject     *string            `json:"subject"`
+	Body        *string            `json:"body"`
+	Location    *string            `json:"location"`
+	StartTime   *time.Time         `json:"start_time"`
+	EndTime     *time.Time         `json:"end_time"`
+	IsAllDay    *bool              `json:"is_all_day"`
+	TimeZone    *string            `json:"time_zone"`
+	Attendees   *[]AttendeeRequest `json:"attendees"`
+	Categories  *[]string          `json:"categories"`
+	Importance  *string            `json:"importance"`
+	Sensitivity *string            `json:"sensitivity"`
+}
+
+// AttendeeRequest represents an event attendee in API request.
+type AttendeeRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// CalendarResponse represents a calendar in API response.
+type CalendarResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	SourceType  string    `json:"source_type"`
+	Mailbox     string    `json:"mailbox,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	SyncDays    int       `json:"sync_days,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ListCalendarsResponse represents the response for listing calendars.
+type ListCalendarsResponse struct {
+	Calendars []*CalendarResponse `json:"calendars"`
+}
+
+// SyncRunResponse represents a sync run in API response.
+type SyncRunResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	CalendarID   uuid.UUID  `json:"calendar_id"`
+	CalendarName string     `json:"calendar_name"`
+	Trigger      string     `json:"trigger"`
+	Mode         string     `json:"mode"`
+	Status       string     `json:"status"`
+	RangeStart   *time.Time `json:"range_start,omitempty"`
+	RangeEnd     *time.Time `json:"range_end,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Fetched      int        `json:"fetched"`
+	Created      int        `json:"created"`
+	Updated      int        `json:"updated"`
+	Unchanged    int        `json:"unchanged"`
+	Deleted      int        `json:"deleted"`
+	Failed       int        `json:"failed"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// ListSyncRunsResponse represents the response for listing sync runs.
+type ListSyncRunsResponse struct {
+	Runs   []*SyncRunResponse `json:"runs"`
+	Total  int64              `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+// SyncRequest represents a request for an immediate sync. All fields are optional.
+type SyncRequest struct {
+	CalendarID *uuid.UUID `json:"calendar_id"`
+	StartDate  *time.Time `json:"start_date"`
+	EndDate    *time.Time `json:"end_date"`
+}
+
+// TriggerSyncResponse represents the response for a sync request.
+type TriggerSyncResponse struct {
+	Runs []*SyncRunResponse `json:"runs"`
+}
+
+// SyncStatusResponse represents the sync status in API response. Leader
+// reports whether the replica serving the request runs the sync worker.
+type SyncStatusResponse struct {
+	Enabled     bool                          `json:"enabled"`
+	Leader      bool                          `json:"leader"`
+	Interval    string                        `json:"interval"`
+	LastSuccess *SyncRunResponse              `json:"last_success,omitempty"`
+	LastFailure *SyncRunResponse              `json:"last_failure,omitempty"`
+	NextRunAt   *time.Time                    `json:"next_run_at,omitempty"`
+	Exchange    *CircuitResponse              `json:"exchange"`
+	Calendars   []*CalendarSyncStatusResponse `json:"calendars"`
+}
+
+// CalendarSyncStatusResponse represents the sync status of a calendar in API response.
+type CalendarSyncStatusResponse struct {
+	CalendarID    uuid.UUID  `json:"calendar_id"`
+	CalendarName  string     `json:"calendar_name"`
+	Enabled       bool       `json:"enabled"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// ChangeResponse represents an event change log entry in API response. Event
+// is the current state of the event; it is omitted for deletions and for
+// events deleted by a later change.
+type ChangeResponse struct {
+	Seq        int64          `json:"seq"`
+	Operation  string         `json:"operation"`
+	EventID    uuid.UUID      `json:"event_id"`
+	CalendarID uuid.UUID      `json:"calendar_id"`
+	ExchangeID string         `json:"exchange_id"`
+	ChangedAt  time.Time      `json:"changed_at"`
+	Event      *EventResponse `json:"event,omitempty"`
+}
+
+// ListChangesResponse represents the response for reading the change log.
+type ListChangesResponse struct {
+	Changes   []*ChangeResponse `json:"changes"`
+	NextSince int64             `json:"next_since"`
+	HasMore   bool              `json:"has_more"`
+}
+
+// WebhookRequest represents the body of create and update webhook requests.
+// Omitted fields keep their current values on update; an empty calendar_id
+// removes the calendar restriction.
+type WebhookRequest struct {
+	URL        *string   `json:"url"`
+	Secret     *string   `json:"secret"`
+	Enabled    *bool     `json:"enabled"`
+	CalendarID *string   `json:"calendar_id"`
+	Subject    *string   `json:"subject"`
+	Categories *[]string `json:"categories"`
 }
 
-// ErrorResponse represents an error response.
-type ErrorResponse struct {
-	Error ErrorDetail `json:"error"`
+// WebhookResponse represents a webhook in API response. The secret is only
+// returned when the webhook is created.
+type WebhookResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"`
+	Enabled    bool       `json:"enabled"`
+	CalendarID *uuid.UUID `json:"calendar_id,omitempty"`
+	Subject    string     `json:"subject,omitempty"`
+	Categories []string   `json:"categories,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
-// ErrorDetail represents error details.
-type ErrorDetail struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// ListWebhooksResponse represents the response for listing webhooks.
+type ListWebhooksResponse struct {
+	Webhooks []*WebhookResponse `json:"webhooks"`
+}
+
+// WebhookDeliveryResponse represents a webhook delivery in API response. The
+// payload is only returned for a single delivery.
+type WebhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	Status         string          `json:"status"`
+	FirstSeq       int64           `json:"first_seq"`
+	LastSeq        int64           `json:"last_seq"`
+	Changes        int             `json:"changes"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+}
+
+// ListWebhookDeliveriesResponse represents the response for listing webhook deliveries.
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []*WebhookDeliveryResponse `json:"deliveries"`
+	Total      int64                      `json:"total"`
+	Limit      int                        `json:"limit"`
+	Offset     int                        `json:"offset"`
+}
+
+// ProblemResponse represents an error response (RFC 7807). Code and Fields
+// are extension members: the error code and the invalid request parameters.
+type ProblemResponse struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes an invalid request parameter.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
 }
 
 // toEventResponse converts domain event to API response.
 func toEventResponse(e *domain.Event) *EventResponse {
-	return &EventResponse{
-		ID:          e.ID,
-		ExchangeID:  e.ExchangeID,
-		Subject:     e.Subject,
-		Body:        e.Body,
-		Location:    e.Location,
-		StartTime:   e.StartTime,
-		EndTime:     e.EndTime,
-		IsAllDay:    e.IsAllDay,
-		Organizer:   e.Organizer,
-		Attendees:   e.Attendees,
-		Categories:  e.Categories,
-		Importance:  e.Importance,
-		Sensitivity: e.Sensitivity,
-		Status:      e.Status,
-		CreatedAt:   e.CreatedAt,
-		UpdatedAt:   e.UpdatedAt,
-		SyncedAt:    e.SyncedAt,
+	resp := &EventResponse{
+		ID:             e.ID,
+		ExchangeID:     e.ExchangeID,
+		CalendarID:     e.CalendarID,
+		Subject:        e.Subject,
+		Body:           e.Body,
+		Location:       e.Location,
+		StartTime:      e.StartTime,
+		EndTime:        e.EndTime,
+		IsAllDay:       e.IsAllDay,
+		Organizer:      e.Organizer,
+		Attendees:      toAttendeeResponseList(e.Attendees),
+		Categories:     e.Categories,
+		Importance:     e.Importance,
+		Sensitivity:    e.Sensitivity,
+		Status:         e.Status,
+		TimeZone:       e.TimeZone,
+		Recurrence:     toRecurrenceResponse(e.Recurrence),
+		SeriesMasterID: e.SeriesMasterID,
+		OriginalStart:  e.OriginalStart,
+		IsException:    e.IsException,
+		CreatedAt:      e.CreatedAt,
+		UpdatedAt:      e.UpdatedAt,
+		SyncedAt:       e.SyncedAt,
 	}
+	if e.Match != nil {
+		resp.Search = &SearchResponse{
+			Rank:       e.Match.Rank,
+			Highlights: e.Match.Highlights,
+		}
+	}
+	return resp
 }
 
 // toEventResponseList converts a list of domain events to API responses.
@@ -78,3 +311,205 @@ func toEventResponseList(events []*domain.Event) []*EventResponse {
 	}
 	return result
 }
+
+// toAttendeeResponseList converts domain attendees to API responses.
+func toAttendeeResponseList(attendees []domain.Attendee) []AttendeeResponse {
+	if len(attendees) == 0 {
+		return nil
+	}
+	result := make([]AttendeeResponse, len(attendees))
+	for i, a := range attendees {
+		result[i] = AttendeeResponse{
+			Email:          a.Email,
+			Name:           a.Name,
+			ResponseStatus: a.ResponseStatus,
+		}
+	}
+	return result
+}
+
+// toRecurrenceResponse converts domain recurrence to API response.
+func toRecurrenceResponse(r *domain.Recurrence) *RecurrenceResponse {
+	if r == nil {
+		return nil
+	}
+	return &RecurrenceResponse{
+		Rule:          r.Rule,
+		ExcludedDates: r.ExcludedDates,
+	}
+}
+
+// toCalendarResponse converts domain calendar to API response. Feed URLs
+// are not exposed as they may embed access tokens.
+func toCalendarResponse(c *domain.Calendar) *CalendarResponse {
+	return &CalendarResponse{
+		ID:          c.ID,
+		Name:        c.Name,
+		SourceType:  c.SourceType,
+		Mailbox:     c.Mailbox,
+		DisplayName: c.DisplayName,
+		Enabled:     c.Enabled,
+		SyncDays:    c.SyncDays,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+}
+
+// toSyncRunResponse converts domain sync run to API response.
+func toSyncRunResponse(r *domain.SyncRun) *SyncRunResponse {
+	if r == nil {
+		return nil
+	}
+	return &SyncRunResponse{
+		ID:           r.ID,
+		CalendarID:   r.CalendarID,
+		CalendarName: r.CalendarName,
+		Trigger:      r.Trigger,
+		Mode:         r.Mode,
+		Status:       r.Status,
+		RangeStart:   r.RangeStart,
+		RangeEnd:     r.RangeEnd,
+		StartedAt:    r.StartedAt,
+		FinishedAt:   r.FinishedAt,
+		Fetched:      r.Fetched,
+		Created:      r.Created,
+		Updated:      r.Updated,
+		Unchanged:    r.Unchanged,
+		Deleted:      r.Deleted,
+		Failed:       r.Failed,
+		Error:        r.Error,
+	}
+}
+
+// toChangeResponse converts domain event change to API response.
+func toChangeResponse(c *domain.EventChange) *ChangeResponse {
+	resp := &ChangeResponse{
+		Seq:        c.Seq,
+		Operation:  c.Operation,
+		EventID:    c.EventID,
+		CalendarID: c.CalendarID,
+		ExchangeID: c.ExchangeID,
+		ChangedAt:  c.ChangedAt,
+	}
+	if c.Event != nil {
+		resp.Event = toEventResponse(c.Event)
+	}
+	return resp
+}
+
+// toSyncStatusResponse converts domain sync status to API response.
+func toSyncStatusResponse(s *domain.SyncStatus, leader bool) *SyncStatusResponse {
+	resp := &SyncStatusResponse{
+		Enabled:     s.Enabled,
+		Leader:      leader,
+		Interval:    s.Interval.String(),
+		LastSuccess: toSyncRunResponse(s.LastSuccess),
+		LastFailure: toSyncRunResponse(s.LastFailure),
+		NextRunAt:   s.NextRunAt,
+		Exchange:    toCircuitResponse(&s.Exchange),
+		Calendars:   make([]*CalendarSyncStatusResponse, len(s.Calendars)),
+	}
+	for i, c := range s.Calendars {
+		cal := &CalendarSyncStatusResponse{
+			CalendarID:   c.Calendar.ID,
+			CalendarName: c.Calendar.Name,
+			Enabled:      c.Calendar.Enabled,
+		}
+		if c.LastSuccess != nil {
+			cal.LastSuccessAt = &c.LastSuccess.StartedAt
+		}
+		if c.LastFailure != nil {
+			cal.LastFailureAt = &c.LastFailure.StartedAt
+			cal.LastError = c.LastFailure.Error
+		}
+		resp.Calendars[i] = cal
+	}
+	return resp
+}
+
+// toEventInput converts an API request to domain event input.
+func (r *EventRequest) toEventInput() domain.EventInput {
+	input := domain.EventInput{
+		Subject:     r.Subject,
+		Body:        r.Body,
+		Location:    r.Location,
+		StartTime:   r.StartTime,
+		EndTime:     r.EndTime,
+		IsAllDay:    r.IsAllDay,
+		TimeZone:    r.TimeZone,
+		Categories:  r.Categories,
+		Importance:  r.Importance,
+		Sensitivity: r.Sensitivity,
+	}
+	if r.Attendees != nil {
+		attendees := make([]domain.Attendee, len(*r.Attendees))
+		for i, a := range *r.Attendees {
+			attendees[i] = domain.Attendee{Email: a.Email, Name: a.Name}
+		}
+		input.Attendees = &attendees
+	}
+	return input
+}
+
+// toWebhookInput converts an API request to domain webhook input.
+func (r *WebhookRequest) toWebhookInput() (domain.WebhookInput, error) {
+	input := domain.WebhookInput{
+		URL:        r.URL,
+		Secret:     r.Secret,
+		Enabled:    r.Enabled,
+		Subject:    r.Subject,
+		Categories: r.Categories,
+	}
+
+	if r.CalendarID != nil {
+		id := uuid.Nil
+		if *r.CalendarID != "" {
+			var err error
+			if id, err = uuid.Parse(*r.CalendarID); err != nil {
+				return input, fmt.Errorf("%w: invalid calendar_id %q", domain.ErrInvalidInput, *r.CalendarID)
+			}
+		}
+		input.CalendarID = &id
+	}
+
+	return input, nil
+}
+
+// toWebhookResponse converts domain webhook to API response without its secret.
+func toWebhookResponse(w *domain.Webhook) *WebhookResponse {
+	return &WebhookResponse{
+		ID:         w.ID,
+		URL:        w.URL,
+		Enabled:    w.Enabled,
+		CalendarID: w.CalendarID,
+		Subject:    w.Subject,
+		Categories: w.Categories,
+		CreatedAt:  w.CreatedAt,
+		UpdatedAt:  w.UpdatedAt,
+	}
+}
+
+// toWebhookDeliveryResponse converts domain webhook delivery to API response.
+func toWebhookDeliveryResponse(d *domain.WebhookDelivery, withPayload bool) *WebhookDeliveryResponse {
+	resp := &WebhookDeliveryResponse{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		Status:         d.Status,
+		FirstSeq:       d.FirstSeq,
+		LastSeq:        d.LastSeq,
+		Changes:        d.Changes,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		Error:          d.Error,
+		CreatedAt:      d.CreatedAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		DeliveredAt:    d.DeliveredAt,
+	}
+	if d.Status == domain.WebhookDeliveryPending {
+		resp.NextAttemptAt = &d.NextAttemptAt
+	}
+	if withPayload {
+		resp.Payload = d.Payload
+	}
+	return resp
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the code of a problem to form its type URI.
+const problemTypePrefix = "urn:problem-type:calendar:"
+
+// problemKind is a kind of error response.
+type problemKind struct {
+	status int
+	code   string
+	title  string
+	// public marks errors whose message is meant for the client and is
+	// returned as the detail; other errors are only logged.
+	public bool
+}
+
+// Problem kinds of handler level errors.
+var (
+	problemInvalidID          = problemKind{http.StatusBadRequest, "INVALID_ID", "Invalid ID", true}
+	problemInvalidBody        = problemKind{http.StatusBadRequest, "INVALID_BODY", "Invalid request body", true}
+	problemInvalidParameters  = problemKind{http.StatusBadRequest, "INVALID_PARAMETERS", "Invalid query parameters", true}
+	problemInvalidInput       = problemKind{http.StatusBadRequest, "INVALID_INPUT", "Invalid input", true}
+	problemInvalidLastEventID = problemKind{http.StatusBadRequest, "INVALID_LAST_EVENT_ID", "Invalid Last-Event-ID", true}
+	problemNotFound           = problemKind{http.StatusNotFound, "NOT_FOUND", "Not found", true}
+	problemMethodNotAllowed   = problemKind{http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", true}
+	problemInternal           = problemKind{http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error", false}
+)
+
+// domainProblems maps domain errors to problem kinds. Errors are matched in
+// order, so that an error wrapping several domain errors gets the first kind:
+// Exchange rejecting the service credentials is an upstream failure, not an
+// unauthorized client.
+var domainProblems = []struct {
+	err  error
+	kind problemKind
+}{
+	{domain.ErrEventNotFound, problemKind{http.StatusNotFound, "NOT_FOUND", "Event not found", true}},
+	{domain.ErrCalendarNotFound, problemKind{http.StatusNotFound, "NOT_FOUND", "Calendar not found", true}},
+	{domain.ErrSyncRunNotFound, problemKind{http.StatusNotFound, "NOT_FOUND", "Sync run not found", true}},
+	{domain.ErrWebhookNotFound, problemKind{http.StatusNotFound, "NOT_FOUND", "Webhook not found", true}},
+	{domain.ErrDeliveryNotFound, problemKind{http.StatusNotFound, "NOT_FOUND", "Webhook delivery not found", true}},
+	{domain.ErrExchangeError, problemKind{http.StatusBadGateway, "EXCHANGE_ERROR", "Exchange request failed", false}},
+	{domain.ErrSyncFailed, problemKind{http.StatusBadGateway, "SYNC_FAILED", "Calendar source request failed", false}},
+	{domain.ErrInvalidInput, problemInvalidInput},
+	{domain.ErrConflict, problemKind{http.StatusConflict, "CONFLICT", "Conflict", true}},
+	{domain.ErrUnauthorized, problemKind{http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized", true}},
+	{domain.ErrForbidden, problemKind{http.StatusForbidden, "FORBIDDEN", "Forbidden", true}},
+	{domain.ErrDatabaseError, problemInternal},
+	{domain.ErrInternalError, problemInternal},
+}
+
+// problemFor returns the problem kind of an error returned by a service.
+func problemFor(err error) problemKind {
+	for _, p := range domainProblems {
+		if errors.Is(err, p.err) {
+			return p.kind
+		}
+	}
+	return problemInternal
+}
+
+// respondServiceError responds with the problem a service error maps to.
+// Errors not meant for the client are described by message and logged.
+func (h *Handler) respondServiceError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	kind := problemFor(err)
+	if kind.public {
+		h.respondProblem(w, r, kind, err.Error())
+		return
+	}
+
+	h.logger.Error(message,
+		zap.String("request_id", middleware.GetReqID(r.Context())),
+		zap.Error(err),
+	)
+	h.respondProblem(w, r, kind, message)
+}
+
+// respondInvalidParams responds with the errors of invalid query parameters.
+func (h *Handler) respondInvalidParams(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	problem := h.newProblem(r, problemInvalidParameters, "One or more query parameters are invalid")
+	problem.Fields = errs
+	h.writeProblem(w, problem)
+}
+
+// respondProblem responds with a problem of the kind.
+func (h *Handler) respondProblem(w http.ResponseWriter, r *http.Request, kind problemKind, detail string) {
+	h.writeProblem(w, h.newProblem(r, kind, detail))
+}
+
+// newProblem returns a problem of the kind. The instance is the request ID,
+// which is also logged with the request.
+func (h *Handler) newProblem(r *http.Request, kind problemKind, detail string) *ProblemResponse {
+	problem := &ProblemResponse{
+		Type:   problemTypePrefix + strings.ToLower(strings.ReplaceAll(kind.code, "_", "-")),
+		Title:  kind.title,
+		Status: kind.status,
+		Detail: detail,
+		Code:   kind.code,
+	}
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		problem.Instance = "urn:request-id:" + id
+	}
+	return problem
+}
+
+func (h *Handler) writeProblem(w http.ResponseWriter, problem *ProblemResponse) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		h.logger.Error("failed to encode response")
+	}
+}
+
+// notFound responds to requests of unknown routes.
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	h.respondProblem(w, r, problemNotFound, "No route for "+r.URL.Path)
+}
+
+// methodNotAllowed responds to requests of known routes with another method.
+func (h *Handler) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	h.respondProblem(w, r, problemMethodNotAllowed, r.Method+" is not allowed for "+r.URL.Path)
+}
@@ -1,95 +1,291 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 
 	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/ical"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 const (
 	defaultLimit  = 20
 	defaultOffset = 0
 	maxLimit      = 100
+
+	// maxRequestBodySize limits the size of create and update request bodies.
+	maxRequestBodySize = 1 << 20
 )
 
 func (h *Handler) listEvents(w http.ResponseWriter, r *http.Request) {
-	filter := parseEventFilter(r.URL.Query())
+	p := newQueryParser(r.URL.Query())
+	filter := parseEventFilter(p)
+
+	if s := p.get("cursor"); s != "" {
+		cursor, err := decodeEventCursor(s)
+		switch {
+		case err != nil:
+			p.fail("cursor", "invalid cursor")
+		case p.get("offset") != "":
+			p.fail("cursor", "cannot be combined with offset")
+		default:
+			filter.Cursor = cursor
+		}
+	}
+
+	// Pages after the first are not counted unless asked for
+	count := filter.Cursor == nil
+	if c := p.bool("count"); c != nil {
+		count = *c
+	}
+	filter.SkipCount = !count
 
-	events, total, err := h.eventService.ListEvents(r.Context(), filter)
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+
+	page, err := h.eventService.ListEvents(r.Context(), filter)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to list events")
+		h.respondServiceError(w, r, err, "Failed to list events")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, ListEventsResponse{
-		Events: toEventResponseList(events),
-		Total:  total,
+	resp := ListEventsResponse{
+		Events: toEventResponseList(page.Events),
+		Total:  page.Total,
 		Limit:  filter.Limit,
 		Offset: filter.Offset,
-	})
+	}
+	if page.Next != nil {
+		resp.NextCursor = encodeEventCursor(page.Next)
+	}
+
+	h.respondJSON(w, http.StatusOK, resp)
 }
 
-func parseEventFilter(q url.Values) domain.EventFilter {
-	filter := domain.EventFilter{
-		Limit:  defaultLimit,
-		Offset: defaultOffset,
+// eventCursor is the JSON form of an event cursor. Clients treat the encoded
+// cursor as opaque.
+type eventCursor struct {
+	Rank      float64   `json:"r,omitempty"`
+	StartTime time.Time `json:"s"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// encodeEventCursor encodes the cursor as URL-safe base64 JSON.
+func encodeEventCursor(c *domain.EventCursor) string {
+	data, _ := json.Marshal(eventCursor{Rank: c.Rank, StartTime: c.StartTime, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeEventCursor decodes a cursor returned by encodeEventCursor.
+func decodeEventCursor(s string) (*domain.EventCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c eventCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.StartTime.IsZero() || c.ID == uuid.Nil {
+		return nil, errors.New("incomplete cursor")
+	}
+
+	return &domain.EventCursor{Rank: c.Rank, StartTime: c.StartTime, ID: c.ID}, nil
+}
+
+// exportEvents renders events matching the list filters as an iCalendar feed.
+// Unlike the JSON list, the feed is not paginated unless limit is given.
+func (h *Handler) exportEvents(w http.ResponseWriter, r *http.Request) {
+	p := newQueryParser(r.URL.Query())
+	filter := parseEventFilter(p)
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+	if p.get("limit") == "" {
+		filter.Limit = 0
 	}
 
-	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
-		filter.Limit = min(l, maxLimit)
+	events, err := h.eventService.ListCalendarEvents(r.Context(), filter)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to export events")
+		return
 	}
 
-	if o, err := strconv.Atoi(q.Get("offset")); err == nil && o >= 0 {
-		filter.Offset = o
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(events); err != nil {
+		h.logger.Error("failed to encode calendar", zap.Error(err))
+		h.respondProblem(w, r, problemInternal, "Failed to export events")
+		return
 	}
 
-	if t, err := time.Parse(time.RFC3339, q.Get("start_date")); err == nil {
-		filter.StartDate = &t
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		h.logger.Error("failed to write calendar", zap.Error(err))
 	}
+}
 
-	if t, err := time.Parse(time.RFC3339, q.Get("end_date")); err == nil {
-		filter.EndDate = &t
+// parseEventFilter reads the event list filters, recording invalid ones in the parser.
+func parseEventFilter(p *queryParser) domain.EventFilter {
+	filter := domain.EventFilter{
+		Limit:  p.limit(defaultLimit, maxLimit),
+		Offset: p.offset(),
 	}
 
-	filter.Subject = q.Get("subject")
-	filter.Status = q.Get("status")
+	loc := p.location("tz")
+	filter.StartDate = p.time("start_date", loc, false)
+	filter.EndDate = p.time("end_date", loc, true)
+	if filter.StartDate != nil && filter.EndDate != nil {
+		// A date end is moved to the following midnight, so it must be past the start
+		before := filter.EndDate.Before(*filter.StartDate)
+		if isDate(p.get("end_date")) {
+			before = !filter.EndDate.After(*filter.StartDate)
+		}
+		if before {
+			p.fail("end_date", "must not be before start_date")
+		}
+	}
+	filter.RangeMode = p.oneOf("range_mode", domain.RangeOverlap, domain.RangeContained, domain.RangeStartsWithin)
+
+	filter.Subject = p.q.Get("subject")
+	filter.Query = p.get("q")
+	filter.Location = p.q.Get("location")
+	filter.Organizer = p.get("organizer")
+	filter.Attendees = p.values("attendee")
+	filter.Categories = p.values("category")
+	filter.IsAllDay = p.bool("is_all_day")
+	filter.CalendarIDs = p.uuids("calendar_id")
+
+	statuses := []string{domain.EventStatusConfirmed, domain.EventStatusTentative, domain.EventStatusCancelled}
+	filter.Status = domain.ValueFilter{In: p.values("status", statuses...), NotIn: p.values("status_not", statuses...)}
+	importances := []string{domain.ImportanceLow, domain.ImportanceNormal, domain.ImportanceHigh}
+	filter.Importance = domain.ValueFilter{In: p.values("importance", importances...), NotIn: p.values("importance_not", importances...)}
+	sensitivities := []string{domain.SensitivityNormal, domain.SensitivityPersonal, domain.SensitivityPrivate, domain.SensitivityConfidential}
+	filter.Sensitivity = domain.ValueFilter{In: p.values("sensitivity", sensitivities...), NotIn: p.values("sensitivity_not", sensitivities...)}
+
+	// Recurring series are expanded into occurrences for bounded ranges unless disabled
+	expand := p.bool("expand")
+	filter.ExpandRecurring = filter.StartDate != nil && filter.EndDate != nil && (expand == nil || *expand)
 
 	return filter
 }
 
 func (h *Handler) getEvent(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	if idStr == "" {
-		h.respondError(w, http.StatusBadRequest, "INVALID_ID", "Event ID is required")
+	id, ok := h.parseEventID(w, r)
+	if !ok {
 		return
 	}
 
-	id, err := uuid.Parse(idStr)
+	event, err := h.eventService.GetEvent(r.Context(), id)
 	if err != nil {
-		h.respondError(w, http.StatusBadRequest, "INVALID_ID", "Invalid event ID format")
+		h.respondServiceError(w, r, err, "Failed to get event")
 		return
 	}
 
-	event, err := h.eventService.GetEvent(r.Context(), id)
+	h.respondJSON(w, http.StatusOK, toEventResponse(event))
+}
+
+func (h *Handler) createEvent(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeEventRequest(w, r)
+	if !ok {
+		return
+	}
+
+	calendarID := uuid.Nil
+	if req.CalendarID != nil {
+		calendarID = *req.CalendarID
+	}
+
+	event, err := h.eventService.CreateEvent(r.Context(), calendarID, req.toEventInput())
 	if err != nil {
-		if errors.Is(err, domain.ErrEventNotFound) {
-			h.respondError(w, http.StatusNotFound, "NOT_FOUND", "Event not found")
-			return
-		}
-		h.respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to get event")
+		h.respondServiceError(w, r, err, "Failed to create event")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, toEventResponse(event))
+}
+
+func (h *Handler) updateEvent(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseEventID(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := h.decodeEventRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.CalendarID != nil {
+		h.respondProblem(w, r, problemInvalidInput, "calendar_id cannot be changed")
+		return
+	}
+
+	event, err := h.eventService.UpdateEvent(r.Context(), id, req.toEventInput())
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to update event")
 		return
 	}
 
 	h.respondJSON(w, http.StatusOK, toEventResponse(event))
 }
 
+func (h *Handler) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseEventID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.eventService.DeleteEvent(r.Context(), id); err != nil {
+		h.respondServiceError(w, r, err, "Failed to delete event")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseEventID reads the event ID URL parameter, responding with an error if it is invalid.
+func (h *Handler) parseEventID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	idStr := chi.URLParam(r, "id")
+	if idStr == "" {
+		h.respondProblem(w, r, problemInvalidID, "Event ID is required")
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		h.respondProblem(w, r, problemInvalidID, "Invalid event ID format")
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// decodeEventRequest decodes the JSON request body, responding with an error if it is malformed.
+func (h *Handler) decodeEventRequest(w http.ResponseWriter, r *http.Request) (*EventRequest, bool) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	var req EventRequest
+	if err := decoder.Decode(&req); err != nil {
+		h.respondProblem(w, r, problemInvalidBody, err.Error())
+		return nil, false
+	}
+
+	return &req, true
+}
+
 func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -97,12 +293,3 @@ func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{
 		h.logger.Error("failed to encode response")
 	}
 }
-
-func (h *Handler) respondError(w http.ResponseWriter, status int, code, message string) {
-	h.respondJSON(w, status, ErrorResponse{
-		Error: ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	})
-}
@@ -9,17 +9,33 @@ import (
 
 // Handler holds all HTTP handlers.
 type Handler struct {
-	eventService service.EventService
-	logger       *zap.Logger
-	probes       *Probes
+	eventService    service.EventService
+	calendarService service.CalendarService
+	syncService     service.SyncService
+	changeService   service.ChangeService
+	webhookService  service.WebhookService
+	logger          *zap.Logger
+	probes          *Probes
 }
 
 // New creates a new Handler.
-func New(eventService service.EventService, logger *zap.Logger, probes *Probes) *Handler {
+func New(
+	eventService service.EventService,
+	calendarService service.CalendarService,
+	syncService service.SyncService,
+	changeService service.ChangeService,
+	webhookService service.WebhookService,
+	logger *zap.Logger,
+	probes *Probes,
+) *Handler {
 	return &Handler{
-		eventService: eventService,
-		logger:       logger,
-		probes:       probes,
+		eventService:    eventService,
+		calendarService: calendarService,
+		syncService:     syncService,
+		changeService:   changeService,
+		webhookService:  webhookService,
+		logger:          logger,
+		probes:          probes,
 	}
 }
 
@@ -34,6 +50,9 @@ func (h *Handler) Router() chi.Router {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
 
+	r.NotFound(h.notFound)
+	r.MethodNotAllowed(h.methodNotAllowed)
+
 	// Health check (legacy)
 	r.Get("/health", h.healthCheck)
 
@@ -41,11 +60,34 @@ func (h *Handler) Router() chi.Router {
 	r.Get("/healthz", h.livenessProbe) // Liveness probe
 	r.Get("/readyz", h.readinessProbe) // Readiness probe
 
-	// API v1 routes (read-only)
+	// API v1 routes
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/calendars", h.listCalendars)
+		r.Get("/changes", h.listChanges)
+		r.Get("/events.ics", h.exportEvents)
+		r.Route("/sync", func(r chi.Router) {
+			r.Post("/", h.triggerSync)
+			r.Get("/runs", h.listSyncRuns)
+			r.Get("/runs/{id}", h.getSyncRun)
+			r.Get("/status", h.syncStatus)
+		})
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Get("/", h.listWebhooks)
+			r.Post("/", h.createWebhook)
+			r.Get("/{id}", h.getWebhook)
+			r.Patch("/{id}", h.updateWebhook)
+			r.Delete("/{id}", h.deleteWebhook)
+			r.Get("/{id}/deliveries", h.listWebhookDeliveries)
+			r.Get("/{id}/deliveries/{deliveryID}", h.getWebhookDelivery)
+			r.Post("/{id}/deliveries/{deliveryID}/redeliver", h.redeliverWebhook)
+		})
 		r.Route("/events", func(r chi.Router) {
 			r.Get("/", h.listEvents)
+			r.Post("/", h.createEvent)
+			r.Get("/stream", h.streamEvents)
 			r.Get("/{id}", h.getEvent)
+			r.Patch("/{id}", h.updateEvent)
+			r.Delete("/{id}", h.deleteEvent)
 		})
 	})
 
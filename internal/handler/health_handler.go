@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync/atomic"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
 )
 
 // Probes holds the state for Kubernetes probes.
 type Probes struct {
-	ready   atomic.Bool
-	healthy atomic.Bool
+	ready      atomic.Bool
+	healthy    atomic.Bool
+	syncLeader atomic.Pointer[func() bool]
+	circuit    atomic.Pointer[func() domain.CircuitState]
 }
 
 // NewProbes creates a new Probes instance.
@@ -29,6 +34,37 @@ func (p *Probes) SetHealthy(healthy bool) {
 	p.healthy.Store(healthy)
 }
 
+// SetSyncLeader registers the function reporting whether this replica runs
+// the sync worker as the leader. Without it sync status is not reported.
+func (p *Probes) SetSyncLeader(isLeader func() bool) {
+	p.syncLeader.Store(&isLeader)
+}
+
+// SyncStatus returns whether the sync worker runs and whether this replica is its leader.
+func (p *Probes) SyncStatus() (enabled, leader bool) {
+	isLeader := p.syncLeader.Load()
+	if isLeader == nil {
+		return false, false
+	}
+	return true, (*isLeader)()
+}
+
+// SetExchangeCircuit registers the function reporting the state of the
+// Exchange circuit breaker. Without it the circuit is not reported.
+func (p *Probes) SetExchangeCircuit(state func() domain.CircuitState) {
+	p.circuit.Store(&state)
+}
+
+// ExchangeCircuit returns the state of the Exchange circuit breaker, or nil if it is not registered.
+func (p *Probes) ExchangeCircuit() *domain.CircuitState {
+	state := p.circuit.Load()
+	if state == nil {
+		return nil
+	}
+	s := (*state)()
+	return &s
+}
+
 // IsReady returns true if the application is ready.
 func (p *Probes) IsReady() bool {
 	return p.ready.Load()
@@ -41,13 +77,31 @@ func (p *Probes) IsHealthy() bool {
 
 // HealthResponse represents the health check response.
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status   string              `json:"status"`
+	Sync     *SyncHealthResponse `json:"sync,omitempty"`
+	Exchange *CircuitResponse    `json:"exchange,omitempty"`
 }
 
-// ReadinessResponse represents the readiness check response.
+// CircuitResponse represents the state of the Exchange circuit breaker.
+type CircuitResponse struct {
+	Circuit             string     `json:"circuit"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// SyncHealthResponse represents the sync worker state of this replica.
+type SyncHealthResponse struct {
+	Leader bool `json:"leader"`
+}
+
+// ReadinessResponse represents the readiness check response. An open
+// Exchange circuit is reported but does not make the replica unready, since
+// the API is served from the database.
 type ReadinessResponse struct {
-	Status string `json:"status"`
-	Ready  bool   `json:"ready"`
+	Status   string           `json:"status"`
+	Ready    bool             `json:"ready"`
+	Exchange *CircuitResponse `json:"exchange,omitempty"`
 }
 
 // LivenessResponse represents the liveness check response.
@@ -58,8 +112,29 @@ type LivenessResponse struct {
 
 func (h *Handler) healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	resp := HealthResponse{Status: "ok"}
+	if h.probes != nil {
+		if enabled, leader := h.probes.SyncStatus(); enabled {
+			resp.Sync = &SyncHealthResponse{Leader: leader}
+		}
+		resp.Exchange = toCircuitResponse(h.probes.ExchangeCircuit())
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// toCircuitResponse converts the circuit breaker state to API response.
+func toCircuitResponse(s *domain.CircuitState) *CircuitResponse {
+	if s == nil {
+		return nil
+	}
+	return &CircuitResponse{
+		Circuit:             s.State,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		OpenedAt:            s.OpenedAt,
+		RetryAt:             s.RetryAt,
+	}
 }
 
 // readinessProbe handles Kubernetes readiness probe.
@@ -78,8 +153,9 @@ func (h *Handler) readinessProbe(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(ReadinessResponse{
-		Status: "ready",
-		Ready:  true,
+		Status:   "ready",
+		Ready:    true,
+		Exchange: toCircuitResponse(h.probes.ExchangeCircuit()),
 	})
 }
 
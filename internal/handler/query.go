@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"github.com/google/uuid"
+)
+
+// Accepted date and time formats of query parameters besides RFC 3339.
+// Values without an offset are in the time zone of the tz parameter.
+const (
+	localDateTimeLayout = "2006-01-02T15:04:05"
+	localMinuteLayout   = "2006-01-02T15:04"
+	dateLayout          = "2006-01-02"
+)
+
+// queryParser reads query parameters, collecting an error for every invalid
+// one instead of ignoring it.
+type queryParser struct {
+	q      url.Values
+	errors []FieldError
+}
+
+func newQueryParser(q url.Values) *queryParser {
+	return &queryParser{q: q}
+}
+
+// get returns the trimmed value of the parameter.
+func (p *queryParser) get(name string) string {
+	return strings.TrimSpace(p.q.Get(name))
+}
+
+// fail records an error of the parameter.
+func (p *queryParser) fail(name, reason string) {
+	p.errors = append(p.errors, FieldError{Field: name, Reason: reason})
+}
+
+// failed returns true if any parameter was invalid.
+func (p *queryParser) failed() bool {
+	return len(p.errors) > 0
+}
+
+// int64 returns the parameter as an integer of at least minValue, or def if
+// it is absent.
+func (p *queryParser) int64(name string, def, minValue int64) int64 {
+	s := p.get(name)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		p.fail(name, "must be an integer")
+		return def
+	}
+	if v < minValue {
+		p.fail(name, "must be at least "+strconv.FormatInt(minValue, 10))
+		return def
+	}
+	return v
+}
+
+// int returns the parameter as an integer of at least minValue, or def if it
+// is absent.
+func (p *queryParser) int(name string, def, minValue int) int {
+	return int(p.int64(name, int64(def), int64(minValue)))
+}
+
+// limit returns the page size parameter capped at maxValue.
+func (p *queryParser) limit(def, maxValue int) int {
+	return min(p.int("limit", def, 1), maxValue)
+}
+
+// offset returns the page offset parameter.
+func (p *queryParser) offset() int {
+	return p.int("offset", defaultOffset, 0)
+}
+
+// bool returns the parameter as a boolean, or nil if it is absent.
+func (p *queryParser) bool(name string) *bool {
+	s := p.get(name)
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		p.fail(name, "must be true or false")
+		return nil
+	}
+	return &v
+}
+
+// oneOf returns the parameter if it is one of the allowed values, or empty
+// string.
+func (p *queryParser) oneOf(name string, allowed ...string) string {
+	s := p.get(name)
+	if s != "" && !slices.Contains(allowed, s) {
+		p.fail(name, "must be one of "+strings.Join(allowed, ", "))
+		return ""
+	}
+	return s
+}
+
+// values returns the values of a parameter that may be repeated or
+// comma-separated. If allowed values are given, every value must be one of
+// them.
+func (p *queryParser) values(name string, allowed ...string) []string {
+	var values []string
+	for _, v := range p.q[name] {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if len(allowed) > 0 && !slices.Contains(allowed, s) {
+				p.fail(name, strconv.Quote(s)+" is not one of "+strings.Join(allowed, ", "))
+				continue
+			}
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// uuid returns the parameter as a UUID, or nil if it is absent.
+func (p *queryParser) uuid(name string) *uuid.UUID {
+	s := p.get(name)
+	if s == "" {
+		return nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		p.fail(name, "must be a UUID")
+		return nil
+	}
+	return &id
+}
+
+// uuids returns the UUIDs of a parameter that may be repeated or comma-separated.
+func (p *queryParser) uuids(name string) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, s := range p.values(name) {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			p.fail(name, strconv.Quote(s)+" is not a UUID")
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// location returns the time zone named by the parameter, UTC if it is absent.
+func (p *queryParser) location(name string) *time.Location {
+	s := p.get(name)
+	if s == "" {
+		return time.UTC
+	}
+	loc, ok := recurrence.LoadLocation(s)
+	if !ok {
+		p.fail(name, "unknown time zone")
+	}
+	return loc
+}
+
+// isDate returns true if the value is a date without time.
+func isDate(s string) bool {
+	_, err := time.Parse(dateLayout, s)
+	return err == nil
+}
+
+// time returns the parameter as a time, or nil if it is absent. Besides
+// RFC 3339 it accepts a date and time without an offset and a date, both in
+// loc. A date is its midnight, or the following midnight with endOfDay, so
+// that a date range includes its last day.
+func (p *queryParser) time(name string, loc *time.Location, endOfDay bool) *time.Time {
+	s := p.get(name)
+	if s == "" {
+		return nil
+	}
+	// An unescaped + of the offset arrives as a space
+	s = strings.Replace(s, " ", "+", 1)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t
+	}
+	for _, layout := range []string{localDateTimeLayout, localMinuteLayout} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return &t
+		}
+	}
+	if t, err := time.ParseInLocation(dateLayout, s, loc); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return &t
+	}
+
+	p.fail(name, "must be an RFC 3339 timestamp (2006-01-02T15:04:05Z07:00), a local date and time (2006-01-02T15:04:05) or a date (2006-01-02)")
+	return nil
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// triggerSync requests an immediate sync. The runs are performed by the sync
+// leader; their IDs can be polled through getSyncRun.
+func (h *Handler) triggerSync(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	// The body is optional: without it all enabled calendars are synced
+	var req SyncRequest
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.respondProblem(w, r, problemInvalidBody, err.Error())
+		return
+	}
+
+	runs, err := h.syncService.Trigger(r.Context(), domain.SyncRequest{
+		CalendarID: req.CalendarID,
+		StartDate:  req.StartDate,
+		EndDate:    req.EndDate,
+	})
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to request sync")
+		return
+	}
+
+	result := make([]*SyncRunResponse, len(runs))
+	for i, run := range runs {
+		result[i] = toSyncRunResponse(run)
+	}
+
+	h.respondJSON(w, http.StatusAccepted, TriggerSyncResponse{Runs: result})
+}
+
+func (h *Handler) getSyncRun(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.respondProblem(w, r, problemInvalidID, "Invalid sync run ID format")
+		return
+	}
+
+	run, err := h.syncService.GetRun(r.Context(), id)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to get sync run")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, toSyncRunResponse(run))
+}
+
+func (h *Handler) listSyncRuns(w http.ResponseWriter, r *http.Request) {
+	p := newQueryParser(r.URL.Query())
+	filter := parseSyncRunFilter(p)
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+
+	runs, total, err := h.syncService.ListRuns(r.Context(), filter)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to list sync runs")
+		return
+	}
+
+	result := make([]*SyncRunResponse, len(runs))
+	for i, run := range runs {
+		result[i] = toSyncRunResponse(run)
+	}
+
+	h.respondJSON(w, http.StatusOK, ListSyncRunsResponse{
+		Runs:   result,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+func (h *Handler) syncStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.syncService.Status(r.Context())
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to get sync status")
+		return
+	}
+
+	var leader bool
+	if h.probes != nil {
+		_, leader = h.probes.SyncStatus()
+	}
+
+	h.respondJSON(w, http.StatusOK, toSyncStatusResponse(status, leader))
+}
+
+// parseSyncRunFilter reads the sync run list filters, recording invalid ones in the parser.
+func parseSyncRunFilter(p *queryParser) domain.SyncRunFilter {
+	return domain.SyncRunFilter{
+		Limit:      p.limit(defaultLimit, maxLimit),
+		Offset:     p.offset(),
+		CalendarID: p.uuid("calendar_id"),
+		Status: p.oneOf("status",
+			domain.SyncRunStatusPending, domain.SyncRunStatusRunning,
+			domain.SyncRunStatusSucceeded, domain.SyncRunStatusFailed,
+		),
+	}
+}
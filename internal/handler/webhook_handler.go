@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func (h *Handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.ListWebhooks(r.Context())
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to list webhooks")
+		return
+	}
+
+	result := make([]*WebhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = toWebhookResponse(webhook)
+	}
+
+	h.respondJSON(w, http.StatusOK, ListWebhooksResponse{Webhooks: result})
+}
+
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	input, ok := h.decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(r.Context(), input)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to create webhook")
+		return
+	}
+
+	// The secret is shown once so that the receiver can verify signatures
+	resp := toWebhookResponse(webhook)
+	resp.Secret = webhook.Secret
+
+	h.respondJSON(w, http.StatusCreated, resp)
+}
+
+func (h *Handler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseUUIDParam(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.GetWebhook(r.Context(), id)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to get webhook")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, toWebhookResponse(webhook))
+}
+
+func (h *Handler) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseUUIDParam(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	input, ok := h.decodeWebhookRequest(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(r.Context(), id, input)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to update webhook")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, toWebhookResponse(webhook))
+}
+
+func (h *Handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseUUIDParam(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(r.Context(), id); err != nil {
+		h.respondServiceError(w, r, err, "Failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.parseUUIDParam(w, r, "id", "webhook")
+	if !ok {
+		return
+	}
+
+	p := newQueryParser(r.URL.Query())
+	filter := domain.WebhookDeliveryFilter{
+		WebhookID: id,
+		Status:    p.oneOf("status", domain.WebhookDeliveryPending, domain.WebhookDeliveryDelivered, domain.WebhookDeliveryDead),
+		Limit:     p.limit(defaultLimit, maxLimit),
+		Offset:    p.offset(),
+	}
+	if p.failed() {
+		h.respondInvalidParams(w, r, p.errors)
+		return
+	}
+
+	deliveries, total, err := h.webhookService.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to list webhook deliveries")
+		return
+	}
+
+	result := make([]*WebhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		result[i] = toWebhookDeliveryResponse(d, false)
+	}
+
+	h.respondJSON(w, http.StatusOK, ListWebhookDeliveriesResponse{
+		Deliveries: result,
+		Total:      total,
+		Limit:      filter.Limit,
+		Offset:     filter.Offset,
+	})
+}
+
+func (h *Handler) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	webhookID, deliveryID, ok := h.parseDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.GetDelivery(r.Context(), webhookID, deliveryID)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to get webhook delivery")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, toWebhookDeliveryResponse(delivery, true))
+}
+
+// redeliverWebhook schedules a delivered or dead-lettered delivery to be sent again.
+func (h *Handler) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, deliveryID, ok := h.parseDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(r.Context(), webhookID, deliveryID)
+	if err != nil {
+		h.respondServiceError(w, r, err, "Failed to redeliver webhook")
+		return
+	}
+
+	h.respondJSON(w, http.StatusAccepted, toWebhookDeliveryResponse(delivery, false))
+}
+
+// parseDeliveryParams reads the webhook and delivery ID URL parameters,
+// responding with an error if either is invalid.
+func (h *Handler) parseDeliveryParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	webhookID, ok := h.parseUUIDParam(w, r, "id", "webhook")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	deliveryID, ok := h.parseUUIDParam(w, r, "deliveryID", "delivery")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return webhookID, deliveryID, true
+}
+
+// parseUUIDParam reads a UUID URL parameter, responding with an error if it is invalid.
+func (h *Handler) parseUUIDParam(w http.ResponseWriter, r *http.Request, param, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, param))
+	if err != nil {
+		h.respondProblem(w, r, problemInvalidID, "Invalid "+name+" ID format")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// decodeWebhookRequest decodes the JSON request body, responding with an error if it is malformed.
+func (h *Handler) decodeWebhookRequest(w http.ResponseWriter, r *http.Request) (domain.WebhookInput, bool) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	var req WebhookRequest
+	if err := decoder.Decode(&req); err != nil {
+		h.respondProblem(w, r, problemInvalidBody, err.Error())
+		return domain.WebhookInput{}, false
+	}
+
+	input, err := req.toWebhookInput()
+	if err != nil {
+		h.respondServiceError(w, r, err, "Invalid webhook")
+		return domain.WebhookInput{}, false
+	}
+
+	return input, true
+}
@@ -0,0 +1,413 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"github.com/google/uuid"
+)
+
+// Decoder reads events from an iCalendar object.
+type Decoder struct {
+	r       io.Reader
+	maxSize int64
+}
+
+// NewDecoder returns a decoder that reads at most maxSize bytes from r.
+func NewDecoder(r io.Reader, maxSize int64) *Decoder {
+	return &Decoder{r: r, maxSize: maxSize}
+}
+
+// EventError describes a VEVENT component skipped because it is malformed.
+type EventError struct {
+	UID string
+	Err error
+}
+
+func (e *EventError) Error() string {
+	return fmt.Sprintf("failed to parse event %q: %v", e.UID, e.Err)
+}
+
+func (e *EventError) Unwrap() error {
+	return e.Err
+}
+
+// Decode parses all VEVENT components of the calendar. A malformed event
+// does not fail the whole calendar: it is skipped and returned as an
+// EventError along with the events that could be parsed. Calendars larger
+// than the decoder's maximum size are rejected.
+//
+// Events are identified by UID, which is used as their Exchange ID. An event
+// with RECURRENCE-ID is an exception of the series with the same UID and gets
+// an ID combining the UID and the original start.
+//
+// Times with a TZID are resolved through the time zone database or, for
+// unknown zones, through the VTIMEZONE definitions of the calendar; events in
+// such zones have no TimeZone, so their series are expanded in UTC. Floating
+// times use X-WR-TIMEZONE, falling back to UTC. Recurrence rules that cannot
+// be evaluated are dropped and the series master is kept as a single event.
+func (d *Decoder) Decode() ([]*domain.Event, []*EventError, error) {
+	data, err := io.ReadAll(io.LimitReader(d.r, d.maxSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	if int64(len(data)) > d.maxSize {
+		return nil, nil, fmt.Errorf("calendar exceeds %d bytes", d.maxSize)
+	}
+
+	roots, err := parseComponents(string(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse calendar: %w", err)
+	}
+
+	var (
+		events  []*domain.Event
+		skipped []*EventError
+	)
+	for _, root := range roots {
+		if root.name != "VCALENDAR" {
+			continue
+		}
+
+		cal := newCalendar(root)
+		for _, c := range root.children {
+			if c.name != "VEVENT" {
+				continue
+			}
+
+			event, err := cal.event(c)
+			if err != nil {
+				skipped = append(skipped, &EventError{UID: c.value("UID"), Err: err})
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	return events, skipped, nil
+}
+
+// calendar holds time zone context shared by the events of a VCALENDAR.
+type calendar struct {
+	definitions map[string]*component
+	zones       map[string]*timeZone
+	floating    *timeZone
+}
+
+func newCalendar(root *component) *calendar {
+	cal := &calendar{
+		definitions: make(map[string]*component),
+		zones:       make(map[string]*timeZone),
+		floating:    utcZone,
+	}
+
+	for _, c := range root.children {
+		if c.name == "VTIMEZONE" {
+			cal.definitions[c.value("TZID")] = c
+		}
+	}
+
+	if tzid := root.value("X-WR-TIMEZONE"); tzid != "" {
+		if zone := cal.zone(tzid); zone != nil {
+			cal.floating = zone
+		}
+	}
+
+	return cal
+}
+
+// zone returns the resolved zone for a TZID, caching the result.
+func (cal *calendar) zone(tzid string) *timeZone {
+	zone, ok := cal.zones[tzid]
+	if !ok {
+		zone = resolveZone(tzid, cal.definitions)
+		cal.zones[tzid] = zone
+	}
+	return zone
+}
+
+// propertyZone returns the zone a DATE-TIME property is written in.
+func (cal *calendar) propertyZone(p *property) *timeZone {
+	if tzid := p.param("TZID"); tzid != "" {
+		if zone := cal.zone(tzid); zone != nil {
+			return zone
+		}
+	}
+	return cal.floating
+}
+
+func (cal *calendar) event(c *component) (*domain.Event, error) {
+	startProp := c.get("DTSTART")
+	if startProp == nil {
+		return nil, fmt.Errorf("missing DTSTART")
+	}
+
+	start, allDay, err := cal.parseTime(startProp, startProp.value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DTSTART: %w", err)
+	}
+	zone := cal.propertyZone(startProp)
+	if strings.HasSuffix(startProp.value, "Z") {
+		zone = utcZone
+	}
+
+	event := domain.NewEvent()
+	event.StartTime = start.UTC()
+	event.IsAllDay = allDay
+	event.TimeZone = zone.name
+
+	if event.EndTime, err = cal.end(c, start, allDay); err != nil {
+		return nil, err
+	}
+
+	event.Subject = unescapeText(c.value("SUMMARY"))
+	event.Body = unescapeText(c.value("DESCRIPTION"))
+	event.Location = unescapeText(c.value("LOCATION"))
+	event.Status = eventStatus(c.value("STATUS"))
+	event.Sensitivity = sensitivity(c.value("CLASS"))
+	event.Importance = importance(c.value("PRIORITY"))
+	event.Organizer = mailAddress(c.value("ORGANIZER"))
+
+	for _, p := range c.all("ATTENDEE") {
+		email := mailAddress(p.value)
+		if email == "" {
+			continue
+		}
+		event.Attendees = append(event.Attendees, domain.Attendee{
+			Email:          email,
+			Name:           p.param("CN"),
+			ResponseStatus: responseStatus(p.param("PARTSTAT")),
+		})
+	}
+
+	for _, p := range c.all("CATEGORIES") {
+		for _, category := range splitText(p.value) {
+			if category = strings.TrimSpace(category); category != "" {
+				event.Categories = append(event.Categories, category)
+			}
+		}
+	}
+
+	uid := c.value("UID")
+	if uid == "" {
+		// Without a UID the event is identified by its content.
+		uid = uuid.NewSHA1(uuid.NameSpaceOID, []byte(startProp.value+"\n"+event.Subject)).String()
+	}
+
+	if p := c.get("RECURRENCE-ID"); p != nil {
+		originalStart, _, err := cal.parseTime(p, p.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RECURRENCE-ID: %w", err)
+		}
+		originalStart = originalStart.UTC()
+
+		event.ExchangeID = uid + "/" + formatUTC(originalStart)
+		event.SeriesMasterID = uid
+		event.OriginalStart = &originalStart
+		event.IsException = true
+		return event, nil
+	}
+
+	event.ExchangeID = uid
+	if rule := c.value("RRULE"); rule != "" && recurrence.Validate(rule) == nil {
+		excluded, err := cal.excludedDates(c, start, allDay)
+		if err != nil {
+			return nil, err
+		}
+		event.Recurrence = &domain.Recurrence{Rule: rule, ExcludedDates: excluded}
+	}
+
+	return event, nil
+}
+
+// end returns the event end from DTEND or DURATION. Without either, all-day
+// events last one day and timed events end when they start.
+func (cal *calendar) end(c *component, start time.Time, allDay bool) (time.Time, error) {
+	if p := c.get("DTEND"); p != nil {
+		end, _, err := cal.parseTime(p, p.value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid DTEND: %w", err)
+		}
+		return end.UTC(), nil
+	}
+
+	if v := c.value("DURATION"); v != "" {
+		days, d, err := parseDuration(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid DURATION: %w", err)
+		}
+		return start.AddDate(0, 0, days).Add(d).UTC(), nil
+	}
+
+	if allDay {
+		return start.AddDate(0, 0, 1).UTC(), nil
+	}
+	return start.UTC(), nil
+}
+
+// excludedDates returns EXDATE values as original start times. Dates
+// excluding occurrences of a timed series are combined with its start time.
+func (cal *calendar) excludedDates(c *component, start time.Time, allDay bool) ([]time.Time, error) {
+	var result []time.Time
+	for _, p := range c.all("EXDATE") {
+		for _, v := range strings.Split(p.value, ",") {
+			t, isDate, err := cal.parseTime(&p, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EXDATE: %w", err)
+			}
+			if isDate && !allDay {
+				t = time.Date(t.Year(), t.Month(), t.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			}
+			result = append(result, t.UTC())
+		}
+	}
+	return result, nil
+}
+
+// parseTime parses a DATE or DATE-TIME value of the property. DATE values
+// denote midnight in the floating zone; the second result reports them.
+func (cal *calendar) parseTime(p *property, value string) (time.Time, bool, error) {
+	if p.param("VALUE") == "DATE" || len(value) == len(dateFormat) {
+		wall, err := time.Parse(dateFormat, value)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return cal.floating.instant(wall).In(cal.floating.location(wall)), true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcDateTimeFormat, value)
+		return t, false, err
+	}
+
+	wall, err := time.Parse(localTimeFormat, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	zone := cal.propertyZone(p)
+	return zone.instant(wall).In(zone.location(wall)), false, nil
+}
+
+// parseDuration parses an RFC 5545 duration such as "P1D", "PT1H30M" or "P2W"
+// into whole days and the remaining time.
+func parseDuration(s string) (int, time.Duration, error) {
+	sign := 1
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, 0, fmt.Errorf("malformed duration %q", s)
+	}
+
+	var (
+		days   int
+		d      time.Duration
+		inTime bool
+		number string
+	)
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, 0, fmt.Errorf("malformed duration %q", s)
+		}
+		number = ""
+
+		switch {
+		case r == 'W' && !inTime:
+			days += 7 * n
+		case r == 'D' && !inTime:
+			days += n
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, 0, fmt.Errorf("malformed duration %q", s)
+		}
+	}
+	if number != "" {
+		return 0, 0, fmt.Errorf("malformed duration %q", s)
+	}
+
+	return sign * days, time.Duration(sign) * d, nil
+}
+
+// mailAddress strips the mailto: scheme from a CAL-ADDRESS value.
+func mailAddress(value string) string {
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		return value[len("mailto:"):]
+	}
+	return value
+}
+
+// eventStatus maps STATUS to the event status.
+func eventStatus(s string) string {
+	switch strings.ToUpper(s) {
+	case "CANCELLED":
+		return domain.EventStatusCancelled
+	case "TENTATIVE":
+		return domain.EventStatusTentative
+	default:
+		return domain.EventStatusConfirmed
+	}
+}
+
+// sensitivity maps CLASS to event sensitivity.
+func sensitivity(class string) string {
+	switch strings.ToUpper(class) {
+	case "PRIVATE":
+		return domain.SensitivityPrivate
+	case "CONFIDENTIAL":
+		return domain.SensitivityConfidential
+	default:
+		return domain.SensitivityNormal
+	}
+}
+
+// importance maps PRIORITY to event importance: 1-4 is high, 6-9 is low.
+func importance(priority string) string {
+	p, err := strconv.Atoi(priority)
+	switch {
+	case err != nil || p == 0 || p == 5:
+		return domain.ImportanceNormal
+	case p < 5:
+		return domain.ImportanceHigh
+	default:
+		return domain.ImportanceLow
+	}
+}
+
+// responseStatus maps PARTSTAT to an attendee response status.
+func responseStatus(partStat string) string {
+	switch strings.ToUpper(partStat) {
+	case "ACCEPTED":
+		return domain.ResponseStatusAccepted
+	case "TENTATIVE":
+		return domain.ResponseStatusTentative
+	case "DECLINED":
+		return domain.ResponseStatusDeclined
+	case "NEEDS-ACTION", "":
+		return domain.ResponseStatusNone
+	default:
+		return domain.ResponseStatusUnknown
+	}
+}
@@ -0,0 +1,568 @@
+package ical
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+)
+
+// testMaxSize is the size limit of calendars decoded in tests.
+const testMaxSize = 1 << 20
+
+// calendarData returns a VCALENDAR with the content lines.
+func calendarData(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VCALENDAR\r\n"
+}
+
+// decodeEvents decodes the data, failing the test on a calendar error.
+func decodeEvents(t *testing.T, data string) ([]*domain.Event, []*EventError) {
+	t.Helper()
+
+	events, skipped, err := NewDecoder(strings.NewReader(data), testMaxSize).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return events, skipped
+}
+
+// eventTimes are the identity and scheduling fields of a decoded event.
+type eventTimes struct {
+	ExchangeID     string
+	StartTime      time.Time
+	EndTime        time.Time
+	IsAllDay       bool
+	TimeZone       string
+	Rule           string
+	ExcludedDates  []time.Time
+	SeriesMasterID string
+	OriginalStart  time.Time
+}
+
+func timesOf(e *domain.Event) eventTimes {
+	times := eventTimes{
+		ExchangeID:     e.ExchangeID,
+		StartTime:      e.StartTime,
+		EndTime:        e.EndTime,
+		IsAllDay:       e.IsAllDay,
+		TimeZone:       e.TimeZone,
+		SeriesMasterID: e.SeriesMasterID,
+	}
+	if e.Recurrence != nil {
+		times.Rule = e.Recurrence.Rule
+		times.ExcludedDates = e.Recurrence.ExcludedDates
+	}
+	if e.OriginalStart != nil {
+		times.OriginalStart = *e.OriginalStart
+	}
+	return times
+}
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+// customEastern is a VTIMEZONE with rules for a TZID unknown to the time zone database.
+var customEastern = []string{
+	"BEGIN:VTIMEZONE",
+	"TZID:Eastern (custom)",
+	"BEGIN:STANDARD",
+	"DTSTART:19671029T020000",
+	"RRULE:FREQ=YEARLY;BYDAY=1SU;BYMONTH=11",
+	"TZOFFSETFROM:-0400",
+	"TZOFFSETTO:-0500",
+	"END:STANDARD",
+	"BEGIN:DAYLIGHT",
+	"DTSTART:19870405T020000",
+	"RRULE:FREQ=YEARLY;BYDAY=2SU;BYMONTH=3",
+	"TZOFFSETFROM:-0500",
+	"TZOFFSETTO:-0400",
+	"END:DAYLIGHT",
+	"END:VTIMEZONE",
+}
+
+func TestDecodeTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar []string
+		event    []string
+		want     eventTimes
+	}{
+		{
+			name: "IANA TZID",
+			event: []string{
+				"UID:1",
+				"DTSTART;TZID=Europe/Berlin:20240115T100000",
+				"DTEND;TZID=Europe/Berlin:20240115T110000",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 9, 0), EndTime: utc(2024, 1, 15, 10, 0), TimeZone: "Europe/Berlin"},
+		},
+		{
+			name: "Windows TZID",
+			event: []string{
+				"UID:1",
+				`DTSTART;TZID="Russian Standard Time":20240115T100000`,
+				`DTEND;TZID="Russian Standard Time":20240115T110000`,
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 7, 0), EndTime: utc(2024, 1, 15, 8, 0), TimeZone: "Europe/Moscow"},
+		},
+		{
+			name: "TZID with a vendor prefix",
+			event: []string{
+				"UID:1",
+				"DTSTART;TZID=/citadel.org/20070227_1/Europe/Moscow:20240115T100000",
+				"DTEND;TZID=/citadel.org/20070227_1/Europe/Moscow:20240115T110000",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 7, 0), EndTime: utc(2024, 1, 15, 8, 0), TimeZone: "Europe/Moscow"},
+		},
+		{
+			name:     "TZID defined by VTIMEZONE in winter",
+			calendar: customEastern,
+			event: []string{
+				"UID:1",
+				"DTSTART;TZID=Eastern (custom):20240115T100000",
+				"DTEND;TZID=Eastern (custom):20240115T110000",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 15, 0), EndTime: utc(2024, 1, 15, 16, 0)},
+		},
+		{
+			name:     "TZID defined by VTIMEZONE in summer",
+			calendar: customEastern,
+			event: []string{
+				"UID:1",
+				"DTSTART;TZID=Eastern (custom):20240715T100000",
+				"DURATION:PT1H30M",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 7, 15, 14, 0), EndTime: utc(2024, 7, 15, 15, 30)},
+		},
+		{
+			name: "UTC",
+			event: []string{
+				"UID:1",
+				"DTSTART:20240115T100000Z",
+				"DTEND:20240115T110000Z",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 10, 0), EndTime: utc(2024, 1, 15, 11, 0)},
+		},
+		{
+			name:     "floating time in the calendar time zone",
+			calendar: []string{"X-WR-TIMEZONE:Europe/Moscow"},
+			event: []string{
+				"UID:1",
+				"DTSTART:20240115T100000",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 7, 0), EndTime: utc(2024, 1, 15, 7, 0), TimeZone: "Europe/Moscow"},
+		},
+		{
+			name:     "UTC time in a calendar with a time zone",
+			calendar: []string{"X-WR-TIMEZONE:Europe/Moscow"},
+			event: []string{
+				"UID:1",
+				"DTSTART:20240115T100000Z",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 10, 0), EndTime: utc(2024, 1, 15, 10, 0)},
+		},
+		{
+			name: "unknown TZID falls back to floating time",
+			event: []string{
+				"UID:1",
+				"DTSTART;TZID=Mars/Olympus:20240115T100000",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 10, 0), EndTime: utc(2024, 1, 15, 10, 0)},
+		},
+		{
+			name: "all-day series with an excluded date",
+			event: []string{
+				"UID:holidays",
+				"DTSTART;VALUE=DATE:20240304",
+				"RRULE:FREQ=DAILY;COUNT=5",
+				"EXDATE;VALUE=DATE:20240306",
+			},
+			want: eventTimes{
+				ExchangeID:    "holidays",
+				StartTime:     utc(2024, 3, 4, 0, 0),
+				EndTime:       utc(2024, 3, 5, 0, 0),
+				IsAllDay:      true,
+				Rule:          "FREQ=DAILY;COUNT=5",
+				ExcludedDates: []time.Time{utc(2024, 3, 6, 0, 0)},
+			},
+		},
+		{
+			name:     "all-day event in the calendar time zone",
+			calendar: []string{"X-WR-TIMEZONE:Europe/Moscow"},
+			event: []string{
+				"UID:trip",
+				"DTSTART;VALUE=DATE:20240304",
+				"DTEND;VALUE=DATE:20240306",
+			},
+			want: eventTimes{
+				ExchangeID: "trip",
+				StartTime:  utc(2024, 3, 3, 21, 0),
+				EndTime:    utc(2024, 3, 5, 21, 0),
+				IsAllDay:   true,
+				TimeZone:   "Europe/Moscow",
+			},
+		},
+		{
+			name: "timed series with excluded dates and date-only EXDATE",
+			event: []string{
+				"UID:standup",
+				"DTSTART;TZID=Europe/Berlin:20240115T100000",
+				"DTEND;TZID=Europe/Berlin:20240115T101500",
+				"RRULE:FREQ=DAILY;COUNT=10",
+				"EXDATE;TZID=Europe/Berlin:20240116T100000,20240117T100000",
+				"EXDATE;VALUE=DATE:20240118",
+			},
+			want: eventTimes{
+				ExchangeID:    "standup",
+				StartTime:     utc(2024, 1, 15, 9, 0),
+				EndTime:       utc(2024, 1, 15, 9, 15),
+				TimeZone:      "Europe/Berlin",
+				Rule:          "FREQ=DAILY;COUNT=10",
+				ExcludedDates: []time.Time{utc(2024, 1, 16, 9, 0), utc(2024, 1, 17, 9, 0), utc(2024, 1, 18, 9, 0)},
+			},
+		},
+		{
+			name: "invalid rule keeps the master as a single event",
+			event: []string{
+				"UID:1",
+				"DTSTART:20240115T100000Z",
+				"RRULE:FREQ=SOMETIMES",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 1, 15, 10, 0), EndTime: utc(2024, 1, 15, 10, 0)},
+		},
+		{
+			name: "exception of a series",
+			event: []string{
+				"UID:standup",
+				"RECURRENCE-ID;TZID=Europe/Berlin:20240117T100000",
+				"DTSTART;TZID=Europe/Berlin:20240117T150000",
+				"DTEND;TZID=Europe/Berlin:20240117T151500",
+			},
+			want: eventTimes{
+				ExchangeID:     "standup/20240117T090000Z",
+				StartTime:      utc(2024, 1, 17, 14, 0),
+				EndTime:        utc(2024, 1, 17, 14, 15),
+				TimeZone:       "Europe/Berlin",
+				SeriesMasterID: "standup",
+				OriginalStart:  utc(2024, 1, 17, 9, 0),
+			},
+		},
+		{
+			name: "all-day event without end",
+			event: []string{
+				"UID:1",
+				"DTSTART:20240304",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 3, 4, 0, 0), EndTime: utc(2024, 3, 5, 0, 0), IsAllDay: true},
+		},
+		{
+			name: "duration in weeks and days",
+			event: []string{
+				"UID:1",
+				"DTSTART;VALUE=DATE:20240304",
+				"DURATION:P1W2D",
+			},
+			want: eventTimes{ExchangeID: "1", StartTime: utc(2024, 3, 4, 0, 0), EndTime: utc(2024, 3, 13, 0, 0), IsAllDay: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := slices.Concat(tt.calendar, []string{"BEGIN:VEVENT"}, tt.event, []string{"END:VEVENT"})
+			events, skipped := decodeEvents(t, calendarData(lines...))
+			if len(skipped) > 0 {
+				t.Fatalf("skipped: %v", skipped[0])
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+
+			got := timesOf(events[0])
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+			if events[0].IsException != (tt.want.SeriesMasterID != "") {
+				t.Errorf("IsException = %v", events[0].IsException)
+			}
+		})
+	}
+}
+
+func TestDecodeProperties(t *testing.T) {
+	events, _ := decodeEvents(t, calendarData(
+		"BEGIN:VEVENT",
+		"UID:planning",
+		"DTSTART:20240115T100000Z",
+		`SUMMARY:Planning\; Q1\, draft`,
+		`DESCRIPTION:Agenda:\nbudget`,
+		"LOCATION:Room 1",
+		"STATUS:TENTATIVE",
+		"CLASS:CONFIDENTIAL",
+		"PRIORITY:9",
+		"ORGANIZER;CN=Boss:MAILTO:boss@example.com",
+		`ATTENDEE;CN="Petrov, Ivan";PARTSTAT=ACCEPTED:mailto:ivan@example.com`,
+		"ATTENDEE;PARTSTAT=DECLINED:mailto:anna@example.com",
+		"ATTENDEE:mailto:",
+		`CATEGORIES:Planning,Team\, backend`,
+		"CATEGORIES: ,Meetings",
+		"END:VEVENT",
+	))
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	e := events[0]
+
+	if e.Subject != "Planning; Q1, draft" || e.Body != "Agenda:\nbudget" || e.Location != "Room 1" {
+		t.Errorf("text = %q, %q, %q", e.Subject, e.Body, e.Location)
+	}
+	if e.Status != domain.EventStatusTentative || e.Sensitivity != domain.SensitivityConfidential || e.Importance != domain.ImportanceLow {
+		t.Errorf("status, sensitivity, importance = %q, %q, %q", e.Status, e.Sensitivity, e.Importance)
+	}
+	if e.Organizer != "boss@example.com" {
+		t.Errorf("organizer = %q", e.Organizer)
+	}
+
+	wantAttendees := []domain.Attendee{
+		{Email: "ivan@example.com", Name: "Petrov, Ivan", ResponseStatus: domain.ResponseStatusAccepted},
+		{Email: "anna@example.com", ResponseStatus: domain.ResponseStatusDeclined},
+	}
+	if !reflect.DeepEqual(e.Attendees, wantAttendees) {
+		t.Errorf("attendees = %+v, want %+v", e.Attendees, wantAttendees)
+	}
+	if want := []string{"Planning", "Team, backend", "Meetings"}; !slices.Equal(e.Categories, want) {
+		t.Errorf("categories = %q, want %q", e.Categories, want)
+	}
+}
+
+func TestDecodeWithoutUID(t *testing.T) {
+	data := calendarData(
+		"BEGIN:VEVENT",
+		"DTSTART:20240115T100000Z",
+		"SUMMARY:Standup",
+		"END:VEVENT",
+	)
+
+	first, _ := decodeEvents(t, data)
+	second, _ := decodeEvents(t, data)
+	if len(first) != 1 || first[0].ExchangeID == "" || first[0].ExchangeID != second[0].ExchangeID {
+		t.Errorf("events without UID are not identified by content: %q, %q", first[0].ExchangeID, second[0].ExchangeID)
+	}
+}
+
+func TestDecodeSkipsMalformedEvents(t *testing.T) {
+	events, skipped := decodeEvents(t, calendarData(
+		"BEGIN:VEVENT",
+		"UID:good",
+		"DTSTART:20240115T100000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:no-start",
+		"SUMMARY:Standup",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:bad-end",
+		"DTSTART:20240115T100000Z",
+		"DTEND:tomorrow",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:bad-duration",
+		"DTSTART:20240115T100000Z",
+		"DURATION:PT1X",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:bad-exdate",
+		"DTSTART:20240115T100000Z",
+		"RRULE:FREQ=DAILY",
+		"EXDATE:someday",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:bad-recurrence-id",
+		"DTSTART:20240115T100000Z",
+		"RECURRENCE-ID:yesterday",
+		"END:VEVENT",
+	))
+
+	if len(events) != 1 || events[0].ExchangeID != "good" {
+		t.Errorf("events = %+v, want only the good one", events)
+	}
+
+	var uids []string
+	for _, s := range skipped {
+		uids = append(uids, s.UID)
+
+		var eventErr *EventError
+		if !errors.As(error(s), &eventErr) || s.Unwrap() == nil {
+			t.Errorf("skipped event %q has no cause", s.UID)
+		}
+	}
+	if want := []string{"no-start", "bad-end", "bad-duration", "bad-exdate", "bad-recurrence-id"}; !slices.Equal(uids, want) {
+		t.Errorf("skipped = %q, want %q", uids, want)
+	}
+}
+
+func TestDecodeCalendarErrors(t *testing.T) {
+	event := calendarData("BEGIN:VEVENT", "UID:1", "DTSTART:20240115T100000Z", "END:VEVENT")
+
+	tests := []struct {
+		name    string
+		data    string
+		maxSize int64
+		wantErr bool
+	}{
+		{name: "at the size limit", data: event, maxSize: int64(len(event))},
+		{name: "over the size limit", data: event, maxSize: int64(len(event)) - 1, wantErr: true},
+		{name: "unterminated calendar", data: strings.TrimSuffix(event, "END:VCALENDAR\r\n"), maxSize: testMaxSize, wantErr: true},
+		{name: "malformed line", data: "BEGIN:VCALENDAR\r\nnonsense\r\nEND:VCALENDAR\r\n", maxSize: testMaxSize, wantErr: true},
+		{name: "empty", maxSize: testMaxSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewDecoder(strings.NewReader(tt.data), tt.maxSize).Decode()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standupStart := time.Date(2024, 3, 25, 10, 0, 0, 0, berlin)
+	excluded := standupStart.AddDate(0, 0, 8)
+	originalStart := standupStart.AddDate(0, 0, 9)
+	movedStart := originalStart.Add(5 * time.Hour)
+	holidayStart := time.Date(2024, 3, 4, 0, 0, 0, 0, moscow)
+	reviewStart := time.Date(2024, 7, 1, 18, 30, 0, 0, moscow)
+
+	events := []*domain.Event{
+		{
+			ExchangeID: "review-1",
+			Subject:    "Ревью; итоги, планы — " + strings.Repeat("длинное описание ", 5),
+			Body:       "Первая строка\nвторая строка\\",
+			Location:   "Переговорная «Москва»",
+			StartTime:  reviewStart.UTC(),
+			EndTime:    reviewStart.Add(90 * time.Minute).UTC(),
+			TimeZone:   "Russian Standard Time",
+			Attendees: []domain.Attendee{
+				{Email: "ivan@example.com", Name: "Петров, Иван", ResponseStatus: domain.ResponseStatusTentative},
+			},
+			Categories: []string{"Ревью", "Команда, бэкенд"},
+		},
+		{
+			// The series crosses the start of daylight saving time
+			ExchangeID: "standup-1",
+			Subject:    "Standup",
+			StartTime:  standupStart.UTC(),
+			EndTime:    standupStart.Add(15 * time.Minute).UTC(),
+			TimeZone:   "Europe/Berlin",
+			Recurrence: &domain.Recurrence{
+				Rule:          "FREQ=DAILY;COUNT=14",
+				ExcludedDates: []time.Time{excluded.UTC()},
+			},
+		},
+		{
+			ExchangeID:     "standup-1/" + formatUTC(originalStart),
+			Subject:        "Standup",
+			StartTime:      movedStart.UTC(),
+			EndTime:        movedStart.Add(15 * time.Minute).UTC(),
+			TimeZone:       "Europe/Berlin",
+			SeriesMasterID: "standup-1",
+			OriginalStart:  ptr(originalStart.UTC()),
+			IsException:    true,
+		},
+		{
+			ExchangeID: "holidays-1",
+			Subject:    "Праздники",
+			StartTime:  holidayStart.UTC(),
+			EndTime:    holidayStart.AddDate(0, 0, 1).UTC(),
+			IsAllDay:   true,
+			TimeZone:   "Europe/Moscow",
+			Recurrence: &domain.Recurrence{
+				Rule:          "FREQ=DAILY;COUNT=5",
+				ExcludedDates: []time.Time{holidayStart.AddDate(0, 0, 2).UTC()},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(events); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	decoded, skipped := decodeEvents(t, buf.String())
+	if len(skipped) > 0 {
+		t.Fatalf("skipped: %v", skipped[0])
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("decoded %d events, want %d", len(decoded), len(events))
+	}
+
+	for i, want := range events {
+		got := decoded[i]
+		t.Run(want.ExchangeID, func(t *testing.T) {
+			// Time zones are written with their IANA names. All-day dates are
+			// written without one and read back as floating dates.
+			wantTimes := timesOf(want)
+			wantTimes.TimeZone = recurrence.ZoneName(want.TimeZone)
+			if want.IsAllDay {
+				wantTimes = floatingDates(wantTimes)
+			}
+
+			if gotTimes := timesOf(got); !reflect.DeepEqual(gotTimes, wantTimes) {
+				t.Errorf("got  %+v\nwant %+v", gotTimes, wantTimes)
+			}
+			if got.Subject != want.Subject || got.Body != want.Body || got.Location != want.Location {
+				t.Errorf("text = %q, %q, %q, want %q, %q, %q", got.Subject, got.Body, got.Location, want.Subject, want.Body, want.Location)
+			}
+			if !slices.Equal(got.Categories, want.Categories) {
+				t.Errorf("categories = %q, want %q", got.Categories, want.Categories)
+			}
+			if !reflect.DeepEqual(got.Attendees, want.Attendees) {
+				t.Errorf("attendees = %+v, want %+v", got.Attendees, want.Attendees)
+			}
+			if got.IsException != want.IsException {
+				t.Errorf("IsException = %v, want %v", got.IsException, want.IsException)
+			}
+		})
+	}
+}
+
+// floatingDates returns the times of an all-day event as midnight UTC of
+// their dates in the event time zone.
+func floatingDates(times eventTimes) eventTimes {
+	loc, _ := recurrence.LoadLocation(times.TimeZone)
+	date := func(t time.Time) time.Time {
+		t = t.In(loc)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	times.TimeZone = ""
+	times.StartTime = date(times.StartTime)
+	times.EndTime = date(times.EndTime)
+	excluded := make([]time.Time, len(times.ExcludedDates))
+	for i, t := range times.ExcludedDates {
+		excluded[i] = date(t)
+	}
+	times.ExcludedDates = excluded
+	return times
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
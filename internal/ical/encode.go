@@ -0,0 +1,287 @@
+package ical
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+)
+
+// openSeriesYears is how far past the current date time zone definitions
+// extend for recurring series without an end.
+const openSeriesYears = 5
+
+// Encoder writes events as an iCalendar object.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes a VCALENDAR containing the events. Times are written in the
+// time zone each event was scheduled in, together with a VTIMEZONE for every
+// zone used. Series masters carry their RRULE and EXDATE, exceptions are
+// linked to the series by UID and RECURRENCE-ID.
+func (enc *Encoder) Encode(events []*domain.Event) error {
+	cw := newContentWriter(enc.w)
+
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", prodID)
+	cw.line("CALSCALE", "GREGORIAN")
+
+	for _, span := range zoneSpans(events) {
+		writeTimezone(cw, span)
+	}
+
+	for _, e := range events {
+		writeEvent(cw, e)
+	}
+
+	cw.line("END", "VCALENDAR")
+	return cw.flush()
+}
+
+func writeEvent(cw *contentWriter, e *domain.Event) {
+	loc, zoned := eventLocation(e)
+
+	cw.line("BEGIN", "VEVENT")
+	cw.line("UID", escapeText(uid(e)))
+	cw.line("DTSTAMP", formatUTC(stamp(e)))
+	writeTime(cw, "DTSTART", e.StartTime, e.IsAllDay, loc, zoned)
+	writeTime(cw, "DTEND", e.EndTime, e.IsAllDay, loc, zoned)
+
+	if e.IsSeriesMaster() {
+		cw.line("RRULE", e.Recurrence.Rule)
+		if len(e.Recurrence.ExcludedDates) > 0 {
+			writeTimes(cw, "EXDATE", e.Recurrence.ExcludedDates, e.IsAllDay, loc, zoned)
+		}
+	}
+	if e.SeriesMasterID != "" && e.OriginalStart != nil {
+		writeTime(cw, "RECURRENCE-ID", *e.OriginalStart, e.IsAllDay, loc, zoned)
+	}
+
+	cw.line("SUMMARY", escapeText(e.Subject))
+	if e.Body != "" {
+		cw.line("DESCRIPTION", escapeText(e.Body))
+	}
+	if e.Location != "" {
+		cw.line("LOCATION", escapeText(e.Location))
+	}
+
+	if e.Organizer != "" {
+		cw.line("ORGANIZER", "mailto:"+e.Organizer)
+	}
+	for _, a := range e.Attendees {
+		params := make([]string, 0, 3)
+		if a.Name != "" {
+			params = append(params, "CN="+paramValue(a.Name))
+		}
+		if a.ResponseStatus == domain.ResponseStatusOrganizer {
+			params = append(params, "ROLE=CHAIR")
+		} else {
+			params = append(params, "ROLE=REQ-PARTICIPANT")
+		}
+		params = append(params, "PARTSTAT="+partStat(a.ResponseStatus))
+		cw.line("ATTENDEE", "mailto:"+a.Email, params...)
+	}
+
+	if len(e.Categories) > 0 {
+		categories := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			categories[i] = escapeText(c)
+		}
+		cw.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	if class := classification(e.Sensitivity); class != "" {
+		cw.line("CLASS", class)
+	}
+	if priority := priority(e.Importance); priority != "" {
+		cw.line("PRIORITY", priority)
+	}
+	if status := status(e.Status); status != "" {
+		cw.line("STATUS", status)
+	}
+
+	if !e.CreatedAt.IsZero() {
+		cw.line("CREATED", formatUTC(e.CreatedAt))
+	}
+	if !e.UpdatedAt.IsZero() {
+		cw.line("LAST-MODIFIED", formatUTC(e.UpdatedAt))
+	}
+
+	cw.line("END", "VEVENT")
+}
+
+// writeTime writes a DATE value for all-day events, a local DATE-TIME with
+// TZID for events with a known time zone and a UTC DATE-TIME otherwise.
+func writeTime(cw *contentWriter, name string, t time.Time, allDay bool, loc *time.Location, zoned bool) {
+	writeTimes(cw, name, []time.Time{t}, allDay, loc, zoned)
+}
+
+// writeTimes writes a property with a comma-separated list of time values.
+func writeTimes(cw *contentWriter, name string, times []time.Time, allDay bool, loc *time.Location, zoned bool) {
+	values := make([]string, len(times))
+
+	switch {
+	case allDay:
+		for i, t := range times {
+			values[i] = t.In(loc).Format(dateFormat)
+		}
+		cw.line(name, strings.Join(values, ","), "VALUE=DATE")
+	case zoned:
+		for i, t := range times {
+			values[i] = t.In(loc).Format(localTimeFormat)
+		}
+		cw.line(name, strings.Join(values, ","), "TZID="+paramValue(loc.String()))
+	default:
+		for i, t := range times {
+			values[i] = formatUTC(t)
+		}
+		cw.line(name, strings.Join(values, ","))
+	}
+}
+
+// zoneSpans returns the time zones used by timed events, sorted by name,
+// with the period each definition has to cover.
+func zoneSpans(events []*domain.Event) []zoneSpan {
+	spans := make(map[string]*zoneSpan)
+
+	for _, e := range events {
+		loc, zoned := eventLocation(e)
+		if !zoned || e.IsAllDay {
+			continue
+		}
+
+		span, ok := spans[loc.String()]
+		if !ok {
+			span = &zoneSpan{loc: loc}
+			spans[loc.String()] = span
+		}
+
+		from, to := e.StartTime, e.EndTime
+		if e.OriginalStart != nil && e.OriginalStart.Before(from) {
+			from = *e.OriginalStart
+		}
+		if e.IsSeriesMaster() {
+			to = seriesEnd(e, loc, to)
+		}
+		span.extend(from, to)
+	}
+
+	result := make([]zoneSpan, 0, len(spans))
+	for _, span := range spans {
+		result = append(result, *span)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].loc.String() < result[j].loc.String()
+	})
+	return result
+}
+
+// seriesEnd returns the end of the last occurrence of a series master, or a
+// date openSeriesYears ahead for series without an end.
+func seriesEnd(e *domain.Event, loc *time.Location, fallback time.Time) time.Time {
+	series := recurrence.Series{Rule: e.Recurrence.Rule, Start: e.StartTime, Location: loc}
+
+	last, bounded, err := series.Last()
+	if err == nil && bounded {
+		return last.Add(e.EndTime.Sub(e.StartTime))
+	}
+
+	open := time.Now().AddDate(openSeriesYears, 0, 0)
+	if open.After(fallback) {
+		return open
+	}
+	return fallback
+}
+
+// eventLocation returns the time zone of the event. The second result is
+// false when the zone is unknown and times are written in UTC.
+func eventLocation(e *domain.Event) (*time.Location, bool) {
+	return recurrence.LoadLocation(e.TimeZone)
+}
+
+// uid returns the iCalendar UID of the event. Exceptions share the UID of
+// their series master.
+func uid(e *domain.Event) string {
+	switch {
+	case e.SeriesMasterID != "":
+		return e.SeriesMasterID
+	case e.ExchangeID != "":
+		return e.ExchangeID
+	default:
+		return e.ID.String()
+	}
+}
+
+// stamp returns DTSTAMP of the event: when its content last changed. SyncedAt
+// advances every sync cycle, so it is only used for events never updated.
+func stamp(e *domain.Event) time.Time {
+	switch {
+	case !e.UpdatedAt.IsZero():
+		return e.UpdatedAt
+	case e.SyncedAt != nil:
+		return *e.SyncedAt
+	default:
+		return time.Now()
+	}
+}
+
+// partStat maps an attendee response status to PARTSTAT.
+func partStat(responseStatus string) string {
+	switch responseStatus {
+	case domain.ResponseStatusOrganizer, domain.ResponseStatusAccepted:
+		return "ACCEPTED"
+	case domain.ResponseStatusTentative:
+		return "TENTATIVE"
+	case domain.ResponseStatusDeclined:
+		return "DECLINED"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// classification maps event sensitivity to CLASS.
+func classification(sensitivity string) string {
+	switch sensitivity {
+	case domain.SensitivityNormal:
+		return "PUBLIC"
+	case domain.SensitivityPersonal, domain.SensitivityPrivate:
+		return "PRIVATE"
+	case domain.SensitivityConfidential:
+		return "CONFIDENTIAL"
+	default:
+		return ""
+	}
+}
+
+// priority maps event importance to PRIORITY.
+func priority(importance string) string {
+	switch importance {
+	case domain.ImportanceHigh:
+		return "1"
+	case domain.ImportanceNormal:
+		return "5"
+	case domain.ImportanceLow:
+		return "9"
+	default:
+		return ""
+	}
+}
+
+// status maps event status to STATUS.
+func status(s string) string {
+	switch s {
+	case domain.EventStatusConfirmed, domain.EventStatusTentative, domain.EventStatusCancelled:
+		return strings.ToUpper(s)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,184 @@
+package ical
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+)
+
+// encodeLines encodes the events and returns the unfolded content lines.
+func encodeLines(t *testing.T, events ...*domain.Event) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(events); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	for _, line := range strings.SplitAfter(buf.String(), "\r\n") {
+		if line != "" && !strings.HasSuffix(line, "\r\n") {
+			t.Fatalf("line %q is not terminated by CRLF", line)
+		}
+		if len(strings.TrimSuffix(line, "\r\n")) > maxLineOctets {
+			t.Errorf("line %q is not folded", line)
+		}
+	}
+
+	return slices.DeleteFunc(unfold(buf.String()), func(line string) bool { return line == "" })
+}
+
+func TestEncode(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meetingStart := time.Date(2024, 1, 15, 10, 0, 0, 0, berlin)
+	meeting := &domain.Event{
+		ExchangeID:  "meeting-1",
+		Subject:     "Planning; Q1, draft",
+		Body:        "Agenda:\nbudget",
+		Location:    "Room 1",
+		StartTime:   meetingStart.UTC(),
+		EndTime:     meetingStart.Add(time.Hour).UTC(),
+		TimeZone:    "W. Europe Standard Time",
+		Organizer:   "boss@example.com",
+		Categories:  []string{"Planning", "Team, backend"},
+		Sensitivity: domain.SensitivityPrivate,
+		Importance:  domain.ImportanceHigh,
+		Status:      domain.EventStatusConfirmed,
+		UpdatedAt:   time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC),
+		Attendees: []domain.Attendee{
+			{Email: "boss@example.com", ResponseStatus: domain.ResponseStatusOrganizer},
+			{Email: "ivan@example.com", Name: "Petrov, Ivan", ResponseStatus: domain.ResponseStatusAccepted},
+			{Email: "anna@example.com", ResponseStatus: domain.ResponseStatusNone},
+		},
+	}
+
+	holidayStart := time.Date(2024, 3, 4, 0, 0, 0, 0, moscow)
+	holidays := &domain.Event{
+		ExchangeID: "holidays-1",
+		Subject:    "Holidays",
+		StartTime:  holidayStart.UTC(),
+		EndTime:    holidayStart.AddDate(0, 0, 1).UTC(),
+		IsAllDay:   true,
+		TimeZone:   "Europe/Moscow",
+		Recurrence: &domain.Recurrence{
+			Rule:          "FREQ=DAILY;COUNT=5",
+			ExcludedDates: []time.Time{holidayStart.AddDate(0, 0, 2).UTC()},
+		},
+	}
+
+	originalStart := time.Date(2024, 1, 17, 9, 0, 0, 0, time.UTC)
+	moved := &domain.Event{
+		ExchangeID:     "standup-1/20240117",
+		Subject:        "Standup",
+		StartTime:      originalStart.Add(2 * time.Hour),
+		EndTime:        originalStart.Add(2*time.Hour + 15*time.Minute),
+		TimeZone:       "Unknown/Zone",
+		SeriesMasterID: "standup-1",
+		OriginalStart:  &originalStart,
+		IsException:    true,
+	}
+
+	tests := []struct {
+		name      string
+		event     *domain.Event
+		wantLines []string
+		notLines  []string
+	}{
+		{
+			name:  "timed event in a time zone",
+			event: meeting,
+			wantLines: []string{
+				"UID:meeting-1",
+				"DTSTAMP:20240110T080000Z",
+				"DTSTART;TZID=Europe/Berlin:20240115T100000",
+				"DTEND;TZID=Europe/Berlin:20240115T110000",
+				`SUMMARY:Planning\; Q1\, draft`,
+				`DESCRIPTION:Agenda:\nbudget`,
+				"LOCATION:Room 1",
+				"ORGANIZER:mailto:boss@example.com",
+				"ATTENDEE;ROLE=CHAIR;PARTSTAT=ACCEPTED:mailto:boss@example.com",
+				`ATTENDEE;CN="Petrov, Ivan";ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:ivan@example.com`,
+				"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:anna@example.com",
+				`CATEGORIES:Planning,Team\, backend`,
+				"CLASS:PRIVATE",
+				"PRIORITY:1",
+				"STATUS:CONFIRMED",
+				"LAST-MODIFIED:20240110T080000Z",
+				"BEGIN:VTIMEZONE",
+				"TZID:Europe/Berlin",
+			},
+			notLines: []string{"CREATED"},
+		},
+		{
+			name:  "all-day series with an excluded date",
+			event: holidays,
+			wantLines: []string{
+				"UID:holidays-1",
+				"DTSTART;VALUE=DATE:20240304",
+				"DTEND;VALUE=DATE:20240305",
+				"RRULE:FREQ=DAILY;COUNT=5",
+				"EXDATE;VALUE=DATE:20240306",
+			},
+			// All-day dates need no time zone definition
+			notLines: []string{"BEGIN:VTIMEZONE", "RECURRENCE-ID"},
+		},
+		{
+			name:  "exception in an unknown time zone",
+			event: moved,
+			wantLines: []string{
+				"UID:standup-1",
+				"DTSTART:20240117T110000Z",
+				"DTEND:20240117T111500Z",
+				"RECURRENCE-ID:20240117T090000Z",
+			},
+			notLines: []string{"BEGIN:VTIMEZONE", "RRULE", "EXDATE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := encodeLines(t, tt.event)
+
+			if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+				t.Errorf("calendar is not enclosed in VCALENDAR: %q", lines)
+			}
+			for _, want := range tt.wantLines {
+				if !slices.Contains(lines, want) {
+					t.Errorf("missing line %q in\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+			for _, name := range tt.notLines {
+				if slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, name) }) {
+					t.Errorf("unexpected line %q in\n%s", name, strings.Join(lines, "\n"))
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeFoldsMultiByteText(t *testing.T) {
+	subject := strings.Repeat("Планирование спринта ", 10)
+	event := &domain.Event{
+		ExchangeID: "sprint-1",
+		Subject:    subject,
+		StartTime:  time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+
+	// encodeLines checks that every physical line is folded
+	lines := encodeLines(t, event)
+	if !slices.Contains(lines, "SUMMARY:"+subject) {
+		t.Errorf("subject does not survive folding:\n%s", strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,111 @@
+// Package ical converts events to and from iCalendar (RFC 5545) data.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar data.
+const ContentType = "text/calendar; charset=utf-8"
+
+// prodID identifies this product in generated calendars.
+const prodID = "-//anmaslov//calendar//EN"
+
+// maxLineOctets is the longest content line allowed before folding, excluding CRLF.
+const maxLineOctets = 75
+
+// iCalendar date and date-time value formats.
+const (
+	dateFormat        = "20060102"
+	localTimeFormat   = "20060102T150405"
+	utcDateTimeFormat = "20060102T150405Z"
+)
+
+// contentWriter writes folded content lines and keeps the first write error.
+type contentWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newContentWriter(w io.Writer) *contentWriter {
+	return &contentWriter{w: bufio.NewWriter(w)}
+}
+
+// line writes a content line "name[;params]:value", folding it at 75 octets.
+func (cw *contentWriter) line(name, value string, params ...string) {
+	if cw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, p := range params {
+		b.WriteByte(';')
+		b.WriteString(p)
+	}
+	b.WriteByte(':')
+	b.WriteString(value)
+
+	_, cw.err = cw.w.WriteString(fold(b.String()))
+}
+
+func (cw *contentWriter) flush() error {
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// fold splits a content line into lines of at most 75 octets terminated by
+// CRLF, continuation lines starting with a space. UTF-8 sequences are never split.
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts towards the continuation line length.
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// escapeText escapes a TEXT property value.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// paramValue quotes a parameter value if it contains separators. Double
+// quotes cannot be represented and are dropped.
+func paramValue(s string) string {
+	s = strings.ReplaceAll(s, `"`, "")
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// formatUTC formats t as a UTC DATE-TIME value.
+func formatUTC(t time.Time) string {
+	return t.UTC().Format(utcDateTimeFormat)
+}
@@ -0,0 +1,91 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "short line",
+			line: "SUMMARY:Standup",
+			want: "SUMMARY:Standup\r\n",
+		},
+		{
+			name: "exactly 75 octets",
+			line: strings.Repeat("a", 75),
+			want: strings.Repeat("a", 75) + "\r\n",
+		},
+		{
+			name: "continuation lines count the leading space",
+			line: strings.Repeat("a", 75+74+1),
+			want: strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n a\r\n",
+		},
+		{
+			// "я" takes two octets, the 75th octet is the middle of one
+			name: "multi-byte characters are not split",
+			line: "S" + strings.Repeat("я", 40),
+			want: "S" + strings.Repeat("я", 37) + "\r\n " + strings.Repeat("я", 3) + "\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fold(tt.line)
+			if got != tt.want {
+				t.Errorf("fold() = %q, want %q", got, tt.want)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(line) > maxLineOctets {
+					t.Errorf("line %q is %d octets long", line, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %q is not valid UTF-8", line)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Standup", want: "Standup"},
+		{in: `a\b`, want: `a\\b`},
+		{in: "Room 1; floor 2, east", want: `Room 1\; floor 2\, east`},
+		{in: "line1\r\nline2\nline3\rline4", want: `line1\nline2\nline3\nline4`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParamValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Ivan Petrov", want: "Ivan Petrov"},
+		{in: "Petrov, Ivan", want: `"Petrov, Ivan"`},
+		{in: "Europe/Moscow", want: "Europe/Moscow"},
+		{in: "Team: backend", want: `"Team: backend"`},
+		{in: `Ivan "the dev"`, want: "Ivan the dev"},
+	}
+
+	for _, tt := range tests {
+		if got := paramValue(tt.in); got != tt.want {
+			t.Errorf("paramValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
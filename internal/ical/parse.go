@@ -0,0 +1,209 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+)
+
+// property is a parsed content line. Names and parameter names are upper-cased.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func (p property) param(name string) string {
+	return p.params[name]
+}
+
+// component is a BEGIN/END block with its properties and nested components.
+type component struct {
+	name       string
+	properties []property
+	children   []*component
+}
+
+// get returns the first property with the name, or nil.
+func (c *component) get(name string) *property {
+	for i := range c.properties {
+		if c.properties[i].name == name {
+			return &c.properties[i]
+		}
+	}
+	return nil
+}
+
+// value returns the value of the first property with the name, or empty string.
+func (c *component) value(name string) string {
+	if p := c.get(name); p != nil {
+		return p.value
+	}
+	return ""
+}
+
+// all returns all properties with the name.
+func (c *component) all(name string) []property {
+	var result []property
+	for _, p := range c.properties {
+		if p.name == name {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// parseComponents parses iCalendar data into top-level components.
+func parseComponents(data string) ([]*component, error) {
+	var (
+		roots []*component
+		stack []*component
+	)
+
+	for n, line := range unfold(data) {
+		if line == "" {
+			continue
+		}
+
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch p.name {
+		case "BEGIN":
+			c := &component{name: strings.ToUpper(p.value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, c)
+			} else {
+				roots = append(roots, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].name != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, p.value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of a component", n+1, p.name)
+			}
+			c := stack[len(stack)-1]
+			c.properties = append(c.properties, p)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("component %s is not terminated", stack[len(stack)-1].name)
+	}
+
+	return roots, nil
+}
+
+// unfold joins folded lines and splits data into logical content lines.
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+	return strings.Split(data, "\n")
+}
+
+// parseLine parses a content line "name *(;param=value) : value".
+func parseLine(line string) (property, error) {
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return property{}, fmt.Errorf("malformed content line %q", line)
+	}
+
+	p := property{name: strings.ToUpper(line[:end])}
+	rest := line[end:]
+
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return property{}, fmt.Errorf("malformed parameter in %s", p.name)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		value, remaining, err := parseParamValue(rest)
+		if err != nil {
+			return property{}, fmt.Errorf("parameter %s of %s: %w", name, p.name, err)
+		}
+		rest = remaining
+
+		if p.params == nil {
+			p.params = make(map[string]string)
+		}
+		p.params[name] = value
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return property{}, fmt.Errorf("missing value of %s", p.name)
+	}
+	p.value = rest[1:]
+
+	return p, nil
+}
+
+// parseParamValue reads a possibly quoted, possibly multi-valued parameter
+// value and returns it together with the unread remainder of the line.
+func parseParamValue(s string) (string, string, error) {
+	var b strings.Builder
+	for {
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated quoted value")
+			}
+			b.WriteString(s[1 : end+1])
+			s = s[end+2:]
+		} else {
+			end := strings.IndexAny(s, ";:,")
+			if end < 0 {
+				return "", "", fmt.Errorf("missing value")
+			}
+			b.WriteString(s[:end])
+			s = s[end:]
+		}
+
+		if !strings.HasPrefix(s, ",") {
+			return b.String(), s, nil
+		}
+		b.WriteByte(',')
+		s = s[1:]
+	}
+}
+
+var textUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\;`, ";",
+	`\,`, ",",
+	`\n`, "\n",
+	`\N`, "\n",
+)
+
+// unescapeText decodes a TEXT property value.
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// splitText splits a multi-valued TEXT property on unescaped commas and decodes the values.
+func splitText(s string) []string {
+	var (
+		result []string
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			result = append(result, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(result, unescapeText(s[start:]))
+}
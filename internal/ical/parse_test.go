@@ -0,0 +1,215 @@
+package ical
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnfold(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "CRLF line endings",
+			data: "BEGIN:VEVENT\r\nSUMMARY:Standup\r\nEND:VEVENT\r\n",
+			want: []string{"BEGIN:VEVENT", "SUMMARY:Standup", "END:VEVENT", ""},
+		},
+		{
+			name: "bare LF line endings",
+			data: "BEGIN:VEVENT\nEND:VEVENT",
+			want: []string{"BEGIN:VEVENT", "END:VEVENT"},
+		},
+		{
+			name: "space and tab continuations",
+			data: "DESCRIPTION:first\r\n  second\r\n\t third\r\n",
+			want: []string{"DESCRIPTION:first second third", ""},
+		},
+		{
+			// The fold splits the two octets of "П"
+			name: "fold inside a multi-byte character",
+			data: "SUMMARY:\xd0\r\n \x9fланирование\r\n",
+			want: []string{"SUMMARY:Планирование", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unfold(tt.data); !slices.Equal(got, tt.want) {
+				t.Errorf("unfold() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnfoldReversesFold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("Ёлка, ель; 🎄 ", 20)
+	if got := unfold(fold(line)); !slices.Equal(got, []string{line, ""}) {
+		t.Errorf("unfold(fold()) = %q, want %q", got, line)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    property
+		wantErr bool
+	}{
+		{
+			name: "value only",
+			line: "SUMMARY:Standup: daily",
+			want: property{name: "SUMMARY", value: "Standup: daily"},
+		},
+		{
+			name: "names are upper-cased",
+			line: "dtStart;tzid=Europe/Moscow:20240115T100000",
+			want: property{name: "DTSTART", params: map[string]string{"TZID": "Europe/Moscow"}, value: "20240115T100000"},
+		},
+		{
+			name: "several parameters",
+			line: "ATTENDEE;CN=Ivan;PARTSTAT=ACCEPTED:mailto:ivan@example.com",
+			want: property{
+				name:   "ATTENDEE",
+				params: map[string]string{"CN": "Ivan", "PARTSTAT": "ACCEPTED"},
+				value:  "mailto:ivan@example.com",
+			},
+		},
+		{
+			name: "quoted parameter with separators",
+			line: `ATTENDEE;CN="Petrov, Ivan; dev: backend":mailto:ivan@example.com`,
+			want: property{
+				name:   "ATTENDEE",
+				params: map[string]string{"CN": "Petrov, Ivan; dev: backend"},
+				value:  "mailto:ivan@example.com",
+			},
+		},
+		{
+			name: "multi-valued parameter",
+			line: `ATTENDEE;MEMBER="mailto:a@example.com","mailto:b@example.com";CUTYPE=GROUP:mailto:c@example.com`,
+			want: property{
+				name:   "ATTENDEE",
+				params: map[string]string{"MEMBER": "mailto:a@example.com,mailto:b@example.com", "CUTYPE": "GROUP"},
+				value:  "mailto:c@example.com",
+			},
+		},
+		{
+			name: "empty value",
+			line: "DESCRIPTION:",
+			want: property{name: "DESCRIPTION"},
+		},
+		{name: "missing colon", line: "SUMMARY", wantErr: true},
+		{name: "missing name", line: ":Standup", wantErr: true},
+		{name: "parameter without name", line: "DTSTART;=Europe/Moscow:20240115T100000", wantErr: true},
+		{name: "unterminated quote", line: `ATTENDEE;CN="Ivan:mailto:ivan@example.com`, wantErr: true},
+		{name: "parameter without value", line: "DTSTART;TZID=Europe/Moscow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseComponents(t *testing.T) {
+	roots, err := parseComponents(strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:vevent",
+		"UID:1",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"END:VALARM",
+		"END:VEVENT",
+		"",
+		"END:VCALENDAR",
+	}, "\r\n"))
+	if err != nil {
+		t.Fatalf("parseComponents: %v", err)
+	}
+
+	if len(roots) != 1 || roots[0].name != "VCALENDAR" || roots[0].value("VERSION") != "2.0" {
+		t.Fatalf("roots = %+v, want one VCALENDAR", roots)
+	}
+	events := roots[0].children
+	if len(events) != 1 || events[0].name != "VEVENT" || events[0].value("UID") != "1" {
+		t.Fatalf("children = %+v, want one VEVENT", events)
+	}
+	if alarms := events[0].children; len(alarms) != 1 || alarms[0].name != "VALARM" {
+		t.Errorf("VEVENT children = %+v, want one VALARM", alarms)
+	}
+	if events[0].get("ACTION") != nil {
+		t.Error("property of a nested component is added to its parent")
+	}
+}
+
+func TestParseComponentsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "unexpected END", data: "BEGIN:VCALENDAR\r\nEND:VEVENT\r\n"},
+		{name: "END without BEGIN", data: "END:VCALENDAR\r\n"},
+		{name: "property outside of a component", data: "VERSION:2.0\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"},
+		{name: "unterminated component", data: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VEVENT\r\n"},
+		{name: "malformed line", data: "BEGIN:VCALENDAR\r\nnonsense\r\nEND:VCALENDAR\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseComponents(tt.data); err == nil {
+				t.Error("parseComponents succeeded")
+			}
+		})
+	}
+}
+
+func TestUnescapeText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Standup", want: "Standup"},
+		{in: `a\\b`, want: `a\b`},
+		{in: `Room 1\; floor 2\, east`, want: "Room 1; floor 2, east"},
+		{in: `line1\nline2\Nline3`, want: "line1\nline2\nline3"},
+		{in: `\\n`, want: `\n`},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeText(tt.in); got != tt.want {
+			t.Errorf("unescapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := unescapeText(escapeText(tt.want)); got != tt.want {
+			t.Errorf("unescapeText(escapeText(%q)) = %q", tt.want, got)
+		}
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "Planning", want: []string{"Planning"}},
+		{in: "Planning,Meetings", want: []string{"Planning", "Meetings"}},
+		{in: `Team\, backend,R\\D,`, want: []string{"Team, backend", `R\D`, ""}},
+		{in: "", want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		if got := splitText(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
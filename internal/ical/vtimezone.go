@@ -0,0 +1,294 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"github.com/teambition/rrule-go"
+)
+
+// zoneSpan is the period a VTIMEZONE definition has to cover.
+type zoneSpan struct {
+	loc  *time.Location
+	from time.Time
+	to   time.Time
+}
+
+// extend widens the span to include [from, to].
+func (s *zoneSpan) extend(from, to time.Time) {
+	if s.from.IsZero() || from.Before(s.from) {
+		s.from = from
+	}
+	if to.After(s.to) {
+		s.to = to
+	}
+}
+
+// writeTimezone writes a VTIMEZONE listing the observance in effect at the
+// start of the span and every UTC offset change within it. Transitions are
+// written as individual observances rather than rules, so any zone known to
+// the Go time zone database can be described.
+func writeTimezone(cw *contentWriter, span zoneSpan) {
+	from, to := span.from.Truncate(time.Second), span.to.Truncate(time.Second)
+
+	cw.line("BEGIN", "VTIMEZONE")
+	cw.line("TZID", span.loc.String())
+
+	start := from.In(span.loc)
+	name, offset := start.Zone()
+	writeObservance(cw, start.IsDST(), start.Format(localTimeFormat), name, offset, offset)
+
+	for _, t := range transitions(span.loc, from, to) {
+		local := t.In(span.loc)
+		name, next := local.Zone()
+		// Observance start is the local time before the change.
+		onset := t.UTC().Add(time.Duration(offset) * time.Second).Format(localTimeFormat)
+		writeObservance(cw, local.IsDST(), onset, name, offset, next)
+		offset = next
+	}
+
+	cw.line("END", "VTIMEZONE")
+}
+
+func writeObservance(cw *contentWriter, dst bool, start, name string, offsetFrom, offsetTo int) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+
+	cw.line("BEGIN", kind)
+	cw.line("DTSTART", start)
+	cw.line("TZOFFSETFROM", formatOffset(offsetFrom))
+	cw.line("TZOFFSETTO", formatOffset(offsetTo))
+	if name != "" {
+		cw.line("TZNAME", escapeText(name))
+	}
+	cw.line("END", kind)
+}
+
+// transitions returns instants within (from, to] at which the UTC offset of
+// loc changes. The range is scanned a day at a time and each change is
+// narrowed down to the second, so from and to must be whole seconds.
+func transitions(loc *time.Location, from, to time.Time) []time.Time {
+	var result []time.Time
+	_, offset := from.In(loc).Zone()
+
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if next.After(to) {
+			next = to
+		}
+
+		if _, nextOffset := next.In(loc).Zone(); nextOffset != offset {
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+				if _, o := mid.In(loc).Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			result = append(result, hi)
+			offset = nextOffset
+		}
+
+		t = next
+	}
+
+	return result
+}
+
+// formatOffset formats a UTC offset in seconds as "+HHMM" or "+HHMMSS".
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	h, m, s := seconds/3600, seconds/60%60, seconds%60
+	if s != 0 {
+		return fmt.Sprintf("%c%02d%02d%02d", sign, h, m, s)
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, h, m)
+}
+
+// timeZone resolves local times of a TZID. Zones known to the time zone
+// database are used directly; other zones are evaluated from the observances
+// of their VTIMEZONE definition.
+type timeZone struct {
+	// name is the IANA name of the zone, empty if it is unknown.
+	name        string
+	loc         *time.Location
+	observances []observance
+}
+
+// observance is a STANDARD or DAYLIGHT block of a VTIMEZONE.
+type observance struct {
+	// onsets are local times at which the observance takes effect, written as UTC wall clock.
+	onsets     []time.Time
+	rule       *rrule.RRule
+	offsetFrom int
+	offsetTo   int
+}
+
+// utcZone is used for DATE-TIME values in UTC and when no zone is given.
+var utcZone = &timeZone{loc: time.UTC}
+
+// instant converts a wall clock time, written as UTC, to the instant it denotes in the zone.
+func (z *timeZone) instant(wall time.Time) time.Time {
+	if z.loc != nil {
+		return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, z.loc)
+	}
+	return wall.Add(-time.Duration(z.offsetAt(wall)) * time.Second).UTC()
+}
+
+// location returns the Go location of the zone, or a fixed zone with the
+// offset in effect at wall for zones known only from VTIMEZONE.
+func (z *timeZone) location(wall time.Time) *time.Location {
+	if z.loc != nil {
+		return z.loc
+	}
+	return time.FixedZone("", z.offsetAt(wall))
+}
+
+// offsetAt returns the UTC offset of the observance with the latest onset not after wall.
+func (z *timeZone) offsetAt(wall time.Time) int {
+	var (
+		latest time.Time
+		offset int
+		found  bool
+	)
+
+	for _, o := range z.observances {
+		for _, onset := range o.onsets {
+			if !onset.After(wall) && (!found || onset.After(latest)) {
+				latest, offset, found = onset, o.offsetTo, true
+			}
+		}
+		if o.rule != nil {
+			if onset := o.rule.Before(wall, true); !onset.IsZero() && (!found || onset.After(latest)) {
+				latest, offset, found = onset, o.offsetTo, true
+			}
+		}
+	}
+
+	if !found && len(z.observances) > 0 {
+		return z.observances[0].offsetFrom
+	}
+	return offset
+}
+
+// resolveZone returns the zone for a TZID, using the VTIMEZONE definitions
+// of the calendar when the TZID is not a known zone name. It returns nil if
+// the zone cannot be resolved.
+func resolveZone(tzid string, definitions map[string]*component) *timeZone {
+	if name := zoneName(tzid); name != "" {
+		loc, _ := recurrence.LoadLocation(name)
+		return &timeZone{name: name, loc: loc}
+	}
+
+	definition, ok := definitions[tzid]
+	if !ok {
+		return nil
+	}
+
+	zone := &timeZone{}
+	for _, c := range definition.children {
+		if c.name != "STANDARD" && c.name != "DAYLIGHT" {
+			continue
+		}
+
+		o, err := parseObservance(c)
+		if err != nil {
+			continue
+		}
+		zone.observances = append(zone.observances, o)
+	}
+
+	if len(zone.observances) == 0 {
+		return nil
+	}
+	return zone
+}
+
+// zoneName returns the IANA name for a TZID. Besides IANA and Windows names
+// it accepts TZIDs with a vendor prefix such as "/citadel.org/20070227_1/Europe/Moscow".
+func zoneName(tzid string) string {
+	if name := recurrence.ZoneName(tzid); name != "" {
+		return name
+	}
+
+	parts := strings.Split(strings.Trim(tzid, "/"), "/")
+	for n := 3; n >= 2; n-- {
+		if len(parts) > n {
+			if name := recurrence.ZoneName(strings.Join(parts[len(parts)-n:], "/")); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func parseObservance(c *component) (observance, error) {
+	var o observance
+
+	start, err := time.Parse(localTimeFormat, c.value("DTSTART"))
+	if err != nil {
+		return o, fmt.Errorf("invalid observance start: %w", err)
+	}
+	o.onsets = append(o.onsets, start)
+
+	if o.offsetFrom, err = parseOffset(c.value("TZOFFSETFROM")); err != nil {
+		return o, err
+	}
+	if o.offsetTo, err = parseOffset(c.value("TZOFFSETTO")); err != nil {
+		return o, err
+	}
+
+	if rule := c.value("RRULE"); rule != "" {
+		option, err := rrule.StrToROption(rule)
+		if err != nil {
+			return o, fmt.Errorf("invalid observance rule: %w", err)
+		}
+		option.Dtstart = start
+		if o.rule, err = rrule.NewRRule(*option); err != nil {
+			return o, fmt.Errorf("invalid observance rule: %w", err)
+		}
+	}
+
+	for _, p := range c.all("RDATE") {
+		for _, v := range strings.Split(p.value, ",") {
+			if t, err := time.Parse(localTimeFormat, strings.TrimSuffix(v, "Z")); err == nil {
+				o.onsets = append(o.onsets, t)
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// parseOffset parses a UTC offset "+HHMM" or "+HHMMSS" into seconds.
+func parseOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+
+	var h, m, sec int
+	if _, err := fmt.Sscanf(s[1:5], "%02d%02d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	if len(s) == 7 {
+		if _, err := fmt.Sscanf(s[5:], "%02d", &sec); err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", s)
+		}
+	}
+
+	offset := h*3600 + m*60 + sec
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
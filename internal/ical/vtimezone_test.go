@@ -0,0 +1,251 @@
+package ical
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		zone string
+		want []time.Time
+	}{
+		{
+			zone: "America/New_York",
+			want: []time.Time{
+				time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+				time.Date(2024, 11, 3, 6, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			zone: "Australia/Sydney",
+			want: []time.Time{
+				time.Date(2024, 4, 6, 16, 0, 0, 0, time.UTC),
+				time.Date(2024, 10, 5, 16, 0, 0, 0, time.UTC),
+			},
+		},
+		{zone: "Europe/Moscow"},
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := transitions(loc, from, to)
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("transitions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cw := newContentWriter(&buf)
+	writeTimezone(cw, zoneSpan{
+		loc:  berlin,
+		from: time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC),
+		to:   time.Date(2024, 12, 31, 9, 0, 0, 0, time.UTC),
+	})
+	if err := cw.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"BEGIN:STANDARD",
+		"DTSTART:20240115T100000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0100",
+		"TZNAME:CET",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20240331T020000",
+		"TZOFFSETFROM:+0100",
+		"TZOFFSETTO:+0200",
+		"TZNAME:CEST",
+		"END:DAYLIGHT",
+		"BEGIN:STANDARD",
+		"DTSTART:20241027T030000",
+		"TZOFFSETFROM:+0200",
+		"TZOFFSETTO:+0100",
+		"TZNAME:CET",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+	}
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n"); !slices.Equal(got, want) {
+		t.Errorf("writeTimezone() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{seconds: 0, want: "+0000"},
+		{seconds: 3 * 3600, want: "+0300"},
+		{seconds: 5*3600 + 30*60, want: "+0530"},
+		{seconds: -5 * 3600, want: "-0500"},
+		{seconds: -(3*3600 + 30*60), want: "-0330"},
+		// Local mean time of Europe/Moscow before 1880
+		{seconds: 2*3600 + 30*60 + 17, want: "+023017"},
+	}
+
+	for _, tt := range tests {
+		if got := formatOffset(tt.seconds); got != tt.want {
+			t.Errorf("formatOffset(%d) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestResolveGeneratedTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	cw := newContentWriter(&buf)
+	writeTimezone(cw, zoneSpan{
+		loc:  berlin,
+		from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		to:   time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+	if err := cw.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Under a TZID unknown to the time zone database the observances are used
+	data := strings.Replace(buf.String(), "TZID:Europe/Berlin", "TZID:Berlin (exported)", 1)
+	roots, err := parseComponents(data)
+	if err != nil {
+		t.Fatalf("parseComponents: %v", err)
+	}
+	zone := resolveZone("Berlin (exported)", map[string]*component{"Berlin (exported)": roots[0]})
+	if zone == nil || zone.loc != nil {
+		t.Fatalf("resolveZone() = %+v, want a zone defined by observances", zone)
+	}
+
+	for _, wall := range []time.Time{
+		time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 1, 59, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 3, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 27, 3, 0, 0, 0, time.UTC),
+		time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		want := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, berlin)
+		if got := zone.instant(wall); !got.Equal(want) {
+			t.Errorf("instant(%s) = %v, want %v", wall.Format(localTimeFormat), got.UTC(), want.UTC())
+		}
+	}
+}
+
+func TestResolveZone(t *testing.T) {
+	definitions := map[string]*component{
+		"Custom": {
+			name: "VTIMEZONE",
+			children: []*component{
+				{name: "STANDARD", properties: []property{
+					{name: "DTSTART", value: "19700101T000000"},
+					{name: "TZOFFSETFROM", value: "+0530"},
+					{name: "TZOFFSETTO", value: "+0530"},
+				}},
+			},
+		},
+		"Broken": {
+			name: "VTIMEZONE",
+			children: []*component{
+				{name: "STANDARD", properties: []property{
+					{name: "DTSTART", value: "19700101T000000"},
+					{name: "TZOFFSETFROM", value: "+5"},
+					{name: "TZOFFSETTO", value: "+0530"},
+				}},
+			},
+		},
+	}
+
+	tests := []struct {
+		tzid       string
+		wantName   string
+		wantOffset int
+		wantNil    bool
+	}{
+		{tzid: "Europe/Moscow", wantName: "Europe/Moscow", wantOffset: 3 * 3600},
+		{tzid: "Russian Standard Time", wantName: "Europe/Moscow", wantOffset: 3 * 3600},
+		{tzid: "/citadel.org/20070227_1/America/New_York", wantName: "America/New_York", wantOffset: -5 * 3600},
+		{tzid: "/mozilla.org/20050126_1/America/Argentina/Buenos_Aires", wantName: "America/Argentina/Buenos_Aires", wantOffset: -3 * 3600},
+		{tzid: "Custom", wantOffset: 5*3600 + 30*60},
+		{tzid: "Broken", wantNil: true},
+		{tzid: "Undefined", wantNil: true},
+	}
+
+	wall := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.tzid, func(t *testing.T) {
+			zone := resolveZone(tt.tzid, definitions)
+			if tt.wantNil {
+				if zone != nil {
+					t.Errorf("resolveZone() = %+v, want nil", zone)
+				}
+				return
+			}
+			if zone == nil {
+				t.Fatal("resolveZone() = nil")
+			}
+
+			_, offset := wall.In(zone.location(wall)).Zone()
+			if zone.name != tt.wantName || offset != tt.wantOffset {
+				t.Errorf("resolveZone() = %q with offset %d, want %q with offset %d", zone.name, offset, tt.wantName, tt.wantOffset)
+			}
+			if got, want := zone.instant(wall), wall.Add(-time.Duration(tt.wantOffset)*time.Second); !got.Equal(want) {
+				t.Errorf("instant() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int
+		wantErr bool
+	}{
+		{s: "+0000", want: 0},
+		{s: "+0300", want: 3 * 3600},
+		{s: "-0500", want: -5 * 3600},
+		{s: "+0530", want: 5*3600 + 30*60},
+		{s: "+023017", want: 2*3600 + 30*60 + 17},
+		{s: "0300", wantErr: true},
+		{s: "+3", wantErr: true},
+		{s: "+03:00", wantErr: true},
+		{s: "+03xx", wantErr: true},
+		{s: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseOffset(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseOffset(%q) = %d, %v, want %d, wantErr %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+		if err == nil && formatOffset(got) != tt.s {
+			t.Errorf("formatOffset(parseOffset(%q)) = %q", tt.s, formatOffset(got))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package recurrence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// Series describes a recurring series anchored at its first occurrence.
+type Series struct {
+	// Rule is an RFC 5545 RRULE value, e.g. "FREQ=WEEKLY;BYDAY=MO,WE".
+	Rule string
+	// Start is the start of the first occurrence.
+	Start time.Time
+	// Location is the time zone the rule is evaluated in, UTC if nil.
+	Location *time.Location
+	// ExcludedDates are original start times of occurrences removed from the series.
+	ExcludedDates []time.Time
+}
+
+// Validate checks that rule is a valid RRULE value.
+func Validate(rule string) error {
+	if _, err := rrule.StrToROption(rule); err != nil {
+		return fmt.Errorf("invalid recurrence rule %q: %w", rule, err)
+	}
+	return nil
+}
+
+// Between returns start times of occurrences starting within [from, to).
+func (s Series) Between(from, to time.Time) ([]time.Time, error) {
+	set, err := s.set()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []time.Time
+	for _, t := range set.Between(from, to, true) {
+		if t.Before(to) {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// Last returns the start of the last occurrence. The second result is false
+// for series without COUNT or UNTIL, which never end.
+func (s Series) Last() (time.Time, bool, error) {
+	option, err := rrule.StrToROptionInLocation(s.Rule, s.location())
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid recurrence rule %q: %w", s.Rule, err)
+	}
+	if option.Count == 0 && option.Until.IsZero() {
+		return time.Time{}, false, nil
+	}
+
+	set, err := s.set()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	all := set.All()
+	if len(all) == 0 {
+		return s.Start, true, nil
+	}
+	return all[len(all)-1], true, nil
+}
+
+func (s Series) set() (*rrule.Set, error) {
+	loc := s.location()
+
+	option, err := rrule.StrToROptionInLocation(s.Rule, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule %q: %w", s.Rule, err)
+	}
+	option.Dtstart = s.Start.In(loc)
+
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recurrence rule %q: %w", s.Rule, err)
+	}
+
+	set := &rrule.Set{}
+	set.RRule(r)
+	for _, d := range s.ExcludedDates {
+		set.ExDate(d.In(loc))
+	}
+	return set, nil
+}
+
+func (s Series) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
@@ -0,0 +1,158 @@
+package recurrence
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{rule: "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{rule: "FREQ=DAILY;COUNT=5"},
+		{rule: "FREQ=MONTHLY;UNTIL=20241231T000000Z"},
+		{rule: "", wantErr: true},
+		{rule: "FREQ=SOMETIMES", wantErr: true},
+		{rule: "BYDAY=MO", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := Validate(tt.rule); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSeriesBetween(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monday := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		series Series
+		from   time.Time
+		to     time.Time
+		want   []time.Time
+	}{
+		{
+			name:   "daily with an excluded date",
+			series: Series{Rule: "FREQ=DAILY", Start: monday, ExcludedDates: []time.Time{monday.AddDate(0, 0, 1)}},
+			from:   monday,
+			to:     monday.AddDate(0, 0, 3),
+			want:   []time.Time{monday, monday.AddDate(0, 0, 2)},
+		},
+		{
+			name:   "end of the range is exclusive",
+			series: Series{Rule: "FREQ=DAILY", Start: monday},
+			from:   monday.AddDate(0, 0, 1),
+			to:     monday.AddDate(0, 0, 2),
+			want:   []time.Time{monday.AddDate(0, 0, 1)},
+		},
+		{
+			name:   "count limits the series",
+			series: Series{Rule: "FREQ=WEEKLY;COUNT=2", Start: monday},
+			from:   monday,
+			to:     monday.AddDate(0, 1, 0),
+			want:   []time.Time{monday, monday.AddDate(0, 0, 7)},
+		},
+		{
+			name:   "by day",
+			series: Series{Rule: "FREQ=WEEKLY;BYDAY=MO,WE", Start: monday},
+			from:   monday,
+			to:     monday.AddDate(0, 0, 7),
+			want:   []time.Time{monday, monday.AddDate(0, 0, 2)},
+		},
+		{
+			// 10:00 in Berlin is 09:00 UTC in winter and 08:00 UTC in summer
+			name: "local time is kept across a DST change",
+			series: Series{
+				Rule:     "FREQ=WEEKLY",
+				Start:    time.Date(2024, 3, 25, 10, 0, 0, 0, berlin),
+				Location: berlin,
+			},
+			from: time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2024, 3, 25, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.series.Between(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Between: %v", err)
+			}
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("Between() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriesLast(t *testing.T) {
+	start := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		series      Series
+		want        time.Time
+		wantBounded bool
+		wantErr     bool
+	}{
+		{
+			name:        "count",
+			series:      Series{Rule: "FREQ=DAILY;COUNT=3", Start: start},
+			want:        start.AddDate(0, 0, 2),
+			wantBounded: true,
+		},
+		{
+			name:        "until",
+			series:      Series{Rule: "FREQ=WEEKLY;UNTIL=20240205T090000Z", Start: start},
+			want:        start.AddDate(0, 0, 21),
+			wantBounded: true,
+		},
+		{
+			name:        "last occurrence excluded",
+			series:      Series{Rule: "FREQ=DAILY;COUNT=3", Start: start, ExcludedDates: []time.Time{start.AddDate(0, 0, 2)}},
+			want:        start.AddDate(0, 0, 1),
+			wantBounded: true,
+		},
+		{
+			name:        "every occurrence excluded",
+			series:      Series{Rule: "FREQ=DAILY;COUNT=1", Start: start, ExcludedDates: []time.Time{start}},
+			want:        start,
+			wantBounded: true,
+		},
+		{
+			name:   "open series",
+			series: Series{Rule: "FREQ=DAILY", Start: start},
+		},
+		{
+			name:    "invalid rule",
+			series:  Series{Rule: "FREQ=SOMETIMES", Start: start},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bounded, err := tt.series.Last()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Last() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bounded != tt.wantBounded || !got.Equal(tt.want) {
+				t.Errorf("Last() = %v, %v, want %v, %v", got, bounded, tt.want, tt.wantBounded)
+			}
+		})
+	}
+}
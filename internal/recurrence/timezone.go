@@ -0,0 +1,109 @@
+package recurrence
+
+import "time"
+
+// windowsZones maps common Windows time zone IDs, as used by Exchange and
+// Outlook, to IANA names.
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"Mountain Standard Time":          "America/Denver",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Central Standard Time":           "America/Chicago",
+	"Eastern Standard Time":           "America/New_York",
+	"Atlantic Standard Time":          "America/Halifax",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"UTC":                             "Etc/UTC",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"Romance Standard Time":           "Europe/Paris",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"FLE Standard Time":               "Europe/Kiev",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"Kaliningrad Standard Time":       "Europe/Kaliningrad",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Belarus Standard Time":           "Europe/Minsk",
+	"Russian Standard Time":           "Europe/Moscow",
+	"Arabic Standard Time":            "Asia/Baghdad",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Russia Time Zone 3":              "Europe/Samara",
+	"Caucasus Standard Time":          "Asia/Yerevan",
+	"Azerbaijan Standard Time":        "Asia/Baku",
+	"Georgian Standard Time":          "Asia/Tbilisi",
+	"Ekaterinburg Standard Time":      "Asia/Yekaterinburg",
+	"West Asia Standard Time":         "Asia/Tashkent",
+	"Pakistan Standard Time":          "Asia/Karachi",
+	"India Standard Time":             "Asia/Kolkata",
+	"Central Asia Standard Time":      "Asia/Almaty",
+	"Omsk Standard Time":              "Asia/Omsk",
+	"N. Central Asia Standard Time":   "Asia/Novosibirsk",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"North Asia Standard Time":        "Asia/Krasnoyarsk",
+	"China Standard Time":             "Asia/Shanghai",
+	"North Asia East Standard Time":   "Asia/Irkutsk",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Yakutsk Standard Time":           "Asia/Yakutsk",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"Vladivostok Standard Time":       "Asia/Vladivostok",
+	"Magadan Standard Time":           "Asia/Magadan",
+	"Russia Time Zone 11":             "Asia/Kamchatka",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"Central Pacific Standard Time":   "Pacific/Guadalcanal",
+	"Canada Central Standard Time":    "America/Regina",
+	"Mexico Standard Time":            "America/Mexico_City",
+	"Central America Standard Time":   "America/Guatemala",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Argentina Standard Time":         "America/Buenos_Aires",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+	"E. Africa Standard Time":         "Africa/Nairobi",
+}
+
+// LoadLocation resolves an IANA or Windows time zone name. The second result
+// is false when the name is unknown, in which case UTC is returned.
+func LoadLocation(name string) (*time.Location, bool) {
+	if name == "" {
+		return time.UTC, false
+	}
+	if iana, ok := windowsZones[name]; ok {
+		name = iana
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, false
+	}
+	return loc, true
+}
+
+// ZoneName returns the IANA name for an IANA or Windows time zone name, or
+// empty string if it is unknown.
+func ZoneName(name string) string {
+	loc, ok := LoadLocation(name)
+	if !ok {
+		return ""
+	}
+	return loc.String()
+}
+
+// WindowsZoneName returns the Windows time zone ID for an IANA or Windows
+// time zone name, or empty string if it has no known Windows equivalent.
+func WindowsZoneName(name string) string {
+	if _, ok := windowsZones[name]; ok {
+		return name
+	}
+	for windows, iana := range windowsZones {
+		if iana == name {
+			return windows
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package recurrence
+
+import "testing"
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantName  string
+		wantKnown bool
+	}{
+		{name: "Europe/Moscow", wantName: "Europe/Moscow", wantKnown: true},
+		{name: "Russian Standard Time", wantName: "Europe/Moscow", wantKnown: true},
+		{name: "W. Europe Standard Time", wantName: "Europe/Berlin", wantKnown: true},
+		{name: "UTC", wantName: "Etc/UTC", wantKnown: true},
+		{name: "", wantName: "UTC"},
+		{name: "Mars Standard Time", wantName: "UTC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, known := LoadLocation(tt.name)
+			if loc.String() != tt.wantName || known != tt.wantKnown {
+				t.Errorf("LoadLocation(%q) = %s, %v, want %s, %v", tt.name, loc, known, tt.wantName, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestZoneName(t *testing.T) {
+	tests := map[string]string{
+		"Asia/Tokyo":            "Asia/Tokyo",
+		"Tokyo Standard Time":   "Asia/Tokyo",
+		"Pacific Standard Time": "America/Los_Angeles",
+		"Mars Standard Time":    "",
+		"":                      "",
+	}
+
+	for name, want := range tests {
+		if got := ZoneName(name); got != want {
+			t.Errorf("ZoneName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWindowsZoneName(t *testing.T) {
+	tests := map[string]string{
+		"Europe/Moscow":         "Russian Standard Time",
+		"Russian Standard Time": "Russian Standard Time",
+		"America/New_York":      "Eastern Standard Time",
+		"Europe/Vilnius":        "",
+		"Mars Standard Time":    "",
+	}
+
+	for name, want := range tests {
+		if got := WindowsZoneName(name); got != want {
+			t.Errorf("WindowsZoneName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const calendarsTable = "calendars"
+
+// calendarColumns are the calendar columns read by the repository.
+var calendarColumns = []string{
+	"id", "name", "source_type", "mailbox", "url", "display_name", "enabled", "sync_days",
+	"created_at", "updated_at",
+}
+
+type calendarRepository struct {
+	db *sqlx.DB
+}
+
+// NewCalendarRepository creates a new PostgreSQL calendar repository.
+func NewCalendarRepository(db *sqlx.DB) repository.CalendarRepository {
+	return &calendarRepository{db: db}
+}
+
+func (r *calendarRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Calendar, error) {
+	query, args, err := psql.Select(calendarColumns...).From(calendarsTable).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var model calendarModel
+	if err := r.db.GetContext(ctx, &model, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrCalendarNotFound
+		}
+		return nil, err
+	}
+
+	return model.toDomain(), nil
+}
+
+func (r *calendarRepository) List(ctx context.Context) ([]*domain.Calendar, error) {
+	query, args, err := psql.Select(calendarColumns...).From(calendarsTable).OrderBy("name ASC").ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []calendarModel
+	if err := r.db.SelectContext(ctx, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	calendars := make([]*domain.Calendar, len(models))
+	for i, m := range models {
+		calendars[i] = m.toDomain()
+	}
+
+	return calendars, nil
+}
+
+func (r *calendarRepository) Upsert(ctx context.Context, calendar *domain.Calendar) error {
+	now := time.Now()
+	if calendar.ID == uuid.Nil {
+		calendar.ID = uuid.New()
+	}
+	if calendar.CreatedAt.IsZero() {
+		calendar.CreatedAt = now
+	}
+	calendar.UpdatedAt = now
+
+	query, args, err := psql.Insert(calendarsTable).
+		Columns(
+			"id", "name", "source_type", "mailbox", "url", "display_name",
+			"enabled", "sync_days", "created_at", "updated_at",
+		).
+		Values(
+			calendar.ID, calendar.Name, calendar.SourceType, calendar.Mailbox, calendar.URL, calendar.DisplayName,
+			calendar.Enabled, calendar.SyncDays, calendar.CreatedAt, calendar.UpdatedAt,
+		).
+		Suffix(`ON CONFLICT (name) DO UPDATE SET
+			source_type = EXCLUDED.source_type,
+			mailbox = EXCLUDED.mailbox,
+			url = EXCLUDED.url,
+			display_name = EXCLUDED.display_name,
+			enabled = EXCLUDED.enabled,
+			sync_days = EXCLUDED.sync_days,
+			updated_at = EXCLUDED.updated_at
+			RETURNING id, created_at`).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	// On conflict the existing row keeps its ID
+	return r.db.QueryRowxContext(ctx, query, args...).Scan(&calendar.ID, &calendar.CreatedAt)
+}
+
+func (r *calendarRepository) DisableExcept(ctx context.Context, names []string) ([]string, error) {
+	query, args, err := psql.Update(calendarsTable).
+		Set("enabled", false).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"enabled": true}).
+		Where("NOT (name = ANY(?))", pq.Array(names)).
+		Suffix("RETURNING name").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var disabled []string
+	if err := r.db.SelectContext(ctx, &disabled, query, args...); err != nil {
+		return nil, err
+	}
+
+	return disabled, nil
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// changesChannel is the LISTEN/NOTIFY channel announcing committed changes.
+const changesChannel = "event_changes"
+
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	// listenerPingInterval is how long the listener may stay idle before its
+	// connection is checked, so that a dead connection is noticed.
+	listenerPingInterval = 90 * time.Second
+)
+
+// changeListener is a ChangeNotifier backed by PostgreSQL LISTEN on a
+// dedicated connection outside the pool. The connection is re-established
+// automatically while listening.
+type changeListener struct {
+	dsn    string
+	logger *zap.Logger
+}
+
+// NewChangeListener creates a notifier of event changes committed by any replica.
+func NewChangeListener(cfg config.DatabaseConfig, logger *zap.Logger) repository.ChangeNotifier {
+	return &changeListener{dsn: cfg.DSN(), logger: logger}
+}
+
+func (l *changeListener) Listen(ctx context.Context, notify func()) error {
+	listener := pq.NewListener(l.dsn, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			l.logger.Warn("change listener disconnected", zap.Error(err))
+		case pq.ListenerEventConnectionAttemptFailed:
+			l.logger.Warn("change listener failed to reconnect", zap.Error(err))
+		case pq.ListenerEventReconnected:
+			l.logger.Info("change listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(changesChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-listener.Notify:
+			// A nil notification follows a reconnect and is passed on as well
+			notify()
+			ping.Reset(listenerPingInterval)
+		case <-ping.C:
+			// A failed ping makes the listener reconnect; it may block meanwhile
+			go func() {
+				if err := listener.Ping(); err != nil {
+					l.logger.Warn("change listener ping failed", zap.Error(err))
+				}
+			}()
+		}
+	}
+}
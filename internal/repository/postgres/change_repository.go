@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const changesTable = "event_changes"
+
+// changeLogLockKey is the advisory lock key serializing writers of the change
+// log. Sequence numbers are taken in insertion order but become visible in
+// commit order; holding the lock from the insert until commit makes both
+// orders the same, so a reader never sees a change after a later one it has
+// already passed. Writers collect their changes and append them at the end of
+// the transaction, so the lock does not serialize the writes to events.
+const changeLogLockKey int64 = 0x63616c2d6c6f67
+
+type changeRepository struct {
+	db *sqlx.DB
+}
+
+// NewChangeRepository creates a new PostgreSQL event change log repository.
+func NewChangeRepository(db *sqlx.DB) repository.ChangeRepository {
+	return &changeRepository{db: db}
+}
+
+func (r *changeRepository) List(ctx context.Context, filter domain.ChangeFilter) ([]*domain.EventChange, error) {
+	return listChanges(ctx, r.db, filter)
+}
+
+// listChanges retrieves changes after filter.Since together with the current
+// state of the changed events.
+func listChanges(ctx context.Context, db sqlx.QueryerContext, filter domain.ChangeFilter) ([]*domain.EventChange, error) {
+	builder := psql.Select("seq", "event_id", "calendar_id", "exchange_id", "operation", "changed_at").
+		From(changesTable).
+		Where(sq.Gt{"seq": filter.Since}).
+		OrderBy("seq ASC")
+
+	if filter.Limit > 0 {
+		builder = builder.Limit(uint64(filter.Limit))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []changeModel
+	if err := sqlx.SelectContext(ctx, db, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	changes := make([]*domain.EventChange, len(models))
+	var ids []uuid.UUID
+	for i, m := range models {
+		changes[i] = m.toDomain()
+		if m.Operation != domain.ChangeOperationDelete {
+			ids = append(ids, m.EventID)
+		}
+	}
+
+	events, err := currentEvents(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if c.Operation != domain.ChangeOperationDelete {
+			c.Event = events[c.EventID]
+		}
+	}
+
+	return changes, nil
+}
+
+func (r *changeRepository) LastSeq(ctx context.Context) (int64, error) {
+	query, args, err := psql.Select("COALESCE(MAX(seq), 0)").From(changesTable).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var seq int64
+	if err := r.db.GetContext(ctx, &seq, query, args...); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+func (r *changeRepository) DeleteBefore(ctx context.Context, before time.Time) error {
+	query, args, err := psql.Delete(changesTable).Where(sq.Lt{"changed_at": before}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// currentEvents loads the events with the given IDs that still exist.
+func currentEvents(ctx context.Context, db sqlx.QueryerContext, ids []uuid.UUID) (map[uuid.UUID]*domain.Event, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := psql.Select(eventColumns...).From(eventsTable).Where(sq.Eq{"id": ids}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []eventModel
+	if err := sqlx.SelectContext(ctx, db, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	events := make([]*domain.Event, len(models))
+	byID := make(map[uuid.UUID]*domain.Event, len(models))
+	for i, m := range models {
+		events[i] = m.toDomain()
+		byID[events[i].ID] = events[i]
+	}
+
+	if err := loadRelations(ctx, db, events); err != nil {
+		return nil, err
+	}
+
+	return byID, nil
+}
+
+// recordChanges appends changes to the change log and notifies listeners on
+// commit. Identical notifications of one transaction are delivered once. It
+// takes the change log lock until the end of the transaction, so it must be
+// the last statement before commit: waiting for the lock then never happens
+// while another writer needs row locks held by this one.
+func recordChanges(ctx context.Context, tx *sqlx.Tx, changes []changeModel) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", changeLogLockKey); err != nil {
+		return err
+	}
+
+	rows := make([][]interface{}, len(changes))
+	for i, c := range changes {
+		rows[i] = []interface{}{c.EventID, c.CalendarID, c.ExchangeID, c.Operation}
+	}
+
+	if err := insertRows(ctx, tx, changesTable, []string{"event_id", "calendar_id", "exchange_id", "operation"}, rows); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "SELECT pg_notify($1, '')", changesChannel)
+	return err
+}
@@ -4,18 +4,40 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/anmaslov/calendar/internal/domain"
 	"github.com/anmaslov/calendar/internal/repository"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // PostgreSQL placeholder format
 var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-const eventsTable = "events"
+const (
+	// searchConfig is the text search configuration of the events search
+	// vector; queries must be parsed with the same configuration.
+	searchConfig = "russian"
+
+	// Highlighted words are enclosed in highlightStart and highlightStop.
+	// Short fields are highlighted whole, the body is cut to fragments
+	// around the matches.
+	highlightStart           = "<mark>"
+	highlightStop            = "</mark>"
+	highlightAllOptions      = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+	highlightFragmentOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=30, MinWords=10, MaxFragments=3, FragmentDelimiter=\" … \""
+)
+
+const (
+	eventsTable        = "events"
+	attendeesTable     = "event_attendees"
+	categoriesTable    = "event_categories"
+	excludedDatesTable = "event_excluded_dates"
+)
 
 type eventRepository struct {
 	db *sqlx.DB
@@ -27,7 +49,7 @@ func NewEventRepository(db *sqlx.DB) repository.EventRepository {
 }
 
 func (r *eventRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Event, error) {
-	query, args, err := psql.Select("*").From(eventsTable).Where(sq.Eq{"id": id}).ToSql()
+	query, args, err := psql.Select(eventColumns...).From(eventsTable).Where(sq.Eq{"id": id}).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -40,18 +62,30 @@ func (r *eventRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Ev
 		return nil, err
 	}
 
-	return model.toDomain(), nil
+	event := model.toDomain()
+	if err := loadRelations(ctx, r.db, []*domain.Event{event}); err != nil {
+		return nil, err
+	}
+
+	return event, nil
 }
 
 func (r *eventRepository) List(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, error) {
-	builder := applyEventFilter(psql.Select("*").From(eventsTable), filter).
-		OrderBy("start_time ASC")
+	builder := applyEventFilter(selectEvents(filter), filter)
+	if filter.Query != "" {
+		builder = builder.OrderBy("search_rank DESC")
+	}
+	// The ID breaks ties, so that pages neither overlap nor skip events
+	builder = builder.OrderBy("start_time ASC", "id ASC")
 
 	if filter.Limit > 0 {
 		builder = builder.Limit(uint64(filter.Limit))
 	}
 
-	if filter.Offset > 0 {
+	switch {
+	case filter.Cursor != nil:
+		builder = applyEventCursor(builder, filter)
+	case filter.Offset > 0:
 		builder = builder.Offset(uint64(filter.Offset))
 	}
 
@@ -60,7 +94,7 @@ func (r *eventRepository) List(ctx context.Context, filter domain.EventFilter) (
 		return nil, err
 	}
 
-	var models []eventModel
+	var models []searchEventModel
 	if err := r.db.SelectContext(ctx, &models, query, args...); err != nil {
 		return nil, err
 	}
@@ -70,9 +104,103 @@ func (r *eventRepository) List(ctx context.Context, filter domain.EventFilter) (
 		events[i] = m.toDomain()
 	}
 
+	if err := loadRelations(ctx, r.db, events); err != nil {
+		return nil, err
+	}
+
 	return events, nil
 }
 
+// loadRelations loads attendees, categories and excluded dates for all events with one query per table.
+func loadRelations(ctx context.Context, db sqlx.QueryerContext, events []*domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]*domain.Event, len(events))
+	ids := make([]uuid.UUID, len(events))
+	for i, e := range events {
+		byID[e.ID] = e
+		ids[i] = e.ID
+	}
+
+	query, args, err := psql.
+		Select("event_id", "email", "COALESCE(name, '') AS name", "COALESCE(response_status, '') AS response_status").
+		From(attendeesTable).
+		Where(sq.Eq{"event_id": ids}).
+		OrderBy("event_id", "email").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var attendees []attendeeModel
+	if err := sqlx.SelectContext(ctx, db, &attendees, query, args...); err != nil {
+		return err
+	}
+	for _, a := range attendees {
+		e := byID[a.EventID]
+		e.Attendees = append(e.Attendees, a.toDomain())
+	}
+
+	query, args, err = psql.
+		Select("event_id", "category").
+		From(categoriesTable).
+		Where(sq.Eq{"event_id": ids}).
+		OrderBy("event_id", "category").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var categories []categoryModel
+	if err := sqlx.SelectContext(ctx, db, &categories, query, args...); err != nil {
+		return err
+	}
+	for _, c := range categories {
+		e := byID[c.EventID]
+		e.Categories = append(e.Categories, c.Category)
+	}
+
+	return loadExcludedDates(ctx, db, events)
+}
+
+// loadExcludedDates loads excluded dates for series masters among the events.
+func loadExcludedDates(ctx context.Context, db sqlx.QueryerContext, events []*domain.Event) error {
+	byID := make(map[uuid.UUID]*domain.Event)
+	ids := make([]uuid.UUID, 0)
+	for _, e := range events {
+		if e.IsSeriesMaster() {
+			byID[e.ID] = e
+			ids = append(ids, e.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := psql.
+		Select("event_id", "excluded_date").
+		From(excludedDatesTable).
+		Where(sq.Eq{"event_id": ids}).
+		OrderBy("event_id", "excluded_date").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var dates []excludedDateModel
+	if err := sqlx.SelectContext(ctx, db, &dates, query, args...); err != nil {
+		return err
+	}
+	for _, d := range dates {
+		rec := byID[d.EventID].Recurrence
+		rec.ExcludedDates = append(rec.ExcludedDates, d.ExcludedDate)
+	}
+
+	return nil
+}
+
 func (r *eventRepository) Count(ctx context.Context, filter domain.EventFilter) (int64, error) {
 	query, args, err := applyEventFilter(psql.Select("COUNT(*)").From(eventsTable), filter).ToSql()
 	if err != nil {
@@ -87,19 +215,210 @@ func (r *eventRepository) Count(ctx context.Context, filter domain.EventFilter)
 	return count, nil
 }
 
+func (r *eventRepository) ListSeriesMasters(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, error) {
+	// Masters are matched by the span of the whole series rather than their first occurrence
+	spanFilter := filter
+	spanFilter.StartDate, spanFilter.EndDate, spanFilter.ExpandRecurring = nil, nil, false
+
+	builder := applyEventFilter(selectEvents(spanFilter), spanFilter).
+		Where(sq.NotEq{"recurrence_rule": ""}).
+		OrderBy("start_time ASC")
+	if filter.EndDate != nil {
+		builder = builder.Where(sq.Lt{"start_time": *filter.EndDate})
+	}
+	if filter.StartDate != nil {
+		builder = builder.Where(sq.Or{sq.Eq{"recurrence_end": nil}, sq.Gt{"recurrence_end": *filter.StartDate}})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []searchEventModel
+	if err := r.db.SelectContext(ctx, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	masters := make([]*domain.Event, len(models))
+	for i, m := range models {
+		masters[i] = m.toDomain()
+	}
+
+	if err := loadRelations(ctx, r.db, masters); err != nil {
+		return nil, err
+	}
+
+	return masters, nil
+}
+
+func (r *eventRepository) ListExceptionStarts(ctx context.Context, masters []*domain.Event) (map[uuid.UUID][]time.Time, error) {
+	result := make(map[uuid.UUID][]time.Time)
+	if len(masters) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uuid.UUID, len(masters))
+	for i, m := range masters {
+		ids[i] = m.ID
+	}
+
+	// Exceptions reference their master by Exchange ID within the same calendar
+	query, args, err := psql.Select("m.id AS series_master_id", "e.original_start").
+		From(eventsTable + " e").
+		Join(eventsTable + " m ON m.calendar_id = e.calendar_id AND m.exchange_id = e.series_master_id").
+		Where(sq.Eq{"m.id": ids}).
+		Where(sq.NotEq{"e.original_start": nil}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		SeriesMasterID uuid.UUID `db:"series_master_id"`
+		OriginalStart  time.Time `db:"original_start"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.SeriesMasterID] = append(result[row.SeriesMasterID], row.OriginalStart)
+	}
+
+	return result, nil
+}
+
+// selectEvents returns a query selecting events. With a full-text query in
+// the filter it also selects the search rank and highlights.
+func selectEvents(f domain.EventFilter) sq.SelectBuilder {
+	b := psql.Select(eventColumns...).From(eventsTable)
+	if f.Query == "" {
+		return b
+	}
+
+	query := "websearch_to_tsquery('" + searchConfig + "', ?)"
+	b = b.Column(sq.Expr("ts_rank_cd(search_vector, "+query+") AS search_rank", f.Query))
+	for _, h := range []struct{ column, options string }{
+		{"subject", highlightAllOptions},
+		{"location", highlightAllOptions},
+		{"organizer", highlightAllOptions},
+		{"body", highlightFragmentOptions},
+	} {
+		b = b.Column(sq.Expr(
+			"ts_headline('"+searchConfig+"', coalesce("+h.column+", ''), "+query+", '"+h.options+"') AS "+h.column+"_highlight",
+			f.Query,
+		))
+	}
+	return b
+}
+
+// applyEventCursor restricts the query to events following the filter cursor
+// in the listing order. The rank is negated, as it is ordered descending.
+func applyEventCursor(b sq.SelectBuilder, f domain.EventFilter) sq.SelectBuilder {
+	c := f.Cursor
+	if f.Query == "" {
+		return b.Where("(start_time, id) > (?, ?)", c.StartTime, c.ID)
+	}
+	return b.Where(
+		"(-ts_rank_cd(search_vector, websearch_to_tsquery('"+searchConfig+"', ?)), start_time, id) > (?, ?, ?)",
+		f.Query, -c.Rank, c.StartTime, c.ID,
+	)
+}
+
 // applyEventFilter applies common filters to the query builder.
 func applyEventFilter(b sq.SelectBuilder, f domain.EventFilter) sq.SelectBuilder {
-	if f.StartDate != nil {
-		b = b.Where(sq.GtOrEq{"start_time": *f.StartDate})
+	b = applyDateRange(b, f)
+	if f.Subject != "" {
+		b = b.Where(sq.ILike{"subject": containsPattern(f.Subject)})
 	}
-	if f.EndDate != nil {
-		b = b.Where(sq.LtOrEq{"end_time": *f.EndDate})
+	if f.Query != "" {
+		b = b.Where("search_vector @@ websearch_to_tsquery('"+searchConfig+"', ?)", f.Query)
 	}
-	if f.Subject != "" {
-		b = b.Where(sq.ILike{"subject": "%" + f.Subject + "%"})
+	if f.Location != "" {
+		b = b.Where(sq.ILike{"location": containsPattern(f.Location)})
+	}
+	if f.Organizer != "" {
+		b = b.Where("lower(organizer) = lower(?)", f.Organizer)
+	}
+	if len(f.Attendees) > 0 {
+		b = b.Where("EXISTS (SELECT 1 FROM "+attendeesTable+" a WHERE a.event_id = events.id AND lower(a.email) = ANY(?))",
+			pq.Array(lowered(f.Attendees)))
+	}
+	if len(f.Categories) > 0 {
+		b = b.Where("EXISTS (SELECT 1 FROM "+categoriesTable+" c WHERE c.event_id = events.id AND lower(c.category) = ANY(?))",
+			pq.Array(lowered(f.Categories)))
+	}
+	b = applyValueFilter(b, "status", f.Status)
+	b = applyValueFilter(b, "importance", f.Importance)
+	b = applyValueFilter(b, "sensitivity", f.Sensitivity)
+	if f.IsAllDay != nil {
+		b = b.Where(sq.Eq{"is_all_day": *f.IsAllDay})
+	}
+	if len(f.CalendarIDs) > 0 {
+		b = b.Where(sq.Eq{"calendar_id": f.CalendarIDs})
 	}
-	if f.Status != "" {
-		b = b.Where(sq.Eq{"status": f.Status})
+	if f.ExpandRecurring {
+		// Series masters are expanded into occurrences separately
+		b = b.Where(sq.Eq{"recurrence_rule": ""})
 	}
 	return b
 }
+
+// applyDateRange restricts the query to events matching the filter date range
+// in its range mode; see domain.EventFilter.InRange.
+func applyDateRange(b sq.SelectBuilder, f domain.EventFilter) sq.SelectBuilder {
+	if f.StartDate == nil && f.EndDate == nil {
+		return b
+	}
+
+	switch f.RangeMode {
+	case domain.RangeContained:
+		if f.StartDate != nil {
+			b = b.Where(sq.GtOrEq{"start_time": *f.StartDate})
+		}
+		if f.EndDate != nil {
+			b = b.Where(sq.LtOrEq{"end_time": *f.EndDate})
+		}
+	case domain.RangeStartsWithin:
+		if f.StartDate != nil {
+			b = b.Where(sq.GtOrEq{"start_time": *f.StartDate})
+		}
+		if f.EndDate != nil {
+			b = b.Where(sq.Lt{"start_time": *f.EndDate})
+		}
+	default:
+		// A missing bound leaves the range unbounded on that side
+		b = b.Where("period && tstzrange(?::timestamptz, ?::timestamptz, '[)')", f.StartDate, f.EndDate)
+	}
+	return b
+}
+
+// applyValueFilter restricts the column to the included values and excludes
+// the excluded ones. NULL is not any of the excluded values, so events
+// without a value are kept.
+func applyValueFilter(b sq.SelectBuilder, column string, f domain.ValueFilter) sq.SelectBuilder {
+	if len(f.In) > 0 {
+		b = b.Where(sq.Eq{column: f.In})
+	}
+	if len(f.NotIn) > 0 {
+		b = b.Where(sq.Or{sq.Eq{column: nil}, sq.NotEq{column: f.NotIn}})
+	}
+	return b
+}
+
+// likeEscaper escapes the LIKE wildcards and the default escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns a LIKE pattern matching values that contain s literally.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// lowered returns the strings in lower case.
+func lowered(values []string) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = strings.ToLower(v)
+	}
+	return result
+}
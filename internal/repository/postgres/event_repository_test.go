@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anmaslov/calendar/internal/domain"
+)
+
+func TestApplyEventFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    domain.EventFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "excluded values keep NULL",
+			filter:    domain.EventFilter{Sensitivity: domain.ValueFilter{NotIn: []string{"private"}}},
+			wantWhere: "(sensitivity IS NULL OR sensitivity NOT IN ($1))",
+			wantArgs:  []interface{}{"private"},
+		},
+		{
+			name:      "included values",
+			filter:    domain.EventFilter{Status: domain.ValueFilter{In: []string{"confirmed", "tentative"}}},
+			wantWhere: "status IN ($1,$2)",
+			wantArgs:  []interface{}{"confirmed", "tentative"},
+		},
+		{
+			name:      "location wildcards are literal",
+			filter:    domain.EventFilter{Location: `50%_off\`},
+			wantWhere: "location ILIKE $1",
+			wantArgs:  []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			name:      "subject wildcards are literal",
+			filter:    domain.EventFilter{Subject: "a_b"},
+			wantWhere: "subject ILIKE $1",
+			wantArgs:  []interface{}{`%a\_b%`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := applyEventFilter(psql.Select("id").From(eventsTable), tt.filter).ToSql()
+			if err != nil {
+				t.Fatalf("ToSql: %v", err)
+			}
+			if want := "SELECT id FROM " + eventsTable + " WHERE " + tt.wantWhere; query != want {
+				t.Errorf("query = %q, want %q", query, want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -2,21 +2,62 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/anmaslov/calendar/internal/domain"
 	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
-// Event columns for sync operations
+const syncStatesTable = "sync_states"
+
+// Event columns written and read by the repositories. The generated
+// search_vector and period columns are neither, so events are never selected
+// with *.
 var eventColumns = []string{
-	"id", "exchange_id", "subject", "body", "location",
+	"id", "exchange_id", "change_key", "content_hash", "calendar_id", "subject", "body", "location",
 	"start_time", "end_time", "is_all_day", "organizer",
-	"importance", "sensitivity", "status", "created_at", "updated_at", "synced_at",
+	"importance", "sensitivity", "status", "time_zone",
+	"recurrence_rule", "recurrence_end", "series_master_id", "original_start", "is_exception",
+	"created_at", "updated_at", "synced_at",
 }
 
+// maxQueryParams is the PostgreSQL limit of bind parameters in one statement.
+const maxQueryParams = 65535
+
+// upsertEventSuffix updates existing events on conflict unless their content
+// is unchanged; unchanged rows are not returned. On conflict the existing row
+// keeps its ID, so it is returned for child rows; only freshly inserted rows
+// have no deleting transaction (xmax).
+const upsertEventSuffix = `ON CONFLICT (calendar_id, exchange_id) DO UPDATE SET
+	change_key = EXCLUDED.change_key,
+	content_hash = EXCLUDED.content_hash,
+	subject = EXCLUDED.subject,
+	body = EXCLUDED.body,
+	location = EXCLUDED.location,
+	start_time = EXCLUDED.start_time,
+	end_time = EXCLUDED.end_time,
+	is_all_day = EXCLUDED.is_all_day,
+	organizer = EXCLUDED.organizer,
+	importance = EXCLUDED.importance,
+	sensitivity = EXCLUDED.sensitivity,
+	status = EXCLUDED.status,
+	time_zone = EXCLUDED.time_zone,
+	recurrence_rule = EXCLUDED.recurrence_rule,
+	recurrence_end = EXCLUDED.recurrence_end,
+	series_master_id = EXCLUDED.series_master_id,
+	original_start = EXCLUDED.original_start,
+	is_exception = EXCLUDED.is_exception,
+	updated_at = EXCLUDED.updated_at,
+	synced_at = EXCLUDED.synced_at
+	WHERE events.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+	RETURNING id, exchange_id, (xmax = 0) AS created`
+
 type eventSyncRepository struct {
 	db *sqlx.DB
 }
@@ -26,57 +67,536 @@ func NewEventSyncRepository(db *sqlx.DB) repository.EventSyncRepository {
 	return &eventSyncRepository{db: db}
 }
 
-func (r *eventSyncRepository) Upsert(ctx context.Context, event *domain.Event) error {
+func (r *eventSyncRepository) Upsert(ctx context.Context, event *domain.Event) (bool, error) {
 	now := time.Now()
+	model, err := prepareEvent(event, now)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	events, models, err := withoutUnchanged(ctx, tx, event.CalendarID, []*domain.Event{event}, []*eventModel{model}, now)
+	if err != nil {
+		return false, err
+	}
+
+	var changes []changeModel
+	created, _, err := upsertEvents(ctx, tx, events, models, &changes)
+	if err != nil {
+		return false, err
+	}
+	if err := recordChanges(ctx, tx, changes); err != nil {
+		return false, err
+	}
+
+	return created == 1, tx.Commit()
+}
+
+func (r *eventSyncRepository) ApplyBatch(ctx context.Context, batch *domain.EventBatch) (*domain.EventBatchResult, error) {
+	result := &domain.EventBatchResult{Failed: make(map[string]error)}
+	now := time.Now()
+
+	events := make([]*domain.Event, 0, len(batch.Events))
+	models := make([]*eventModel, 0, len(batch.Events))
+	index := make(map[string]int, len(batch.Events))
+	for _, event := range batch.Events {
+		event.CalendarID = batch.CalendarID
+		model, err := prepareEvent(event, now)
+		if err != nil {
+			result.Failed[event.ExchangeID] = err
+			continue
+		}
+
+		// A statement cannot update the same row twice, so a repeated event replaces the earlier one
+		if i, ok := index[event.ExchangeID]; ok {
+			events[i], models[i] = event, model
+			continue
+		}
+		index[event.ExchangeID] = len(events)
+		events = append(events, event)
+		models = append(models, model)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	events, models, err = withoutUnchanged(ctx, tx, batch.CalendarID, events, models, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []changeModel
+	created, updated, err := upsertEvents(ctx, tx, events, models, &changes)
+	if err != nil {
+		return nil, err
+	}
+	result.Created = created
+	result.Updated = updated
+	result.Unchanged = len(index) - created - updated
+
+	if batch.WindowStart != nil && batch.WindowEnd != nil {
+		// All events of the batch are kept, including those that failed to be
+		// stored, so they are not lost locally
+		exchangeIDs := make([]string, len(batch.Events))
+		for i, event := range batch.Events {
+			exchangeIDs[i] = event.ExchangeID
+		}
+
+		deleted, err := deleteNotInWindow(ctx, tx, batch.CalendarID, *batch.WindowStart, *batch.WindowEnd, exchangeIDs, &changes)
+		if err != nil {
+			return nil, err
+		}
+		result.Deleted += int(deleted)
+	}
+
+	deleted, err := deleteSeries(ctx, tx, batch.CalendarID, batch.DeletedIDs, &changes)
+	if err != nil {
+		return nil, err
+	}
+	result.Deleted += int(deleted)
+
+	// Keep the old state while events fail so that they are retried next cycle
+	if batch.SyncState != "" && len(result.Failed) == 0 {
+		if err := saveSyncState(ctx, tx, batch.CalendarID, batch.SyncState); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordChanges(ctx, tx, changes); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// prepareEvent sets the ID and timestamps of an event to be stored and converts it to a model.
+func prepareEvent(event *domain.Event, now time.Time) (*eventModel, error) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
 	if event.CreatedAt.IsZero() {
 		event.CreatedAt = now
 	}
 	event.UpdatedAt = now
 	event.SyncedAt = &now
 
-	model := toEventModel(event)
-
-	query, args, err := psql.Insert(eventsTable).
-		Columns(eventColumns...).
-		Values(
-			model.ID, model.ExchangeID, model.Subject, model.Body, model.Location,
-			model.StartTime, model.EndTime, model.IsAllDay, model.Organizer,
-			model.Importance, model.Sensitivity, model.Status,
-			model.CreatedAt, model.UpdatedAt, model.SyncedAt,
-		).
-		Suffix(`ON CONFLICT (exchange_id) DO UPDATE SET
-			subject = EXCLUDED.subject,
-			body = EXCLUDED.body,
-			location = EXCLUDED.location,
-			start_time = EXCLUDED.start_time,
-			end_time = EXCLUDED.end_time,
-			is_all_day = EXCLUDED.is_all_day,
-			organizer = EXCLUDED.organizer,
-			importance = EXCLUDED.importance,
-			sensitivity = EXCLUDED.sensitivity,
-			status = EXCLUDED.status,
-			updated_at = EXCLUDED.updated_at,
-			synced_at = EXCLUDED.synced_at`).
-		ToSql()
+	return toEventModel(event)
+}
+
+// withoutUnchanged drops events whose stored content hash matches, so that
+// they are neither sent to the database nor have their relations replaced.
+// The same statement that reads the stored hashes marks all stored events as
+// synced at now, so synced_at tells when an event was last seen in its
+// source while updated_at only changes with its content. It also stores the
+// current change keys, which change with properties that are not stored.
+// Dropped events receive their stored IDs.
+func withoutUnchanged(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, events []*domain.Event, models []*eventModel, now time.Time) ([]*domain.Event, []*eventModel, error) {
+	if len(events) == 0 {
+		return events, models, nil
+	}
+
+	exchangeIDs := make([]string, len(models))
+	changeKeys := make([]string, len(models))
+	for i, m := range models {
+		exchangeIDs[i] = m.ExchangeID
+		changeKeys[i] = m.ChangeKey
+	}
+
+	query := `UPDATE events AS e SET synced_at = $1, change_key = v.change_key
+		FROM unnest($2::text[], $3::text[]) AS v(exchange_id, change_key)
+		WHERE e.calendar_id = $4 AND e.exchange_id = v.exchange_id
+		RETURNING e.id, e.exchange_id, e.content_hash`
+	args := []interface{}{now, pq.Array(exchangeIDs), pq.Array(changeKeys), calendarID}
+
+	var stored []struct {
+		ID          uuid.UUID `db:"id"`
+		ExchangeID  string    `db:"exchange_id"`
+		ContentHash string    `db:"content_hash"`
+	}
+	if err := tx.SelectContext(ctx, &stored, query, args...); err != nil {
+		return nil, nil, err
+	}
+
+	byExchangeID := make(map[string]int, len(stored))
+	for i, s := range stored {
+		byExchangeID[s.ExchangeID] = i
+	}
+
+	changedEvents := events[:0:0]
+	changedModels := models[:0:0]
+	for i, m := range models {
+		if n, ok := byExchangeID[m.ExchangeID]; ok && stored[n].ContentHash == m.ContentHash {
+			events[i].ID = stored[n].ID
+			continue
+		}
+		changedEvents = append(changedEvents, events[i])
+		changedModels = append(changedModels, m)
+	}
+
+	return changedEvents, changedModels, nil
+}
+
+// upsertEvents creates or updates events of one calendar with multi-row
+// statements, replaces attendees, categories and excluded dates of the
+// written events and appends their changes to changes. Written events receive
+// their stored IDs. It returns the number of created and updated events;
+// unchanged events are not written.
+func upsertEvents(ctx context.Context, tx *sqlx.Tx, events []*domain.Event, models []*eventModel, changes *[]changeModel) (created, updated int, err error) {
+	byExchangeID := make(map[string]*domain.Event, len(events))
+	for _, event := range events {
+		byExchangeID[event.ExchangeID] = event
+	}
+
+	var written []*domain.Event
+	for _, chunk := range chunks(models, maxQueryParams/len(eventColumns)) {
+		builder := psql.Insert(eventsTable).Columns(eventColumns...)
+		for _, m := range chunk {
+			builder = builder.Values(
+				m.ID, m.ExchangeID, m.ChangeKey, m.ContentHash, m.CalendarID, m.Subject, m.Body, m.Location,
+				m.StartTime, m.EndTime, m.IsAllDay, m.Organizer,
+				m.Importance, m.Sensitivity, m.Status, m.TimeZone,
+				m.RecurrenceRule, m.RecurrenceEnd, m.SeriesMasterID, m.OriginalStart, m.IsException,
+				m.CreatedAt, m.UpdatedAt, m.SyncedAt,
+			)
+		}
+
+		query, args, err := builder.Suffix(upsertEventSuffix).ToSql()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		n, err := scanUpserted(ctx, tx, query, args, byExchangeID, &written, changes)
+		if err != nil {
+			return 0, 0, err
+		}
+		created += n
+	}
+
+	if err := replaceRelations(ctx, tx, written); err != nil {
+		return 0, 0, err
+	}
+
+	return created, len(written) - created, nil
+}
+
+// scanUpserted runs an upsert statement, assigns the returned IDs to the
+// events, appends them to written and their changes to changes, and returns
+// the number of created events.
+func scanUpserted(ctx context.Context, tx *sqlx.Tx, query string, args []interface{}, byExchangeID map[string]*domain.Event, written *[]*domain.Event, changes *[]changeModel) (int, error) {
+	rows, err := tx.QueryxContext(ctx, query, args...)
 	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	created := 0
+	for rows.Next() {
+		var (
+			id         uuid.UUID
+			exchangeID string
+			isNew      bool
+		)
+		if err := rows.Scan(&id, &exchangeID, &isNew); err != nil {
+			return 0, err
+		}
+		event := byExchangeID[exchangeID]
+		event.ID = id
+		*written = append(*written, event)
+
+		change := changeModel{
+			EventID:    id,
+			CalendarID: event.CalendarID,
+			ExchangeID: exchangeID,
+			Operation:  domain.ChangeOperationUpdate,
+		}
+		if isNew {
+			change.Operation = domain.ChangeOperationInsert
+			created++
+		}
+		*changes = append(*changes, change)
+	}
+
+	return created, rows.Err()
+}
+
+// replaceRelations replaces attendees, categories and excluded dates of the events.
+func replaceRelations(ctx context.Context, tx *sqlx.Tx, events []*domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(events))
+	var attendees, categories, excluded [][]interface{}
+	for i, e := range events {
+		ids[i] = e.ID.String()
+		for _, a := range e.Attendees {
+			attendees = append(attendees, []interface{}{e.ID, a.Email, a.Name, a.ResponseStatus})
+		}
+		for _, c := range e.Categories {
+			categories = append(categories, []interface{}{e.ID, c})
+		}
+		if e.Recurrence != nil {
+			for _, d := range e.Recurrence.ExcludedDates {
+				excluded = append(excluded, []interface{}{e.ID, d})
+			}
+		}
+	}
+
+	for _, table := range []string{attendeesTable, categoriesTable, excludedDatesTable} {
+		query, args, err := psql.Delete(table).Where("event_id = ANY(?::uuid[])", pq.Array(ids)).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := insertRows(ctx, tx, attendeesTable, []string{"event_id", "email", "name", "response_status"}, attendees); err != nil {
 		return err
 	}
+	if err := insertRows(ctx, tx, categoriesTable, []string{"event_id", "category"}, categories); err != nil {
+		return err
+	}
+	return insertRows(ctx, tx, excludedDatesTable, []string{"event_id", "excluded_date"}, excluded)
+}
 
-	_, err = r.db.ExecContext(ctx, query, args...)
-	return err
+// insertRows inserts rows with as few multi-row statements as the parameter limit allows.
+func insertRows(ctx context.Context, tx *sqlx.Tx, table string, columns []string, rows [][]interface{}) error {
+	for _, chunk := range chunks(rows, maxQueryParams/len(columns)) {
+		builder := psql.Insert(table).Columns(columns...)
+		for _, row := range chunk {
+			builder = builder.Values(row...)
+		}
+
+		query, args, err := builder.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (r *eventSyncRepository) DeleteNotInExchangeIDs(ctx context.Context, exchangeIDs []string) error {
-	builder := psql.Delete(eventsTable)
-	if len(exchangeIDs) > 0 {
-		builder = builder.Where(sq.NotEq{"exchange_id": exchangeIDs})
+// chunks splits items into consecutive chunks of at most size items.
+func chunks[T any](items []T, size int) [][]T {
+	var result [][]T
+	for len(items) > size {
+		result = append(result, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		result = append(result, items)
 	}
+	return result
+}
+
+// deleteNotInWindow deletes events of the calendar overlapping the window
+// whose Exchange IDs are not in the provided list, appends their changes to
+// changes and returns the number of deleted events.
+func deleteNotInWindow(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, startDate, endDate time.Time, exchangeIDs []string, changes *[]changeModel) (int64, error) {
+	// Only single events and exceptions overlapping the fetched window are
+	// candidates, matching what CalendarView returns
+	deleted, err := deleteEvents(ctx, tx, psql.Delete(eventsTable).
+		Where(sq.Eq{"calendar_id": calendarID}).
+		Where(sq.Eq{"recurrence_rule": ""}).
+		Where(sq.Lt{"start_time": endDate}).
+		Where(sq.Gt{"end_time": startDate}).
+		Where("NOT (exchange_id = ANY(?))", pq.Array(exchangeIDs)), changes)
+	if err != nil {
+		return 0, err
+	}
+
+	stale, err := staleSeriesMasters(ctx, tx, calendarID, startDate, endDate, exchangeIDs)
+	if err != nil {
+		return 0, err
+	}
+	n, err := deleteSeries(ctx, tx, calendarID, stale, changes)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted + n, nil
+}
+
+// staleSeriesMasters returns Exchange IDs of series masters that were not
+// fetched although their rule puts an occurrence into the window. Masters are
+// only fetched along with an occurrence, so a series without occurrences in
+// the window (e.g. a yearly one) must not be treated as deleted.
+func staleSeriesMasters(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, startDate, endDate time.Time, exchangeIDs []string) ([]string, error) {
+	builder := psql.Select(eventColumns...).From(eventsTable).
+		Where(sq.Eq{"calendar_id": calendarID}).
+		Where(sq.NotEq{"recurrence_rule": ""}).
+		Where(sq.Lt{"start_time": endDate}).
+		Where(sq.Or{sq.Eq{"recurrence_end": nil}, sq.Gt{"recurrence_end": startDate}}).
+		Where("NOT (exchange_id = ANY(?))", pq.Array(exchangeIDs))
 
 	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []eventModel
+	if err := tx.SelectContext(ctx, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	masters := make([]*domain.Event, len(models))
+	for i, m := range models {
+		masters[i] = m.toDomain()
+	}
+	if err := loadExcludedDates(ctx, tx, masters); err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, m := range masters {
+		occurrences, err := seriesOf(m).Between(startDate.Add(-m.EndTime.Sub(m.StartTime)), endDate)
+		if err != nil {
+			return nil, err
+		}
+		if len(occurrences) > 0 {
+			stale = append(stale, m.ExchangeID)
+		}
+	}
+
+	return stale, nil
+}
+
+func (r *eventSyncRepository) DeleteByExchangeIDs(ctx context.Context, calendarID uuid.UUID, exchangeIDs []string) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var changes []changeModel
+	deleted, err := deleteSeries(ctx, tx, calendarID, exchangeIDs, &changes)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChanges(ctx, tx, changes); err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+func (r *eventSyncRepository) DeleteException(ctx context.Context, calendarID uuid.UUID, exchangeID, seriesMasterID string, originalStart time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var changes []changeModel
+	if _, err := deleteSeries(ctx, tx, calendarID, []string{exchangeID}, &changes); err != nil {
+		return err
+	}
+
+	query := `UPDATE events SET updated_at = $1
+		WHERE calendar_id = $2 AND exchange_id = $3 AND recurrence_rule <> ''
+		RETURNING id AS event_id, calendar_id, exchange_id`
+
+	var masters []changeModel
+	if err := tx.SelectContext(ctx, &masters, query, time.Now(), calendarID, seriesMasterID); err != nil {
+		return err
+	}
+
+	excluded := make([][]interface{}, len(masters))
+	for i := range masters {
+		masters[i].Operation = domain.ChangeOperationUpdate
+		excluded[i] = []interface{}{masters[i].EventID, originalStart.UTC()}
+	}
+	if err := insertRows(ctx, tx, excludedDatesTable, []string{"event_id", "excluded_date"}, excluded); err != nil {
+		return err
+	}
+
+	if err := recordChanges(ctx, tx, append(changes, masters...)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteSeries deletes events with the given Exchange IDs together with
+// exceptions of series whose master is among them, appends their changes to
+// changes and returns the number of deleted events.
+func deleteSeries(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, exchangeIDs []string, changes *[]changeModel) (int64, error) {
+	if len(exchangeIDs) == 0 {
+		return 0, nil
+	}
+
+	return deleteEvents(ctx, tx, psql.Delete(eventsTable).
+		Where(sq.Eq{"calendar_id": calendarID}).
+		Where(sq.Or{sq.Eq{"exchange_id": exchangeIDs}, sq.Eq{"series_master_id": exchangeIDs}}), changes)
+}
+
+// deleteEvents runs an event delete statement, appends the changes of the
+// deleted events to changes and returns their number.
+func deleteEvents(ctx context.Context, tx *sqlx.Tx, builder sq.DeleteBuilder, changes *[]changeModel) (int64, error) {
+	query, args, err := builder.Suffix("RETURNING id AS event_id, calendar_id, exchange_id").ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted []changeModel
+	if err := tx.SelectContext(ctx, &deleted, query, args...); err != nil {
+		return 0, err
+	}
+	for i := range deleted {
+		deleted[i].Operation = domain.ChangeOperationDelete
+	}
+
+	*changes = append(*changes, deleted...)
+	return int64(len(deleted)), nil
+}
+
+func (r *eventSyncRepository) GetSyncState(ctx context.Context, calendarID uuid.UUID) (string, error) {
+	query, args, err := psql.Select("sync_state").From(syncStatesTable).Where(sq.Eq{"calendar_id": calendarID}).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var state string
+	if err := r.db.GetContext(ctx, &state, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return state, nil
+}
+
+// saveSyncState stores the incremental sync state for a calendar.
+func saveSyncState(ctx context.Context, tx *sqlx.Tx, calendarID uuid.UUID, state string) error {
+	query, args, err := psql.Insert(syncStatesTable).
+		Columns("calendar_id", "sync_state", "updated_at").
+		Values(calendarID, state, time.Now()).
+		Suffix(`ON CONFLICT (calendar_id) DO UPDATE SET
+			sync_state = EXCLUDED.sync_state,
+			updated_at = EXCLUDED.updated_at`).
+		ToSql()
 	if err != nil {
 		return err
 	}
 
-	_, err = r.db.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	return err
 }
@@ -0,0 +1,286 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// testEvents returns n events with stable Exchange IDs. Events of different
+// revisions differ in content.
+func testEvents(n, revision int) []*domain.Event {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	events := make([]*domain.Event, n)
+	for i := range events {
+		event := domain.NewEvent()
+		event.ExchangeID = fmt.Sprintf("item-%05d", i)
+		event.ChangeKey = fmt.Sprintf("ck-%05d-%d", i, revision)
+		event.Subject = fmt.Sprintf("Встреча %d, версия %d", i, revision)
+		event.Location = "Переговорная 3"
+		event.StartTime = start.Add(time.Duration(i) * time.Hour)
+		event.EndTime = event.StartTime.Add(30 * time.Minute)
+		event.Organizer = "ivan.petrov@example.com"
+		event.Attendees = []domain.Attendee{
+			{Email: "ivan.petrov@example.com", Name: "Иван Петров", ResponseStatus: domain.ResponseStatusOrganizer},
+			{Email: "maria.sidorova@example.com", Name: "Мария Сидорова", ResponseStatus: domain.ResponseStatusAccepted},
+		}
+		event.Categories = []string{"Работа"}
+		events[i] = event
+	}
+	return events
+}
+
+// storedEvent is the part of a stored event checked by the tests.
+type storedEvent struct {
+	ChangeKey string
+	Subject   string
+	UpdatedAt time.Time
+	SyncedAt  *time.Time
+}
+
+func storedEvents(t *testing.T, db *sqlx.DB, calendarID uuid.UUID) map[string]storedEvent {
+	t.Helper()
+
+	rows, err := db.Queryx("SELECT exchange_id, change_key, subject, updated_at, synced_at FROM events WHERE calendar_id = $1", calendarID)
+	if err != nil {
+		t.Fatalf("select events: %v", err)
+	}
+	defer rows.Close()
+
+	events := make(map[string]storedEvent)
+	for rows.Next() {
+		var (
+			exchangeID string
+			event      storedEvent
+		)
+		if err := rows.Scan(&exchangeID, &event.ChangeKey, &event.Subject, &event.UpdatedAt, &event.SyncedAt); err != nil {
+			t.Fatalf("scan event: %v", err)
+		}
+		events[exchangeID] = event
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("select events: %v", err)
+	}
+	return events
+}
+
+func countChanges(t *testing.T, db *sqlx.DB, calendarID uuid.UUID) int {
+	t.Helper()
+
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM event_changes WHERE calendar_id = $1", calendarID); err != nil {
+		t.Fatalf("count changes: %v", err)
+	}
+	return n
+}
+
+func TestApplyBatchRollsBackOnFailure(t *testing.T) {
+	db := testDB(t)
+	calendar := testCalendar(t, db)
+	repo := NewEventSyncRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{
+		CalendarID: calendar.ID,
+		Events:     testEvents(3, 1),
+		SyncState:  "state-1",
+	}); err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+
+	before := storedEvents(t, db, calendar.ID)
+	changes := countChanges(t, db, calendar.ID)
+
+	// The events are upserted before the category of the last one exceeds
+	// its column, so the batch fails midway
+	events := testEvents(4, 2)
+	events[3].Categories = []string{strings.Repeat("к", 101)}
+	windowStart := events[0].StartTime.Add(-time.Hour)
+	windowEnd := events[3].EndTime.Add(time.Hour)
+
+	_, err := repo.ApplyBatch(ctx, &domain.EventBatch{
+		CalendarID:  calendar.ID,
+		Events:      events[1:],
+		WindowStart: &windowStart,
+		WindowEnd:   &windowEnd,
+		SyncState:   "state-2",
+	})
+	if err == nil {
+		t.Fatal("ApplyBatch succeeded with a category exceeding its column")
+	}
+
+	after := storedEvents(t, db, calendar.ID)
+	if len(after) != len(before) {
+		t.Errorf("events = %d after the failed batch, want %d", len(after), len(before))
+	}
+	for exchangeID, want := range before {
+		got, ok := after[exchangeID]
+		if !ok {
+			t.Errorf("%s deleted by the failed batch", exchangeID)
+			continue
+		}
+		if got.Subject != want.Subject || !got.UpdatedAt.Equal(want.UpdatedAt) || !got.SyncedAt.Equal(*want.SyncedAt) {
+			t.Errorf("%s changed by the failed batch: %+v, want %+v", exchangeID, got, want)
+		}
+	}
+	if n := countChanges(t, db, calendar.ID); n != changes {
+		t.Errorf("change log has %d entries after the failed batch, want %d", n, changes)
+	}
+
+	state, err := repo.GetSyncState(ctx, calendar.ID)
+	if err != nil {
+		t.Fatalf("GetSyncState: %v", err)
+	}
+	if state != "state-1" {
+		t.Errorf("sync state = %q after the failed batch, want %q", state, "state-1")
+	}
+}
+
+func TestApplyBatchUnchangedEvents(t *testing.T) {
+	db := testDB(t)
+	calendar := testCalendar(t, db)
+	repo := NewEventSyncRepository(db)
+	ctx := context.Background()
+
+	if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: testEvents(2, 1)}); err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+	before := storedEvents(t, db, calendar.ID)
+	changes := countChanges(t, db, calendar.ID)
+
+	// A new change key alone does not change the stored content
+	events := testEvents(2, 1)
+	events[0].ChangeKey = "ck-00000-2"
+	events[1].Subject = "Перенесённая встреча"
+
+	result, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: events})
+	if err != nil {
+		t.Fatalf("second batch: %v", err)
+	}
+	if result.Created != 0 || result.Updated != 1 || result.Unchanged != 1 {
+		t.Errorf("result = %+v, want 1 updated and 1 unchanged", result)
+	}
+
+	after := storedEvents(t, db, calendar.ID)
+	unchanged := after["item-00000"]
+	if !unchanged.UpdatedAt.Equal(before["item-00000"].UpdatedAt) {
+		t.Errorf("updated_at of the unchanged event moved from %v to %v", before["item-00000"].UpdatedAt, unchanged.UpdatedAt)
+	}
+	if unchanged.ChangeKey != "ck-00000-2" {
+		t.Errorf("change_key of the unchanged event = %q, want the new one", unchanged.ChangeKey)
+	}
+	if !unchanged.SyncedAt.After(*before["item-00000"].SyncedAt) {
+		t.Errorf("synced_at of the unchanged event did not advance from %v", *before["item-00000"].SyncedAt)
+	}
+	if updated := after["item-00001"]; updated.Subject != "Перенесённая встреча" || !updated.UpdatedAt.After(before["item-00001"].UpdatedAt) {
+		t.Errorf("changed event not updated: %+v", updated)
+	}
+	if n := countChanges(t, db, calendar.ID) - changes; n != 1 {
+		t.Errorf("change log entries = %d, want 1", n)
+	}
+}
+
+// BenchmarkApplyBatch compares storing a sync cycle of 10k changed events
+// one upsert per event, as sync did before batching, with ApplyBatch.
+func BenchmarkApplyBatch(b *testing.B) {
+	const n = 10000
+
+	db := testDB(b)
+	repo := NewEventSyncRepository(db)
+	ctx := context.Background()
+
+	b.Run("per-row", func(b *testing.B) {
+		calendar := testCalendar(b, db)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			events := testEvents(n, i)
+			b.StartTimer()
+
+			for _, event := range events {
+				event.CalendarID = calendar.ID
+				if _, err := repo.Upsert(ctx, event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("multi-row", func(b *testing.B) {
+		calendar := testCalendar(b, db)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			events := testEvents(n, i)
+			b.StartTimer()
+
+			if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: events}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("multi-row unchanged", func(b *testing.B) {
+		calendar := testCalendar(b, db)
+		if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: testEvents(n, 0)}); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			events := testEvents(n, 0)
+			b.StartTimer()
+
+			if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: events}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDeleteException(t *testing.T) {
+	db := testDB(t)
+	calendar := testCalendar(t, db)
+	repo := NewEventSyncRepository(db)
+	ctx := context.Background()
+
+	events := testEvents(2, 1)
+	master, exception := events[0], events[1]
+	master.Recurrence = &domain.Recurrence{Rule: "FREQ=DAILY;COUNT=5"}
+	originalStart := master.StartTime.AddDate(0, 0, 2)
+	exception.StartTime = originalStart.Add(5 * time.Hour)
+	exception.EndTime = exception.StartTime.Add(30 * time.Minute)
+	exception.SeriesMasterID = master.ExchangeID
+	exception.OriginalStart = &originalStart
+	exception.IsException = true
+
+	if _, err := repo.ApplyBatch(ctx, &domain.EventBatch{CalendarID: calendar.ID, Events: events}); err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+	changes := countChanges(t, db, calendar.ID)
+
+	if err := repo.DeleteException(ctx, calendar.ID, exception.ExchangeID, master.ExchangeID, originalStart); err != nil {
+		t.Fatalf("DeleteException: %v", err)
+	}
+
+	if _, ok := storedEvents(t, db, calendar.ID)[exception.ExchangeID]; ok {
+		t.Error("exception not deleted")
+	}
+	stored, err := NewEventRepository(db).GetByID(ctx, master.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Recurrence == nil || len(stored.Recurrence.ExcludedDates) != 1 || !stored.Recurrence.ExcludedDates[0].Equal(originalStart) {
+		t.Errorf("master recurrence = %+v, want %v excluded", stored.Recurrence, originalStart)
+	}
+	// The deletion of the exception and the update of the master
+	if n := countChanges(t, db, calendar.ID) - changes; n != 2 {
+		t.Errorf("change log entries = %d, want 2", n)
+	}
+}
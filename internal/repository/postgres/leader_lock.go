@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/jmoiron/sqlx"
+)
+
+// syncLockKey is the advisory lock key shared by all replicas running the sync worker.
+const syncLockKey int64 = 0x63616c2d73796e63
+
+// advisoryLock is a LeaderLock backed by a PostgreSQL session-level advisory
+// lock. The lock lives as long as the session holding it, so a dedicated
+// connection is kept out of the pool while the lock is held. When the holder
+// dies or loses its connection the server releases the lock and another
+// replica can take it.
+type advisoryLock struct {
+	db   *sqlx.DB
+	key  int64
+	conn *sql.Conn
+}
+
+// NewSyncLock creates the leader lock guarding the sync worker.
+func NewSyncLock(db *sqlx.DB) repository.LeaderLock {
+	return &advisoryLock{db: db, key: syncLockKey}
+}
+
+func (l *advisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		// The session is gone and the lock with it
+		discard(l.conn)
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+func (l *advisoryLock) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	conn := l.conn
+	l.conn = nil
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		discard(conn)
+		return err
+	}
+	return conn.Close()
+}
+
+// discard closes the connection instead of returning it to the pool, which
+// ends the session and releases any lock it may still hold.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
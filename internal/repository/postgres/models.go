@@ -1,69 +1,416 @@
 package postgres
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // eventModel represents a database model for event.
 type eventModel struct {
-	ID          uuid.UUID  `db:"id"`
-	ExchangeID  string     `db:"exchange_id"`
-	Subject     string     `db:"subject"`
-	Body        string     `db:"body"`
-	Location    string     `db:"location"`
-	StartTime   time.Time  `db:"start_time"`
-	EndTime     time.Time  `db:"end_time"`
-	IsAllDay    bool       `db:"is_all_day"`
-	Organizer   string     `db:"organizer"`
-	Importance  string     `db:"importance"`
-	Sensitivity string     `db:"sensitivity"`
-	Status      string     `db:"status"`
-	CreatedAt   time.Time  `db:"created_at"`
-	UpdatedAt   time.Time  `db:"updated_at"`
-	SyncedAt    *time.Time `db:"synced_at"`
+	ID             uuid.UUID  `db:"id"`
+	ExchangeID     string     `db:"exchange_id"`
+	ChangeKey      string     `db:"change_key"`
+	ContentHash    string     `db:"content_hash"`
+	CalendarID     uuid.UUID  `db:"calendar_id"`
+	Subject        string     `db:"subject"`
+	Body           string     `db:"body"`
+	Location       string     `db:"location"`
+	StartTime      time.Time  `db:"start_time"`
+	EndTime        time.Time  `db:"end_time"`
+	IsAllDay       bool       `db:"is_all_day"`
+	Organizer      string     `db:"organizer"`
+	Importance     string     `db:"importance"`
+	Sensitivity    string     `db:"sensitivity"`
+	Status         string     `db:"status"`
+	TimeZone       string     `db:"time_zone"`
+	RecurrenceRule string     `db:"recurrence_rule"`
+	RecurrenceEnd  *time.Time `db:"recurrence_end"`
+	SeriesMasterID string     `db:"series_master_id"`
+	OriginalStart  *time.Time `db:"original_start"`
+	IsException    bool       `db:"is_exception"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+	SyncedAt       *time.Time `db:"synced_at"`
 }
 
 // toDomain converts database model to domain entity.
 func (m *eventModel) toDomain() *domain.Event {
+	var rec *domain.Recurrence
+	if m.RecurrenceRule != "" {
+		rec = &domain.Recurrence{Rule: m.RecurrenceRule}
+	}
+
 	return &domain.Event{
+		ID:             m.ID,
+		ExchangeID:     m.ExchangeID,
+		ChangeKey:      m.ChangeKey,
+		CalendarID:     m.CalendarID,
+		Subject:        m.Subject,
+		Body:           m.Body,
+		Location:       m.Location,
+		StartTime:      m.StartTime,
+		EndTime:        m.EndTime,
+		IsAllDay:       m.IsAllDay,
+		Organizer:      m.Organizer,
+		Importance:     m.Importance,
+		Sensitivity:    m.Sensitivity,
+		Status:         m.Status,
+		TimeZone:       m.TimeZone,
+		Recurrence:     rec,
+		SeriesMasterID: m.SeriesMasterID,
+		OriginalStart:  m.OriginalStart,
+		IsException:    m.IsException,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+		SyncedAt:       m.SyncedAt,
+	}
+}
+
+// searchEventModel is an event selected together with its full-text search
+// rank and highlights, which are only selected with a query.
+type searchEventModel struct {
+	eventModel
+	SearchRank         *float64 `db:"search_rank"`
+	SubjectHighlight   *string  `db:"subject_highlight"`
+	LocationHighlight  *string  `db:"location_highlight"`
+	OrganizerHighlight *string  `db:"organizer_highlight"`
+	BodyHighlight      *string  `db:"body_highlight"`
+}
+
+// toDomain converts database model to domain entity. Highlights of fields
+// without a match are dropped, as ts_headline returns their beginning.
+func (m *searchEventModel) toDomain() *domain.Event {
+	event := m.eventModel.toDomain()
+	if m.SearchRank == nil {
+		return event
+	}
+
+	event.Match = &domain.SearchMatch{
+		Rank:       *m.SearchRank,
+		Highlights: make(map[string]string),
+	}
+	for field, highlight := range map[string]*string{
+		"subject":   m.SubjectHighlight,
+		"location":  m.LocationHighlight,
+		"organizer": m.OrganizerHighlight,
+		"body":      m.BodyHighlight,
+	} {
+		if highlight != nil && strings.Contains(*highlight, highlightStart) {
+			event.Match.Highlights[field] = *highlight
+		}
+	}
+	return event
+}
+
+// toEventModel converts domain entity to database model.
+func toEventModel(e *domain.Event) (*eventModel, error) {
+	var rule string
+	var recurrenceEnd *time.Time
+	if e.IsSeriesMaster() {
+		rule = e.Recurrence.Rule
+
+		end, err := seriesEnd(e)
+		if err != nil {
+			return nil, err
+		}
+		recurrenceEnd = end
+	}
+
+	return &eventModel{
+		ID:             e.ID,
+		ExchangeID:     e.ExchangeID,
+		ChangeKey:      e.ChangeKey,
+		ContentHash:    contentHash(e, rule, recurrenceEnd),
+		CalendarID:     e.CalendarID,
+		Subject:        e.Subject,
+		Body:           e.Body,
+		Location:       e.Location,
+		StartTime:      e.StartTime,
+		EndTime:        e.EndTime,
+		IsAllDay:       e.IsAllDay,
+		Organizer:      e.Organizer,
+		Importance:     e.Importance,
+		Sensitivity:    e.Sensitivity,
+		Status:         e.Status,
+		TimeZone:       e.TimeZone,
+		RecurrenceRule: rule,
+		RecurrenceEnd:  recurrenceEnd,
+		SeriesMasterID: e.SeriesMasterID,
+		OriginalStart:  e.OriginalStart,
+		IsException:    e.IsException,
+		CreatedAt:      e.CreatedAt,
+		UpdatedAt:      e.UpdatedAt,
+		SyncedAt:       e.SyncedAt,
+	}, nil
+}
+
+// contentHash returns a hash of everything stored for the event, including
+// its attendees, categories and excluded dates, so that an unchanged event
+// can be recognized without comparing columns. Relations are sorted as they
+// are loaded, so that their order in the source does not matter. The change
+// key is left out: Exchange changes it with properties that are not stored,
+// which must not count as an update.
+func contentHash(e *domain.Event, rule string, recurrenceEnd *time.Time) string {
+	attendees := slices.Clone(e.Attendees)
+	slices.SortFunc(attendees, func(a, b domain.Attendee) int { return strings.Compare(a.Email, b.Email) })
+	categories := slices.Clone(e.Categories)
+	slices.Sort(categories)
+	var excluded []time.Time
+	if e.Recurrence != nil {
+		for _, d := range e.Recurrence.ExcludedDates {
+			excluded = append(excluded, d.UTC())
+		}
+		slices.SortFunc(excluded, time.Time.Compare)
+	}
+
+	content, _ := json.Marshal([]interface{}{
+		e.Subject, e.Body, e.Location,
+		e.StartTime.UTC(), e.EndTime.UTC(), e.IsAllDay, e.Organizer,
+		e.Importance, e.Sensitivity, e.Status, e.TimeZone,
+		rule, utcOrNil(recurrenceEnd), e.SeriesMasterID, utcOrNil(e.OriginalStart), e.IsException,
+		attendees, categories, excluded,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// utcOrNil returns the time in UTC, or nil.
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// seriesOf returns the recurring series defined by a series master.
+func seriesOf(e *domain.Event) recurrence.Series {
+	loc, _ := recurrence.LoadLocation(e.TimeZone)
+	return recurrence.Series{
+		Rule:          e.Recurrence.Rule,
+		Start:         e.StartTime,
+		Location:      loc,
+		ExcludedDates: e.Recurrence.ExcludedDates,
+	}
+}
+
+// seriesEnd returns the end of the last occurrence of a series master, or nil if the series never ends.
+func seriesEnd(e *domain.Event) (*time.Time, error) {
+	last, ok, err := seriesOf(e).Last()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	end := last.Add(e.EndTime.Sub(e.StartTime)).UTC()
+	return &end, nil
+}
+
+// attendeeModel represents a database model for event attendee.
+type attendeeModel struct {
+	EventID        uuid.UUID `db:"event_id"`
+	Email          string    `db:"email"`
+	Name           string    `db:"name"`
+	ResponseStatus string    `db:"response_status"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *attendeeModel) toDomain() domain.Attendee {
+	return domain.Attendee{
+		Email:          m.Email,
+		Name:           m.Name,
+		ResponseStatus: m.ResponseStatus,
+	}
+}
+
+// categoryModel represents a database model for event category.
+type categoryModel struct {
+	EventID  uuid.UUID `db:"event_id"`
+	Category string    `db:"category"`
+}
+
+// excludedDateModel represents a database model for a deleted occurrence of a series.
+type excludedDateModel struct {
+	EventID      uuid.UUID `db:"event_id"`
+	ExcludedDate time.Time `db:"excluded_date"`
+}
+
+// calendarModel represents a database model for calendar.
+type calendarModel struct {
+	ID          uuid.UUID `db:"id"`
+	Name        string    `db:"name"`
+	SourceType  string    `db:"source_type"`
+	Mailbox     string    `db:"mailbox"`
+	URL         string    `db:"url"`
+	DisplayName string    `db:"display_name"`
+	Enabled     bool      `db:"enabled"`
+	SyncDays    int       `db:"sync_days"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *calendarModel) toDomain() *domain.Calendar {
+	return &domain.Calendar{
 		ID:          m.ID,
-		ExchangeID:  m.ExchangeID,
-		Subject:     m.Subject,
-		Body:        m.Body,
-		Location:    m.Location,
-		StartTime:   m.StartTime,
-		EndTime:     m.EndTime,
-		IsAllDay:    m.IsAllDay,
-		Organizer:   m.Organizer,
-		Importance:  m.Importance,
-		Sensitivity: m.Sensitivity,
-		Status:      m.Status,
+		Name:        m.Name,
+		SourceType:  m.SourceType,
+		Mailbox:     m.Mailbox,
+		URL:         m.URL,
+		DisplayName: m.DisplayName,
+		Enabled:     m.Enabled,
+		SyncDays:    m.SyncDays,
 		CreatedAt:   m.CreatedAt,
 		UpdatedAt:   m.UpdatedAt,
-		SyncedAt:    m.SyncedAt,
 	}
 }
 
-// toEventModel converts domain entity to database model.
-func toEventModel(e *domain.Event) *eventModel {
-	return &eventModel{
-		ID:          e.ID,
-		ExchangeID:  e.ExchangeID,
-		Subject:     e.Subject,
-		Body:        e.Body,
-		Location:    e.Location,
-		StartTime:   e.StartTime,
-		EndTime:     e.EndTime,
-		IsAllDay:    e.IsAllDay,
-		Organizer:   e.Organizer,
-		Importance:  e.Importance,
-		Sensitivity: e.Sensitivity,
-		Status:      e.Status,
-		CreatedAt:   e.CreatedAt,
-		UpdatedAt:   e.UpdatedAt,
-		SyncedAt:    e.SyncedAt,
+// syncRunModel represents a database model for sync run joined with its calendar name.
+type syncRunModel struct {
+	ID           uuid.UUID  `db:"id"`
+	CalendarID   uuid.UUID  `db:"calendar_id"`
+	CalendarName string     `db:"calendar_name"`
+	TriggeredBy  string     `db:"triggered_by"`
+	Mode         string     `db:"mode"`
+	Status       string     `db:"status"`
+	RangeStart   *time.Time `db:"range_start"`
+	RangeEnd     *time.Time `db:"range_end"`
+	StartedAt    time.Time  `db:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at"`
+	Fetched      int        `db:"fetched"`
+	Created      int        `db:"created"`
+	Updated      int        `db:"updated"`
+	Unchanged    int        `db:"unchanged"`
+	Deleted      int        `db:"deleted"`
+	Failed       int        `db:"failed"`
+	Error        string     `db:"error"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *syncRunModel) toDomain() *domain.SyncRun {
+	return &domain.SyncRun{
+		ID:           m.ID,
+		CalendarID:   m.CalendarID,
+		CalendarName: m.CalendarName,
+		Trigger:      m.TriggeredBy,
+		Mode:         m.Mode,
+		Status:       m.Status,
+		RangeStart:   m.RangeStart,
+		RangeEnd:     m.RangeEnd,
+		StartedAt:    m.StartedAt,
+		FinishedAt:   m.FinishedAt,
+		Fetched:      m.Fetched,
+		Created:      m.Created,
+		Updated:      m.Updated,
+		Unchanged:    m.Unchanged,
+		Deleted:      m.Deleted,
+		Failed:       m.Failed,
+		Error:        m.Error,
+	}
+}
+
+// changeModel represents a database model for an event change log entry.
+type changeModel struct {
+	Seq        int64     `db:"seq"`
+	EventID    uuid.UUID `db:"event_id"`
+	CalendarID uuid.UUID `db:"calendar_id"`
+	ExchangeID string    `db:"exchange_id"`
+	Operation  string    `db:"operation"`
+	ChangedAt  time.Time `db:"changed_at"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *changeModel) toDomain() *domain.EventChange {
+	return &domain.EventChange{
+		Seq:        m.Seq,
+		Operation:  m.Operation,
+		EventID:    m.EventID,
+		CalendarID: m.CalendarID,
+		ExchangeID: m.ExchangeID,
+		ChangedAt:  m.ChangedAt,
+	}
+}
+
+// webhookModel represents a database model for webhook.
+type webhookModel struct {
+	ID         uuid.UUID      `db:"id"`
+	URL        string         `db:"url"`
+	Secret     string         `db:"secret"`
+	Enabled    bool           `db:"enabled"`
+	CalendarID *uuid.UUID     `db:"calendar_id"`
+	Subject    string         `db:"subject"`
+	Categories pq.StringArray `db:"categories"`
+	StartSeq   int64          `db:"start_seq"`
+	CreatedAt  time.Time      `db:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *webhookModel) toDomain() *domain.Webhook {
+	return &domain.Webhook{
+		ID:         m.ID,
+		URL:        m.URL,
+		Secret:     m.Secret,
+		Enabled:    m.Enabled,
+		CalendarID: m.CalendarID,
+		Subject:    m.Subject,
+		Categories: m.Categories,
+		StartSeq:   m.StartSeq,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+// webhookDeliveryModel represents a database model for webhook delivery,
+// joined with the URL and secret of its webhook when claimed.
+type webhookDeliveryModel struct {
+	ID             uuid.UUID  `db:"id"`
+	WebhookID      uuid.UUID  `db:"webhook_id"`
+	Status         string     `db:"status"`
+	Payload        []byte     `db:"payload"`
+	FirstSeq       int64      `db:"first_seq"`
+	LastSeq        int64      `db:"last_seq"`
+	Changes        int        `db:"changes"`
+	Attempts       int        `db:"attempts"`
+	ResponseStatus int        `db:"response_status"`
+	Error          string     `db:"error"`
+	CreatedAt      time.Time  `db:"created_at"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	LastAttemptAt  *time.Time `db:"last_attempt_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	URL            string     `db:"url"`
+	Secret         string     `db:"secret"`
+}
+
+// toDomain converts database model to domain entity.
+func (m *webhookDeliveryModel) toDomain() *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID:             m.ID,
+		WebhookID:      m.WebhookID,
+		Status:         m.Status,
+		Payload:        m.Payload,
+		FirstSeq:       m.FirstSeq,
+		LastSeq:        m.LastSeq,
+		Changes:        m.Changes,
+		Attempts:       m.Attempts,
+		ResponseStatus: m.ResponseStatus,
+		Error:          m.Error,
+		CreatedAt:      m.CreatedAt,
+		NextAttemptAt:  m.NextAttemptAt,
+		LastAttemptAt:  m.LastAttemptAt,
+		DeliveredAt:    m.DeliveredAt,
+		URL:            m.URL,
+		Secret:         m.Secret,
 	}
 }
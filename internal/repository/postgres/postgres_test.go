@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// testDSNEnv names the environment variable with the DSN of a PostgreSQL
+// database for repository tests, e.g. the one started by ./calendar.sh db-up.
+// Tests and benchmarks needing a database are skipped when it is empty.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+// testDB connects to the test database and applies the migrations.
+func testDB(tb testing.TB) *sqlx.DB {
+	tb.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSNEnv)
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		tb.Fatalf("connect: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if err := RunMigrations(db, "../../../migrations"); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+// testCalendar creates a calendar deleted with its events when the test ends.
+func testCalendar(tb testing.TB, db *sqlx.DB) *domain.Calendar {
+	tb.Helper()
+
+	calendar := &domain.Calendar{
+		Name:       "test-" + uuid.NewString(),
+		SourceType: domain.CalendarSourceExchange,
+		Enabled:    true,
+	}
+	if err := NewCalendarRepository(db).Upsert(context.Background(), calendar); err != nil {
+		tb.Fatalf("create calendar: %v", err)
+	}
+	tb.Cleanup(func() {
+		db.Exec("DELETE FROM calendars WHERE id = $1", calendar.ID)
+	})
+
+	return calendar
+}
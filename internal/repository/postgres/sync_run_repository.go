@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const syncRunsTable = "sync_runs"
+
+// syncRunColumns are the sync run columns read by the repository.
+var syncRunColumns = []string{
+	"id", "calendar_id", "triggered_by", "mode", "status", "range_start", "range_end",
+	"started_at", "finished_at",
+	"fetched", "created", "updated", "unchanged", "deleted", "failed", "error",
+}
+
+// qualifiedColumns returns the columns qualified with the table alias.
+func qualifiedColumns(alias string, columns []string) []string {
+	qualified := make([]string, len(columns))
+	for i, c := range columns {
+		qualified[i] = alias + "." + c
+	}
+	return qualified
+}
+
+type syncRunRepository struct {
+	db *sqlx.DB
+}
+
+// NewSyncRunRepository creates a new PostgreSQL sync run repository.
+func NewSyncRunRepository(db *sqlx.DB) repository.SyncRunRepository {
+	return &syncRunRepository{db: db}
+}
+
+// selectSyncRuns selects sync runs together with the names of their calendars.
+func selectSyncRuns() sq.SelectBuilder {
+	return psql.Select(append(qualifiedColumns("r", syncRunColumns), "c.name AS calendar_name")...).
+		From(syncRunsTable + " r").
+		Join(calendarsTable + " c ON c.id = r.calendar_id")
+}
+
+func (r *syncRunRepository) Create(ctx context.Context, run *domain.SyncRun) error {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+
+	query, args, err := psql.Insert(syncRunsTable).
+		Columns("id", "calendar_id", "triggered_by", "mode", "status", "range_start", "range_end", "started_at").
+		Values(run.ID, run.CalendarID, run.Trigger, run.Mode, run.Status, run.RangeStart, run.RangeEnd, run.StartedAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *syncRunRepository) Enqueue(ctx context.Context, run *domain.SyncRun) error {
+	if run.ID == uuid.Nil {
+		run.ID = uuid.New()
+	}
+	run.Status = domain.SyncRunStatusPending
+
+	query, args, err := psql.Insert(syncRunsTable).
+		Columns("id", "calendar_id", "triggered_by", "mode", "status", "range_start", "range_end", "started_at").
+		Values(run.ID, run.CalendarID, run.Trigger, run.Mode, run.Status, run.RangeStart, run.RangeEnd, run.StartedAt).
+		Suffix(`ON CONFLICT (
+				calendar_id,
+				COALESCE(range_start, '-infinity'::timestamptz),
+				COALESCE(range_end, 'infinity'::timestamptz)
+			) WHERE status = 'pending'
+			DO UPDATE SET status = EXCLUDED.status
+			RETURNING id, started_at`).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	// On conflict the pending run keeps its ID
+	return r.db.QueryRowxContext(ctx, query, args...).Scan(&run.ID, &run.StartedAt)
+}
+
+func (r *syncRunRepository) ClaimPending(ctx context.Context) ([]*domain.SyncRun, error) {
+	query := `WITH claimed AS (
+			UPDATE sync_runs SET status = $1, started_at = NOW()
+			WHERE status = $2
+			RETURNING ` + strings.Join(syncRunColumns, ", ") + `
+		)
+		SELECT ` + strings.Join(qualifiedColumns("claimed", syncRunColumns), ", ") + `, c.name AS calendar_name
+		FROM claimed JOIN calendars c ON c.id = claimed.calendar_id
+		ORDER BY claimed.started_at`
+
+	var models []syncRunModel
+	if err := r.db.SelectContext(ctx, &models, query, domain.SyncRunStatusRunning, domain.SyncRunStatusPending); err != nil {
+		return nil, err
+	}
+
+	runs := make([]*domain.SyncRun, len(models))
+	for i, m := range models {
+		runs[i] = m.toDomain()
+	}
+
+	return runs, nil
+}
+
+func (r *syncRunRepository) FailStale(ctx context.Context, startedBefore time.Time, reason string) (int64, error) {
+	query, args, err := psql.Update(syncRunsTable).
+		Set("status", domain.SyncRunStatusFailed).
+		Set("finished_at", time.Now()).
+		Set("error", reason).
+		Where(sq.Eq{"status": domain.SyncRunStatusRunning}).
+		Where(sq.Lt{"started_at": startedBefore}).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *syncRunRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.SyncRun, error) {
+	query, args, err := selectSyncRuns().Where(sq.Eq{"r.id": id}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var model syncRunModel
+	if err := r.db.GetContext(ctx, &model, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSyncRunNotFound
+		}
+		return nil, err
+	}
+
+	return model.toDomain(), nil
+}
+
+func (r *syncRunRepository) Update(ctx context.Context, run *domain.SyncRun) error {
+	query, args, err := psql.Update(syncRunsTable).
+		SetMap(map[string]interface{}{
+			"mode":        run.Mode,
+			"status":      run.Status,
+			"finished_at": run.FinishedAt,
+			"fetched":     run.Fetched,
+			"created":     run.Created,
+			"updated":     run.Updated,
+			"unchanged":   run.Unchanged,
+			"deleted":     run.Deleted,
+			"failed":      run.Failed,
+			"error":       run.Error,
+		}).
+		Where(sq.Eq{"id": run.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *syncRunRepository) List(ctx context.Context, filter domain.SyncRunFilter) ([]*domain.SyncRun, error) {
+	builder := applySyncRunFilter(selectSyncRuns(), filter).OrderBy("r.started_at DESC")
+
+	if filter.Limit > 0 {
+		builder = builder.Limit(uint64(filter.Limit))
+	}
+
+	if filter.Offset > 0 {
+		builder = builder.Offset(uint64(filter.Offset))
+	}
+
+	return r.selectRuns(ctx, builder)
+}
+
+func (r *syncRunRepository) Count(ctx context.Context, filter domain.SyncRunFilter) (int64, error) {
+	query, args, err := applySyncRunFilter(psql.Select("COUNT(*)").From(syncRunsTable+" r"), filter).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, args...); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *syncRunRepository) ListLatest(ctx context.Context) ([]*domain.SyncRun, error) {
+	builder := selectSyncRuns().
+		Options("DISTINCT ON (r.calendar_id, r.status, r.triggered_by)").
+		OrderBy("r.calendar_id", "r.status", "r.triggered_by", "r.started_at DESC")
+
+	return r.selectRuns(ctx, builder)
+}
+
+func (r *syncRunRepository) DeleteBefore(ctx context.Context, before time.Time) error {
+	// Pending and running runs are kept until they finish, so a requested
+	// run is never dropped before it is claimed
+	query, args, err := psql.Delete(syncRunsTable).
+		Where(sq.Lt{"started_at": before}).
+		Where(sq.Eq{"status": []string{domain.SyncRunStatusSucceeded, domain.SyncRunStatusFailed}}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *syncRunRepository) selectRuns(ctx context.Context, builder sq.SelectBuilder) ([]*domain.SyncRun, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []syncRunModel
+	if err := r.db.SelectContext(ctx, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	runs := make([]*domain.SyncRun, len(models))
+	for i, m := range models {
+		runs[i] = m.toDomain()
+	}
+
+	return runs, nil
+}
+
+// applySyncRunFilter applies sync run filters to the query builder.
+func applySyncRunFilter(b sq.SelectBuilder, f domain.SyncRunFilter) sq.SelectBuilder {
+	if f.CalendarID != nil {
+		b = b.Where(sq.Eq{"r.calendar_id": *f.CalendarID})
+	}
+	if f.Status != "" {
+		b = b.Where(sq.Eq{"r.status": f.Status})
+	}
+	return b
+}
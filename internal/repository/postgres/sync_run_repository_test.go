@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+)
+
+func TestSyncRunDeleteBefore(t *testing.T) {
+	db := testDB(t)
+	calendar := testCalendar(t, db)
+	repo := NewSyncRunRepository(db)
+	ctx := context.Background()
+
+	started := time.Now().Add(-48 * time.Hour)
+	runs := make(map[string]*domain.SyncRun)
+	for _, status := range []string{
+		domain.SyncRunStatusPending,
+		domain.SyncRunStatusRunning,
+		domain.SyncRunStatusSucceeded,
+		domain.SyncRunStatusFailed,
+	} {
+		run := &domain.SyncRun{
+			CalendarID: calendar.ID,
+			Trigger:    domain.SyncTriggerManual,
+			Mode:       "full",
+			Status:     status,
+			StartedAt:  started,
+		}
+		if err := repo.Create(ctx, run); err != nil {
+			t.Fatalf("create %s run: %v", status, err)
+		}
+		runs[status] = run
+	}
+
+	if err := repo.DeleteBefore(ctx, time.Now().Add(-24*time.Hour)); err != nil {
+		t.Fatalf("DeleteBefore: %v", err)
+	}
+
+	for status, run := range runs {
+		_, err := repo.GetByID(ctx, run.ID)
+		finished := status == domain.SyncRunStatusSucceeded || status == domain.SyncRunStatusFailed
+		switch {
+		case finished && !errors.Is(err, domain.ErrSyncRunNotFound):
+			t.Errorf("%s run not deleted: %v", status, err)
+		case !finished && err != nil:
+			t.Errorf("%s run deleted: %v", status, err)
+		}
+	}
+}
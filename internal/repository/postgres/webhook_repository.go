@@ -0,0 +1,352 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	webhooksTable          = "webhooks"
+	webhookDeliveriesTable = "webhook_deliveries"
+	webhookCursorTable     = "webhook_cursor"
+)
+
+// webhookColumns are the webhook columns read by the repository.
+var webhookColumns = []string{
+	"id", "url", "secret", "enabled", "calendar_id", "subject", "categories",
+	"start_seq", "created_at", "updated_at",
+}
+
+// webhookDeliveryColumns are the webhook delivery columns read by the repository.
+var webhookDeliveryColumns = []string{
+	"id", "webhook_id", "status", "payload", "first_seq", "last_seq", "changes",
+	"attempts", "response_status", "error",
+	"created_at", "next_attempt_at", "last_attempt_at", "delivered_at",
+}
+
+type webhookRepository struct {
+	db *sqlx.DB
+}
+
+// NewWebhookRepository creates a new PostgreSQL webhook repository.
+func NewWebhookRepository(db *sqlx.DB) repository.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	now := time.Now()
+	if webhook.ID == uuid.Nil {
+		webhook.ID = uuid.New()
+	}
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	// The webhook receives the changes logged after the current end of the
+	// log. Changes are logged in sequence order, so none logged later can
+	// have a lower sequence number.
+	query, args, err := psql.Insert(webhooksTable).
+		Columns("id", "url", "secret", "enabled", "calendar_id", "subject", "categories", "start_seq", "created_at", "updated_at").
+		Values(
+			webhook.ID, webhook.URL, webhook.Secret, webhook.Enabled, webhook.CalendarID,
+			webhook.Subject, pq.StringArray(webhook.Categories),
+			sq.Expr("(SELECT COALESCE(MAX(seq), 0) FROM "+changesTable+")"),
+			webhook.CreatedAt, webhook.UpdatedAt,
+		).
+		Suffix("RETURNING start_seq").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return r.db.GetContext(ctx, &webhook.StartSeq, query, args...)
+}
+
+func (r *webhookRepository) Update(ctx context.Context, webhook *domain.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+
+	query, args, err := psql.Update(webhooksTable).
+		SetMap(map[string]interface{}{
+			"url":         webhook.URL,
+			"secret":      webhook.Secret,
+			"enabled":     webhook.Enabled,
+			"calendar_id": webhook.CalendarID,
+			"subject":     webhook.Subject,
+			"categories":  pq.StringArray(webhook.Categories),
+			"updated_at":  webhook.UpdatedAt,
+		}).
+		Where(sq.Eq{"id": webhook.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return execAffecting(ctx, r.db, domain.ErrWebhookNotFound, query, args...)
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query, args, err := psql.Delete(webhooksTable).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return execAffecting(ctx, r.db, domain.ErrWebhookNotFound, query, args...)
+}
+
+func (r *webhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	query, args, err := psql.Select(webhookColumns...).From(webhooksTable).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var model webhookModel
+	if err := r.db.GetContext(ctx, &model, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	return model.toDomain(), nil
+}
+
+func (r *webhookRepository) List(ctx context.Context) ([]*domain.Webhook, error) {
+	return listWebhooks(ctx, r.db, psql.Select(webhookColumns...).From(webhooksTable).OrderBy("created_at ASC"))
+}
+
+func listWebhooks(ctx context.Context, db sqlx.QueryerContext, builder sq.SelectBuilder) ([]*domain.Webhook, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []webhookModel
+	if err := sqlx.SelectContext(ctx, db, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*domain.Webhook, len(models))
+	for i, m := range models {
+		webhooks[i] = m.toDomain()
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepository) Dispatch(ctx context.Context, limit int, build func(webhooks []*domain.Webhook, changes []*domain.EventChange) ([]*domain.WebhookDelivery, error)) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The row lock makes concurrent dispatchers wait for each other
+	var cursor int64
+	if err := tx.GetContext(ctx, &cursor, "SELECT seq FROM "+webhookCursorTable+" FOR UPDATE"); err != nil {
+		return 0, err
+	}
+
+	changes, err := listChanges(ctx, tx, domain.ChangeFilter{Since: cursor, Limit: limit})
+	if err != nil {
+		return 0, err
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	webhooks, err := listWebhooks(ctx, tx, psql.Select(webhookColumns...).From(webhooksTable).
+		Where(sq.Eq{"enabled": true}).
+		OrderBy("created_at ASC"))
+	if err != nil {
+		return 0, err
+	}
+
+	deliveries, err := build(webhooks, changes)
+	if err != nil {
+		return 0, err
+	}
+
+	// The payload is passed as text, as byte slices are sent as bytea
+	rows := make([][]interface{}, len(deliveries))
+	for i, d := range deliveries {
+		if d.ID == uuid.Nil {
+			d.ID = uuid.New()
+		}
+		rows[i] = []interface{}{
+			d.ID, d.WebhookID, d.Status, string(d.Payload), d.FirstSeq, d.LastSeq, d.Changes, d.CreatedAt, d.NextAttemptAt,
+		}
+	}
+	if err := insertRows(ctx, tx, webhookDeliveriesTable, []string{
+		"id", "webhook_id", "status", "payload", "first_seq", "last_seq", "changes", "created_at", "next_attempt_at",
+	}, rows); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE "+webhookCursorTable+" SET seq = $1", changes[len(changes)-1].Seq); err != nil {
+		return 0, err
+	}
+
+	return len(changes), tx.Commit()
+}
+
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	// Locked rows are being claimed by another replica and are skipped
+	query := `WITH due AS (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = $1 AND d.next_attempt_at <= NOW() AND w.enabled
+			ORDER BY d.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET
+			attempts = d.attempts + 1,
+			next_attempt_at = NOW() + make_interval(secs => $3)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING ` + strings.Join(qualifiedColumns("d", webhookDeliveryColumns), ", ") + `, w.url, w.secret`
+
+	var models []webhookDeliveryModel
+	if err := r.db.SelectContext(ctx, &models, query, domain.WebhookDeliveryPending, limit, lease.Seconds()); err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*domain.WebhookDelivery, len(models))
+	for i, m := range models {
+		deliveries[i] = m.toDomain()
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query, args, err := psql.Update(webhookDeliveriesTable).
+		SetMap(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"response_status": delivery.ResponseStatus,
+			"error":           delivery.Error,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"last_attempt_at": delivery.LastAttemptAt,
+			"delivered_at":    delivery.DeliveredAt,
+		}).
+		Where(sq.Eq{"id": delivery.ID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return execAffecting(ctx, r.db, domain.ErrDeliveryNotFound, query, args...)
+}
+
+func (r *webhookRepository) GetDelivery(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	query, args, err := psql.Select(webhookDeliveryColumns...).From(webhookDeliveriesTable).
+		Where(sq.Eq{"id": id, "webhook_id": webhookID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var model webhookDeliveryModel
+	if err := r.db.GetContext(ctx, &model, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return model.toDomain(), nil
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, error) {
+	builder := applyDeliveryFilter(psql.Select(webhookDeliveryColumns...).From(webhookDeliveriesTable), filter).
+		OrderBy("created_at DESC")
+
+	if filter.Limit > 0 {
+		builder = builder.Limit(uint64(filter.Limit))
+	}
+
+	if filter.Offset > 0 {
+		builder = builder.Offset(uint64(filter.Offset))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var models []webhookDeliveryModel
+	if err := r.db.SelectContext(ctx, &models, query, args...); err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*domain.WebhookDelivery, len(models))
+	for i, m := range models {
+		deliveries[i] = m.toDomain()
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) CountDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) (int64, error) {
+	query, args, err := applyDeliveryFilter(psql.Select("COUNT(*)").From(webhookDeliveriesTable), filter).ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, query, args...); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *webhookRepository) DeleteDeliveriesBefore(ctx context.Context, before time.Time) error {
+	query, args, err := psql.Delete(webhookDeliveriesTable).
+		Where(sq.NotEq{"status": domain.WebhookDeliveryPending}).
+		Where(sq.Lt{"created_at": before}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// applyDeliveryFilter applies webhook delivery filters to the query builder.
+func applyDeliveryFilter(b sq.SelectBuilder, f domain.WebhookDeliveryFilter) sq.SelectBuilder {
+	b = b.Where(sq.Eq{"webhook_id": f.WebhookID})
+	if f.Status != "" {
+		b = b.Where(sq.Eq{"status": f.Status})
+	}
+	return b
+}
+
+// execAffecting executes a statement and returns notFound if it affected no rows.
+func execAffecting(ctx context.Context, db sqlx.ExecerContext, notFound error, query string, args ...interface{}) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/anmaslov/calendar/internal/domain"
 	"github.com/google/uuid"
@@ -17,13 +18,165 @@ type EventRepository interface {
 
 	// Count returns the total number of events matching the filter.
 	Count(ctx context.Context, filter domain.EventFilter) (int64, error)
+
+	// ListSeriesMasters retrieves series masters whose series span overlaps the filter date range.
+	ListSeriesMasters(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, error)
+
+	// ListExceptionStarts returns original start times of exceptions grouped by series master ID.
+	ListExceptionStarts(ctx context.Context, masters []*domain.Event) (map[uuid.UUID][]time.Time, error)
 }
 
 // EventSyncRepository defines the interface for event sync operations (write).
+// Every change of an event is recorded in the event change log in the same
+// transaction.
 type EventSyncRepository interface {
-	// Upsert creates or updates an event based on Exchange ID.
-	Upsert(ctx context.Context, event *domain.Event) error
+	// Upsert creates or updates an event based on its calendar and Exchange ID
+	// and reports whether the event was created.
+	Upsert(ctx context.Context, event *domain.Event) (bool, error)
+
+	// ApplyBatch applies the changes of one sync cycle of a calendar in a
+	// single transaction. Events that cannot be stored are skipped and reported
+	// in the result.
+	ApplyBatch(ctx context.Context, batch *domain.EventBatch) (*domain.EventBatchResult, error)
+
+	// DeleteByExchangeIDs deletes events of the calendar with the provided
+	// Exchange IDs and returns the number of deleted events.
+	DeleteByExchangeIDs(ctx context.Context, calendarID uuid.UUID, exchangeIDs []string) (int64, error)
+
+	// DeleteException deletes an exception of a recurring series and adds its
+	// original start to the excluded dates of the stored series master, so
+	// the deleted occurrence is not expanded again.
+	DeleteException(ctx context.Context, calendarID uuid.UUID, exchangeID, seriesMasterID string, originalStart time.Time) error
+
+	// GetSyncState returns the stored incremental sync state for a calendar, or empty string if none.
+	GetSyncState(ctx context.Context, calendarID uuid.UUID) (string, error)
+}
+
+// ChangeRepository defines the interface for reading the event change log.
+// Changes are written by EventSyncRepository along with the events.
+type ChangeRepository interface {
+	// List retrieves changes after filter.Since, oldest first, together with
+	// the current state of the changed events that still exist.
+	List(ctx context.Context, filter domain.ChangeFilter) ([]*domain.EventChange, error)
+
+	// LastSeq returns the sequence number of the latest change, or 0 if none.
+	LastSeq(ctx context.Context) (int64, error)
+
+	// DeleteBefore deletes changes made before the given time.
+	DeleteBefore(ctx context.Context, before time.Time) error
+}
+
+// ChangeNotifier delivers notifications of changes committed by any replica.
+type ChangeNotifier interface {
+	// Listen calls notify after changes were committed until ctx is done or
+	// listening fails. Notifications carry no data and may be spurious, e.g.
+	// after a reconnect during which changes could have been missed.
+	Listen(ctx context.Context, notify func()) error
+}
+
+// WebhookRepository defines the interface for webhook subscriptions and
+// their deliveries.
+type WebhookRepository interface {
+	// Create stores a new webhook.
+	Create(ctx context.Context, webhook *domain.Webhook) error
+
+	// Update stores the URL, secret, state and filter of a webhook.
+	Update(ctx context.Context, webhook *domain.Webhook) error
+
+	// Delete deletes a webhook together with its deliveries.
+	Delete(ctx context.Context, id uuid.UUID) error
+
+	// GetByID retrieves a webhook by its ID.
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+
+	// List retrieves all webhooks, oldest first.
+	List(ctx context.Context) ([]*domain.Webhook, error)
+
+	// Dispatch reads up to limit changes after the dispatch cursor, stores the
+	// deliveries build creates from them for the enabled webhooks and advances
+	// the cursor in one transaction. Concurrent calls wait for each other, so
+	// every change is dispatched once. It returns the number of changes read.
+	Dispatch(ctx context.Context, limit int, build func(webhooks []*domain.Webhook, changes []*domain.EventChange) ([]*domain.WebhookDelivery, error)) (int, error)
+
+	// ClaimDeliveries returns up to limit due pending deliveries of enabled
+	// webhooks. Their next attempt is postponed by lease, so that no other
+	// replica sends them meanwhile.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error)
+
+	// UpdateDelivery stores the status, attempts and last result of a delivery.
+	UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+
+	// GetDelivery retrieves a delivery of a webhook by its ID.
+	GetDelivery(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error)
+
+	// ListDeliveries retrieves deliveries based on filter criteria, latest first.
+	ListDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, error)
+
+	// CountDeliveries returns the total number of deliveries matching the filter.
+	CountDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) (int64, error)
+
+	// DeleteDeliveriesBefore deletes delivered and dead deliveries created before the given time.
+	DeleteDeliveriesBefore(ctx context.Context, before time.Time) error
+}
+
+// CalendarRepository defines the interface for calendar data access.
+type CalendarRepository interface {
+	// GetByID retrieves a calendar by its ID.
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Calendar, error)
+
+	// List retrieves all calendars ordered by name.
+	List(ctx context.Context) ([]*domain.Calendar, error)
+
+	// Upsert creates or updates a calendar based on its name.
+	Upsert(ctx context.Context, calendar *domain.Calendar) error
+
+	// DisableExcept disables enabled calendars whose names are not in the
+	// list and returns the names of the disabled calendars.
+	DisableExcept(ctx context.Context, names []string) ([]string, error)
+}
+
+// SyncRunRepository defines the interface for sync run history.
+type SyncRunRepository interface {
+	// Create stores a new sync run.
+	Create(ctx context.Context, run *domain.SyncRun) error
+
+	// Update stores the mode, status, counts and end of a sync run.
+	Update(ctx context.Context, run *domain.SyncRun) error
+
+	// Enqueue stores a pending run. If a pending run for the same calendar and
+	// range already exists, run receives its ID and start time instead.
+	Enqueue(ctx context.Context, run *domain.SyncRun) error
+
+	// ClaimPending marks all pending runs as running and returns them.
+	ClaimPending(ctx context.Context) ([]*domain.SyncRun, error)
+
+	// FailStale marks runs still running that started before the given time
+	// as failed with the reason and returns their number.
+	FailStale(ctx context.Context, startedBefore time.Time, reason string) (int64, error)
+
+	// GetByID retrieves a sync run by its ID.
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.SyncRun, error)
+
+	// List retrieves sync runs based on filter criteria, latest first.
+	List(ctx context.Context, filter domain.SyncRunFilter) ([]*domain.SyncRun, error)
+
+	// Count returns the total number of sync runs matching the filter.
+	Count(ctx context.Context, filter domain.SyncRunFilter) (int64, error)
+
+	// ListLatest returns the latest run of every calendar for each status and trigger.
+	ListLatest(ctx context.Context) ([]*domain.SyncRun, error)
+
+	// DeleteBefore deletes finished runs started before the given time.
+	DeleteBefore(ctx context.Context, before time.Time) error
+}
+
+// LeaderLock is a cluster-wide lock held by at most one replica at a time.
+// Implementations are not safe for concurrent use.
+type LeaderLock interface {
+	// TryAcquire takes the lock without waiting, or confirms it is still held,
+	// and reports whether this replica holds it.
+	TryAcquire(ctx context.Context) (bool, error)
 
-	// DeleteNotInExchangeIDs deletes events not in the provided Exchange IDs list.
-	DeleteNotInExchangeIDs(ctx context.Context, exchangeIDs []string) error
+	// Release releases the lock if it is held.
+	Release(ctx context.Context) error
 }
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"go.uber.org/zap"
+)
+
+type calendarService struct {
+	repo   repository.CalendarRepository
+	logger *zap.Logger
+}
+
+// NewCalendarService creates a new calendar service.
+func NewCalendarService(repo repository.CalendarRepository, logger *zap.Logger) CalendarService {
+	return &calendarService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *calendarService) ListCalendars(ctx context.Context) ([]*domain.Calendar, error) {
+	calendars, err := s.repo.List(ctx)
+	if err != nil {
+		s.logger.Error("failed to list calendars", zap.Error(err))
+		return nil, err
+	}
+
+	return calendars, nil
+}
+
+func (s *calendarService) EnsureCalendars(ctx context.Context, calendars []*domain.Calendar) error {
+	names := make([]string, len(calendars))
+	for i, cal := range calendars {
+		if err := s.repo.Upsert(ctx, cal); err != nil {
+			s.logger.Error("failed to save calendar", zap.String("name", cal.Name), zap.Error(err))
+			return err
+		}
+		names[i] = cal.Name
+	}
+
+	// Calendars removed from the configuration, including the default one
+	// created by migrations, are kept with their events but no longer synced
+	disabled, err := s.repo.DisableExcept(ctx, names)
+	if err != nil {
+		s.logger.Error("failed to disable calendars", zap.Error(err))
+		return err
+	}
+	for _, name := range disabled {
+		s.logger.Info("calendar is not configured, disabled", zap.String("name", name))
+	}
+
+	return nil
+}
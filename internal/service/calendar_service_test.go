@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeCalendarRepository keeps calendars by name.
+type fakeCalendarRepository struct {
+	repository.CalendarRepository
+	calendars map[string]*domain.Calendar
+}
+
+func (r *fakeCalendarRepository) Upsert(_ context.Context, calendar *domain.Calendar) error {
+	if stored, ok := r.calendars[calendar.Name]; ok {
+		calendar.ID = stored.ID
+	} else if calendar.ID == uuid.Nil {
+		calendar.ID = uuid.New()
+	}
+	stored := *calendar
+	r.calendars[calendar.Name] = &stored
+	return nil
+}
+
+func (r *fakeCalendarRepository) DisableExcept(_ context.Context, names []string) ([]string, error) {
+	var disabled []string
+	for name, cal := range r.calendars {
+		if cal.Enabled && !slices.Contains(names, name) {
+			cal.Enabled = false
+			disabled = append(disabled, name)
+		}
+	}
+	return disabled, nil
+}
+
+func TestEnsureCalendars(t *testing.T) {
+	// The exchange calendar is created by migrations for events synced
+	// before calendars were configured
+	exchangeID := uuid.New()
+	repo := &fakeCalendarRepository{calendars: map[string]*domain.Calendar{
+		"exchange": {ID: exchangeID, Name: "exchange", SourceType: domain.CalendarSourceExchange, Enabled: true},
+		"holidays": {ID: uuid.New(), Name: "holidays", SourceType: domain.CalendarSourceICal, Enabled: true},
+	}}
+	svc := NewCalendarService(repo, zap.NewNop())
+
+	err := svc.EnsureCalendars(context.Background(), []*domain.Calendar{
+		{Name: "team", SourceType: domain.CalendarSourceExchange, Mailbox: "team@example.com", Enabled: true},
+		{Name: "holidays", SourceType: domain.CalendarSourceICal, URL: "https://example.com/holidays.ics", Enabled: true},
+		{Name: "archive", SourceType: domain.CalendarSourceExchange, Mailbox: "archive@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("EnsureCalendars: %v", err)
+	}
+
+	want := map[string]bool{"exchange": false, "team": true, "holidays": true, "archive": false}
+	if len(repo.calendars) != len(want) {
+		t.Errorf("calendars = %d, want %d", len(repo.calendars), len(want))
+	}
+	for name, enabled := range want {
+		cal, ok := repo.calendars[name]
+		if !ok {
+			t.Errorf("calendar %s not stored", name)
+			continue
+		}
+		if cal.Enabled != enabled {
+			t.Errorf("calendar %s enabled = %t, want %t", name, cal.Enabled, enabled)
+		}
+	}
+
+	// Disabled calendars keep their IDs and with them their events
+	if id := repo.calendars["exchange"].ID; id != exchangeID {
+		t.Errorf("exchange calendar ID changed from %s to %s", exchangeID, id)
+	}
+	if url := repo.calendars["holidays"].URL; url != "https://example.com/holidays.ics" {
+		t.Errorf("holidays calendar URL = %q, not updated", url)
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	gosync "sync"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// changePageSize is the number of changes read from the change log at once.
+	changePageSize = 500
+	// subscriberBuffer is the number of changes a subscriber may lag behind
+	// before it is dropped.
+	subscriberBuffer = 256
+	// changePollInterval bounds the delay of changes whose notification was lost.
+	changePollInterval = 30 * time.Second
+	// listenRetryInterval is the delay before listening again after a failure.
+	listenRetryInterval = 5 * time.Second
+)
+
+// ChangeBroker fans out event changes committed on any replica to in-process
+// subscribers. It is woken by the change notifier and reads new changes from
+// the change log once for all subscribers. A subscriber that does not keep up
+// is dropped by closing its channel; it can resume from the change log.
+type ChangeBroker struct {
+	repo     repository.ChangeRepository
+	notifier repository.ChangeNotifier
+	logger   *zap.Logger
+	wakeCh   chan struct{}
+
+	mu      gosync.Mutex
+	subs    map[chan *domain.EventChange]struct{}
+	stopped bool
+}
+
+// NewChangeBroker creates a change broker. It delivers nothing until started.
+func NewChangeBroker(repo repository.ChangeRepository, notifier repository.ChangeNotifier, logger *zap.Logger) *ChangeBroker {
+	return &ChangeBroker{
+		repo:     repo,
+		notifier: notifier,
+		logger:   logger,
+		wakeCh:   make(chan struct{}, 1),
+		subs:     make(map[chan *domain.EventChange]struct{}),
+	}
+}
+
+// Start listens for changes in the background until ctx is done. Then all
+// subscriptions are closed.
+func (b *ChangeBroker) Start(ctx context.Context) {
+	go b.listen(ctx)
+	go b.run(ctx)
+}
+
+// wake makes the broker read new changes.
+func (b *ChangeBroker) wake() {
+	select {
+	case b.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (b *ChangeBroker) listen(ctx context.Context) {
+	for {
+		err := b.notifier.Listen(ctx, b.wake)
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Error("failed to listen for event changes", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+		// Changes committed meanwhile were not announced
+		b.wake()
+	}
+}
+
+func (b *ChangeBroker) run(ctx context.Context) {
+	defer b.stop()
+
+	lastSeq, err := b.lastSeq(ctx)
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(changePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.wakeCh:
+		case <-ticker.C:
+		}
+
+		lastSeq = b.publishAfter(ctx, lastSeq)
+	}
+}
+
+// lastSeq returns the latest sequence number, retrying until it is read or
+// ctx is done. Only changes after it are published.
+func (b *ChangeBroker) lastSeq(ctx context.Context) (int64, error) {
+	for {
+		seq, err := b.repo.LastSeq(ctx)
+		if err == nil {
+			return seq, nil
+		}
+		b.logger.Error("failed to read change log position", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+// publishAfter publishes the changes after seq and returns the last published
+// sequence number.
+func (b *ChangeBroker) publishAfter(ctx context.Context, seq int64) int64 {
+	for {
+		changes, err := b.repo.List(ctx, domain.ChangeFilter{Since: seq, Limit: changePageSize})
+		if err != nil {
+			if ctx.Err() == nil {
+				b.logger.Error("failed to read event changes", zap.Int64("since", seq), zap.Error(err))
+			}
+			return seq
+		}
+
+		b.publish(changes)
+		if len(changes) > 0 {
+			seq = changes[len(changes)-1].Seq
+		}
+		if len(changes) < changePageSize {
+			return seq
+		}
+	}
+}
+
+func (b *ChangeBroker) publish(changes []*domain.EventChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range changes {
+		for ch := range b.subs {
+			select {
+			case ch <- c:
+			default:
+				b.logger.Warn("dropping slow change subscriber", zap.Int64("seq", c.Seq))
+				delete(b.subs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// subscribe registers a subscriber for changes published from now on. The
+// returned function cancels the subscription.
+func (b *ChangeBroker) subscribe() (<-chan *domain.EventChange, func()) {
+	ch := make(chan *domain.EventChange, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// stop closes all subscriptions and rejects new ones.
+func (b *ChangeBroker) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stopped = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
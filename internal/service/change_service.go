@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"go.uber.org/zap"
+)
+
+type changeService struct {
+	repo   repository.ChangeRepository
+	broker *ChangeBroker
+	logger *zap.Logger
+}
+
+// NewChangeService creates a new change feed service streaming live changes from broker.
+func NewChangeService(repo repository.ChangeRepository, broker *ChangeBroker, logger *zap.Logger) ChangeService {
+	return &changeService{
+		repo:   repo,
+		broker: broker,
+		logger: logger,
+	}
+}
+
+func (s *changeService) ListChanges(ctx context.Context, filter domain.ChangeFilter) (*domain.ChangePage, error) {
+	// One change more than requested tells whether another page follows
+	query := filter
+	query.Limit = filter.Limit + 1
+
+	changes, err := s.repo.List(ctx, query)
+	if err != nil {
+		s.logger.Error("failed to list changes", zap.Int64("since", filter.Since), zap.Error(err))
+		return nil, err
+	}
+
+	page := &domain.ChangePage{
+		Changes:   changes,
+		NextSince: filter.Since,
+	}
+	if len(changes) > filter.Limit {
+		page.Changes = changes[:filter.Limit]
+		page.HasMore = true
+	}
+	if len(page.Changes) > 0 {
+		page.NextSince = page.Changes[len(page.Changes)-1].Seq
+	}
+
+	return page, nil
+}
+
+func (s *changeService) Subscribe(ctx context.Context, filter domain.EventFilter, since *int64) <-chan *domain.EventChange {
+	// Subscribe before catching up, so that no change falls in between
+	live, unsubscribe := s.broker.subscribe()
+	out := make(chan *domain.EventChange)
+
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		var last int64
+		send := func(c *domain.EventChange) bool {
+			last = c.Seq
+			if !c.Matches(filter) {
+				return true
+			}
+			select {
+			case out <- c:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if since != nil {
+			last = *since
+			for {
+				changes, err := s.repo.List(ctx, domain.ChangeFilter{Since: last, Limit: changePageSize})
+				if err != nil {
+					if ctx.Err() == nil {
+						s.logger.Error("failed to read event changes", zap.Int64("since", last), zap.Error(err))
+					}
+					return
+				}
+				for _, c := range changes {
+					if !send(c) {
+						return
+					}
+				}
+				if len(changes) < changePageSize {
+					break
+				}
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok := <-live:
+				if !ok {
+					return
+				}
+				// Already sent while catching up
+				if c.Seq <= last {
+					continue
+				}
+				if !send(c) {
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
@@ -2,23 +2,50 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
 	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/anmaslov/calendar/internal/sync"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+const (
+	maxSubjectLength  = 500
+	maxLocationLength = 500
+	maxCategoryLength = 100
+)
+
 type eventService struct {
-	repo   repository.EventRepository
-	logger *zap.Logger
+	repo         repository.EventRepository
+	syncRepo     repository.EventSyncRepository
+	calendarRepo repository.CalendarRepository
+	sources      sync.SourceFactory
+	logger       *zap.Logger
 }
 
-// NewEventService creates a new event service.
-func NewEventService(repo repository.EventRepository, logger *zap.Logger) EventService {
+// NewEventService creates a new event service. Writes are pushed to the
+// Exchange mailbox of the event's calendar first and the resulting events are
+// stored through the sync repository.
+func NewEventService(
+	repo repository.EventRepository,
+	syncRepo repository.EventSyncRepository,
+	calendarRepo repository.CalendarRepository,
+	sources sync.SourceFactory,
+	logger *zap.Logger,
+) EventService {
 	return &eventService{
-		repo:   repo,
-		logger: logger,
+		repo:         repo,
+		syncRepo:     syncRepo,
+		calendarRepo: calendarRepo,
+		sources:      sources,
+		logger:       logger,
 	}
 }
 
@@ -32,18 +59,276 @@ func (s *eventService) GetEvent(ctx context.Context, id uuid.UUID) (*domain.Even
 	return event, nil
 }
 
-func (s *eventService) ListEvents(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, int64, error) {
-	events, err := s.repo.List(ctx, filter)
+func (s *eventService) ListEvents(ctx context.Context, filter domain.EventFilter) (*domain.EventPage, error) {
+	if filter.ExpandRecurring && filter.StartDate != nil && filter.EndDate != nil {
+		return s.listExpanded(ctx, filter)
+	}
+
+	// One more event tells whether a next page exists
+	paged := filter
+	if filter.Limit > 0 {
+		paged.Limit = filter.Limit + 1
+	}
+
+	events, err := s.repo.List(ctx, paged)
 	if err != nil {
 		s.logger.Error("failed to list events", zap.Error(err))
-		return nil, 0, err
+		return nil, err
+	}
+
+	page := newEventPage(events, filter.Limit)
+	if filter.SkipCount {
+		return page, nil
 	}
 
 	count, err := s.repo.Count(ctx, filter)
 	if err != nil {
 		s.logger.Error("failed to count events", zap.Error(err))
-		return nil, 0, err
+		return nil, err
+	}
+	page.Total = &count
+
+	return page, nil
+}
+
+// newEventPage returns a page of at most limit events, with a cursor of the
+// next page if more events follow.
+func newEventPage(events []*domain.Event, limit int) *domain.EventPage {
+	page := &domain.EventPage{Events: events}
+	if limit > 0 && len(events) > limit {
+		page.Events = events[:limit]
+		page.Next = domain.NewEventCursor(events[limit-1])
+	}
+	return page
+}
+
+func (s *eventService) CreateEvent(ctx context.Context, calendarID uuid.UUID, input domain.EventInput) (*domain.Event, error) {
+	if input.Subject == nil || input.StartTime == nil || input.EndTime == nil {
+		return nil, fmt.Errorf("%w: subject, start_time and end_time are required", domain.ErrInvalidInput)
+	}
+
+	cal, err := s.targetCalendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.sources.ExchangeClient(cal)
+	if err != nil {
+		return nil, err
+	}
+
+	event := domain.NewEvent()
+	event.Importance = domain.ImportanceNormal
+	event.Sensitivity = domain.SensitivityNormal
+	input.Apply(event)
+
+	if err := validateEvent(event); err != nil {
+		return nil, err
+	}
+
+	created, err := client.CreateEvent(ctx, event)
+	if err != nil {
+		s.logger.Error("failed to create event in Exchange", zap.String("calendar", cal.Name), zap.Error(err))
+		return nil, err
+	}
+
+	created.CalendarID = cal.ID
+	if err := s.save(ctx, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (s *eventService) UpdateEvent(ctx context.Context, id uuid.UUID, input domain.EventInput) (*domain.Event, error) {
+	existing, client, err := s.writableEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := *existing
+	input.Apply(&merged)
+	if err := validateEvent(&merged); err != nil {
+		return nil, err
+	}
+
+	updated, err := client.UpdateEvent(ctx, existing.ExchangeID, input)
+	if err != nil {
+		s.logger.Error("failed to update event in Exchange",
+			zap.String("id", id.String()),
+			zap.String("exchange_id", existing.ExchangeID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	// Exceptions fetched on their own do not carry their series master.
+	updated.ID = existing.ID
+	updated.CalendarID = existing.CalendarID
+	updated.CreatedAt = existing.CreatedAt
+	if updated.SeriesMasterID == "" {
+		updated.SeriesMasterID = existing.SeriesMasterID
+	}
+
+	if err := s.save(ctx, updated); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (s *eventService) DeleteEvent(ctx context.Context, id uuid.UUID) error {
+	existing, client, err := s.writableEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteEvent(ctx, existing.ExchangeID); err != nil {
+		s.logger.Error("failed to delete event in Exchange",
+			zap.String("id", id.String()),
+			zap.String("exchange_id", existing.ExchangeID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	// Exchange drops the occurrence of a deleted exception from its series,
+	// so the stored master must exclude it too or it is expanded again
+	if existing.SeriesMasterID != "" && existing.OriginalStart != nil {
+		err = s.syncRepo.DeleteException(ctx, existing.CalendarID, existing.ExchangeID, existing.SeriesMasterID, *existing.OriginalStart)
+	} else {
+		_, err = s.syncRepo.DeleteByExchangeIDs(ctx, existing.CalendarID, []string{existing.ExchangeID})
+	}
+	if err != nil {
+		s.logger.Error("failed to delete event", zap.String("id", id.String()), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// writableEvent loads an event that can be changed through Exchange together
+// with a client for the mailbox of its calendar.
+func (s *eventService) writableEvent(ctx context.Context, id uuid.UUID) (*domain.Event, sync.ExchangeClient, error) {
+	event, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cal, err := s.calendarRepo.GetByID(ctx, event.CalendarID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !cal.IsWritable() || event.ExchangeID == "" {
+		return nil, nil, fmt.Errorf("%w: event from calendar %s is read-only", domain.ErrConflict, cal.Name)
+	}
+
+	client, err := s.sources.ExchangeClient(cal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return event, client, nil
+}
+
+// targetCalendar returns the calendar new events are created in. Without an
+// explicit ID the only enabled Exchange calendar is used.
+func (s *eventService) targetCalendar(ctx context.Context, calendarID uuid.UUID) (*domain.Calendar, error) {
+	if calendarID != uuid.Nil {
+		cal, err := s.calendarRepo.GetByID(ctx, calendarID)
+		if errors.Is(err, domain.ErrCalendarNotFound) {
+			return nil, fmt.Errorf("%w: unknown calendar %s", domain.ErrInvalidInput, calendarID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !cal.IsWritable() {
+			return nil, fmt.Errorf("%w: calendar %s is read-only", domain.ErrConflict, cal.Name)
+		}
+		return cal, nil
+	}
+
+	calendars, err := s.calendarRepo.List(ctx)
+	if err != nil {
+		s.logger.Error("failed to list calendars", zap.Error(err))
+		return nil, err
+	}
+
+	var target *domain.Calendar
+	for _, cal := range calendars {
+		if !cal.Enabled || !cal.IsWritable() {
+			continue
+		}
+		if target != nil {
+			return nil, fmt.Errorf("%w: calendar_id is required when several Exchange calendars are configured", domain.ErrInvalidInput)
+		}
+		target = cal
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: no Exchange calendar is configured", domain.ErrConflict)
+	}
+
+	return target, nil
+}
+
+// save stores an event returned by Exchange in the local mirror.
+func (s *eventService) save(ctx context.Context, event *domain.Event) error {
+	if _, err := s.syncRepo.Upsert(ctx, event); err != nil {
+		s.logger.Error("failed to save event",
+			zap.String("exchange_id", event.ExchangeID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// validateEvent checks an event about to be written to Exchange.
+func validateEvent(e *domain.Event) error {
+	if strings.TrimSpace(e.Subject) == "" {
+		return fmt.Errorf("%w: subject must not be empty", domain.ErrInvalidInput)
+	}
+	if utf8.RuneCountInString(e.Subject) > maxSubjectLength {
+		return fmt.Errorf("%w: subject must be at most %d characters", domain.ErrInvalidInput, maxSubjectLength)
+	}
+	if utf8.RuneCountInString(e.Location) > maxLocationLength {
+		return fmt.Errorf("%w: location must be at most %d characters", domain.ErrInvalidInput, maxLocationLength)
+	}
+	if e.StartTime.IsZero() || e.EndTime.IsZero() {
+		return fmt.Errorf("%w: start_time and end_time are required", domain.ErrInvalidInput)
+	}
+	if e.EndTime.Before(e.StartTime) {
+		return fmt.Errorf("%w: end_time must not be before start_time", domain.ErrInvalidInput)
+	}
+
+	switch e.Importance {
+	case domain.ImportanceLow, domain.ImportanceNormal, domain.ImportanceHigh:
+	default:
+		return fmt.Errorf("%w: unknown importance %q", domain.ErrInvalidInput, e.Importance)
+	}
+
+	switch e.Sensitivity {
+	case domain.SensitivityNormal, domain.SensitivityPersonal, domain.SensitivityPrivate, domain.SensitivityConfidential:
+	default:
+		return fmt.Errorf("%w: unknown sensitivity %q", domain.ErrInvalidInput, e.Sensitivity)
+	}
+
+	if e.TimeZone != "" {
+		if _, ok := recurrence.LoadLocation(e.TimeZone); !ok {
+			return fmt.Errorf("%w: unknown time zone %q", domain.ErrInvalidInput, e.TimeZone)
+		}
+	}
+
+	for _, a := range e.Attendees {
+		if addr, err := mail.ParseAddress(a.Email); err != nil || addr.Address != a.Email {
+			return fmt.Errorf("%w: invalid attendee email %q", domain.ErrInvalidInput, a.Email)
+		}
+	}
+
+	for _, c := range e.Categories {
+		if strings.TrimSpace(c) == "" || utf8.RuneCountInString(c) > maxCategoryLength {
+			return fmt.Errorf("%w: categories must be non-empty and at most %d characters", domain.ErrInvalidInput, maxCategoryLength)
+		}
 	}
 
-	return events, count, nil
+	return nil
 }
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/anmaslov/calendar/internal/sync"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func (r *fakeEventRepository) GetByID(_ context.Context, id uuid.UUID) (*domain.Event, error) {
+	for _, e := range slices.Concat(r.events, r.masters) {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, domain.ErrEventNotFound
+}
+
+func (r *fakeCalendarRepository) GetByID(_ context.Context, id uuid.UUID) (*domain.Calendar, error) {
+	for _, cal := range r.calendars {
+		if cal.ID == id {
+			return cal, nil
+		}
+	}
+	return nil, domain.ErrCalendarNotFound
+}
+
+// fakeEventSyncRepository writes to the events of a fakeEventRepository.
+type fakeEventSyncRepository struct {
+	repository.EventSyncRepository
+	repo *fakeEventRepository
+}
+
+func (r *fakeEventSyncRepository) DeleteByExchangeIDs(_ context.Context, calendarID uuid.UUID, exchangeIDs []string) (int64, error) {
+	before := len(r.repo.events)
+	r.repo.events = slices.DeleteFunc(r.repo.events, func(e *domain.Event) bool {
+		return e.CalendarID == calendarID && slices.Contains(exchangeIDs, e.ExchangeID)
+	})
+	return int64(before - len(r.repo.events)), nil
+}
+
+func (r *fakeEventSyncRepository) DeleteException(ctx context.Context, calendarID uuid.UUID, exchangeID, seriesMasterID string, originalStart time.Time) error {
+	if _, err := r.DeleteByExchangeIDs(ctx, calendarID, []string{exchangeID}); err != nil {
+		return err
+	}
+	for _, m := range r.repo.masters {
+		if m.CalendarID == calendarID && m.ExchangeID == seriesMasterID {
+			m.Recurrence.ExcludedDates = append(m.Recurrence.ExcludedDates, originalStart)
+		}
+	}
+	return nil
+}
+
+// fakeSourceFactory returns the same Exchange client for every calendar.
+type fakeSourceFactory struct {
+	sync.SourceFactory
+	client *fakeExchangeClient
+}
+
+func (f *fakeSourceFactory) ExchangeClient(*domain.Calendar) (sync.ExchangeClient, error) {
+	return f.client, nil
+}
+
+// fakeExchangeClient records the Exchange IDs of deleted items.
+type fakeExchangeClient struct {
+	sync.ExchangeClient
+	deleted []string
+}
+
+func (c *fakeExchangeClient) DeleteEvent(_ context.Context, exchangeID string) error {
+	c.deleted = append(c.deleted, exchangeID)
+	return nil
+}
+
+func TestDeleteEventException(t *testing.T) {
+	repo, filter := newExpandedListFixture()
+	repo.events = nil
+
+	cal := &domain.Calendar{ID: uuid.New(), Name: "exchange", SourceType: domain.CalendarSourceExchange, Enabled: true}
+	master := repo.masters[0]
+	master.CalendarID = cal.ID
+
+	// The third occurrence is moved to the afternoon
+	originalStart := master.StartTime.AddDate(0, 0, 2)
+	exception := domain.NewEvent()
+	exception.CalendarID = cal.ID
+	exception.ExchangeID = "series-1-exception"
+	exception.Subject = master.Subject
+	exception.StartTime = originalStart.Add(5 * time.Hour)
+	exception.EndTime = exception.StartTime.Add(15 * time.Minute)
+	exception.SeriesMasterID = master.ExchangeID
+	exception.OriginalStart = &originalStart
+	exception.IsException = true
+	repo.events = append(repo.events, exception)
+
+	client := &fakeExchangeClient{}
+	calendars := &fakeCalendarRepository{calendars: map[string]*domain.Calendar{cal.Name: cal}}
+	svc := NewEventService(repo, &fakeEventSyncRepository{repo: repo}, calendars, &fakeSourceFactory{client: client}, zap.NewNop())
+	ctx := context.Background()
+
+	if err := svc.DeleteEvent(ctx, exception.ID); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if want := []string{exception.ExchangeID}; !slices.Equal(client.deleted, want) {
+		t.Errorf("deleted in Exchange = %v, want %v", client.deleted, want)
+	}
+
+	page, err := svc.ListEvents(ctx, filter)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(page.Events) != 4 {
+		t.Errorf("series has %d occurrences after deleting an exception, want 4", len(page.Events))
+	}
+	for _, e := range page.Events {
+		if e.StartTime.Equal(originalStart) || e.StartTime.Equal(exception.StartTime) {
+			t.Errorf("deleted occurrence listed at %v", e.StartTime)
+		}
+	}
+}
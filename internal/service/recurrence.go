@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// listExpanded merges stored events with occurrences of recurring series
+// within the filter date range. Stored events are paged by the database;
+// occurrences are generated on the fly, so they are sorted and merged into
+// the page in memory.
+func (s *eventService) listExpanded(ctx context.Context, filter domain.EventFilter) (*domain.EventPage, error) {
+	masters, err := s.repo.ListSeriesMasters(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list series masters", zap.Error(err))
+		return nil, err
+	}
+
+	exceptions, err := s.repo.ListExceptionStarts(ctx, masters)
+	if err != nil {
+		s.logger.Error("failed to list series exceptions", zap.Error(err))
+		return nil, err
+	}
+
+	var occurrences []*domain.Event
+	for _, m := range masters {
+		expanded, err := expandSeries(m, exceptions[m.ID], filter)
+		if err != nil {
+			s.logger.Warn("failed to expand recurring series",
+				zap.String("id", m.ID.String()),
+				zap.Error(err),
+			)
+			continue
+		}
+		occurrences = append(occurrences, expanded...)
+	}
+
+	// Occurrences share the search rank and ID of their series master
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return domain.NewEventCursor(occurrences[i]).Before(domain.NewEventCursor(occurrences[j]))
+	})
+	total := int64(len(occurrences))
+
+	if filter.Cursor != nil {
+		// Occurrences are sorted, so the page starts at the first one after the cursor
+		i := sort.Search(len(occurrences), func(i int) bool {
+			return filter.Cursor.Before(domain.NewEventCursor(occurrences[i]))
+		})
+		occurrences = occurrences[i:]
+		filter.Offset = 0
+	}
+
+	// The page takes at most offset+limit stored events, one more tells
+	// whether a next page exists
+	stored := filter
+	stored.Offset = 0
+	if filter.Limit > 0 {
+		stored.Limit = filter.Offset + filter.Limit + 1
+	}
+
+	events, err := s.repo.List(ctx, stored)
+	if err != nil {
+		s.logger.Error("failed to list events", zap.Error(err))
+		return nil, err
+	}
+
+	events = paginate(mergeEvents(events, occurrences), 0, filter.Offset)
+	page := newEventPage(events, filter.Limit)
+	if filter.SkipCount {
+		return page, nil
+	}
+
+	count, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count events", zap.Error(err))
+		return nil, err
+	}
+	total += count
+	page.Total = &total
+
+	return page, nil
+}
+
+// mergeEvents merges two event lists sorted in listing order.
+func mergeEvents(a, b []*domain.Event) []*domain.Event {
+	merged := make([]*domain.Event, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if domain.NewEventCursor(b[0]).Before(domain.NewEventCursor(a[0])) {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+func (s *eventService) ListCalendarEvents(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, error) {
+	if filter.StartDate == nil || filter.EndDate == nil {
+		filter.ExpandRecurring = false
+		events, err := s.repo.List(ctx, filter)
+		if err != nil {
+			s.logger.Error("failed to list events", zap.Error(err))
+			return nil, err
+		}
+		return events, nil
+	}
+
+	// Series masters are matched by their span, other events by the date range
+	unpaged := filter
+	unpaged.Limit, unpaged.Offset, unpaged.ExpandRecurring = 0, 0, true
+
+	events, err := s.repo.List(ctx, unpaged)
+	if err != nil {
+		s.logger.Error("failed to list events", zap.Error(err))
+		return nil, err
+	}
+
+	masters, err := s.repo.ListSeriesMasters(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list series masters", zap.Error(err))
+		return nil, err
+	}
+
+	exceptions, err := s.repo.ListExceptionStarts(ctx, masters)
+	if err != nil {
+		s.logger.Error("failed to list series exceptions", zap.Error(err))
+		return nil, err
+	}
+
+	// Exceptions moved out of the range are not exported; exclude their
+	// original occurrences so clients do not show them at the old time.
+	type occurrenceKey struct {
+		calendarID     uuid.UUID
+		seriesMasterID string
+		originalStart  time.Time
+	}
+	exported := make(map[occurrenceKey]struct{})
+	for _, e := range events {
+		if e.SeriesMasterID == "" || e.OriginalStart == nil {
+			continue
+		}
+		exported[occurrenceKey{e.CalendarID, e.SeriesMasterID, e.OriginalStart.UTC()}] = struct{}{}
+	}
+
+	for _, m := range masters {
+		rec := *m.Recurrence
+		rec.ExcludedDates = append([]time.Time{}, rec.ExcludedDates...)
+		for _, start := range exceptions[m.ID] {
+			if _, ok := exported[occurrenceKey{m.CalendarID, m.ExchangeID, start.UTC()}]; !ok {
+				rec.ExcludedDates = append(rec.ExcludedDates, start)
+			}
+		}
+		m.Recurrence = &rec
+		events = append(events, m)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime.Before(events[j].StartTime)
+	})
+
+	return paginate(events, filter.Limit, filter.Offset), nil
+}
+
+// expandSeries generates occurrences of a series master matching the filter
+// date range. Occurrences replaced by stored exceptions are skipped.
+func expandSeries(master *domain.Event, exceptionStarts []time.Time, filter domain.EventFilter) ([]*domain.Event, error) {
+	loc, _ := recurrence.LoadLocation(master.TimeZone)
+	series := recurrence.Series{
+		Rule:          master.Recurrence.Rule,
+		Start:         master.StartTime,
+		Location:      loc,
+		ExcludedDates: append(append([]time.Time{}, master.Recurrence.ExcludedDates...), exceptionStarts...),
+	}
+
+	duration := master.EndTime.Sub(master.StartTime)
+	starts, err := series.Between(filter.StartDate.Add(-duration), *filter.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var occurrences []*domain.Event
+	for _, start := range starts {
+		start = start.UTC()
+		end := start.Add(duration)
+		if !filter.InRange(start, end) {
+			continue
+		}
+
+		occurrence := *master
+		occurrence.Recurrence = nil
+		occurrence.SeriesMasterID = master.ExchangeID
+		occurrence.OriginalStart = &start
+		occurrence.StartTime = start
+		occurrence.EndTime = end
+		occurrences = append(occurrences, &occurrence)
+	}
+
+	return occurrences, nil
+}
+
+// paginate returns the page of events selected by limit and offset.
+func paginate(events []*domain.Event, limit, offset int) []*domain.Event {
+	if offset >= len(events) {
+		return []*domain.Event{}
+	}
+	events = events[offset:]
+	if limit > 0 && limit < len(events) {
+		events = events[:limit]
+	}
+	return events
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeEventRepository lists stored events the way the database does:
+// filtered by the date range, sorted in listing order and paged by cursor,
+// offset and limit. Series masters are kept apart.
+type fakeEventRepository struct {
+	repository.EventRepository
+	events  []*domain.Event
+	masters []*domain.Event
+	// listed is the number of events returned by List
+	listed int
+}
+
+func (r *fakeEventRepository) matching(filter domain.EventFilter) []*domain.Event {
+	var events []*domain.Event
+	for _, e := range r.events {
+		if filter.InRange(e.StartTime, e.EndTime) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return domain.NewEventCursor(events[i]).Before(domain.NewEventCursor(events[j]))
+	})
+	return events
+}
+
+func (r *fakeEventRepository) List(_ context.Context, filter domain.EventFilter) ([]*domain.Event, error) {
+	events := r.matching(filter)
+	if filter.Cursor != nil {
+		i := sort.Search(len(events), func(i int) bool {
+			return filter.Cursor.Before(domain.NewEventCursor(events[i]))
+		})
+		events = events[i:]
+	}
+	events = paginate(events, filter.Limit, filter.Offset)
+	r.listed += len(events)
+	return events, nil
+}
+
+func (r *fakeEventRepository) Count(_ context.Context, filter domain.EventFilter) (int64, error) {
+	return int64(len(r.matching(filter))), nil
+}
+
+func (r *fakeEventRepository) ListSeriesMasters(context.Context, domain.EventFilter) ([]*domain.Event, error) {
+	return r.masters, nil
+}
+
+func (r *fakeEventRepository) ListExceptionStarts(_ context.Context, masters []*domain.Event) (map[uuid.UUID][]time.Time, error) {
+	starts := make(map[uuid.UUID][]time.Time)
+	for _, m := range masters {
+		for _, e := range r.events {
+			if e.SeriesMasterID == m.ExchangeID && e.OriginalStart != nil {
+				starts[m.ID] = append(starts[m.ID], *e.OriginalStart)
+			}
+		}
+	}
+	return starts, nil
+}
+
+func newExpandedListFixture() (*fakeEventRepository, domain.EventFilter) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	repo := &fakeEventRepository{}
+	for i := 0; i < 12; i++ {
+		e := domain.NewEvent()
+		e.Subject = fmt.Sprintf("Встреча %d", i)
+		e.StartTime = day.Add(time.Duration(i)*10*time.Hour + 9*time.Hour)
+		e.EndTime = e.StartTime.Add(time.Hour)
+		repo.events = append(repo.events, e)
+	}
+
+	master := domain.NewEvent()
+	master.ExchangeID = "series-1"
+	master.Subject = "Ежедневная планёрка"
+	master.StartTime = day.Add(10 * time.Hour)
+	master.EndTime = master.StartTime.Add(15 * time.Minute)
+	master.Recurrence = &domain.Recurrence{Rule: "FREQ=DAILY;COUNT=5"}
+	repo.masters = []*domain.Event{master}
+
+	start, end := day, day.AddDate(0, 0, 7)
+	filter := domain.EventFilter{StartDate: &start, EndDate: &end, ExpandRecurring: true}
+	return repo, filter
+}
+
+func TestListEventsExpandedPaging(t *testing.T) {
+	repo, filter := newExpandedListFixture()
+	svc := NewEventService(repo, nil, nil, nil, zap.NewNop())
+	ctx := context.Background()
+
+	all, err := svc.ListEvents(ctx, filter)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(all.Events) != 17 || all.Total == nil || *all.Total != 17 {
+		t.Fatalf("unpaged list has %d events, total %v, want 17", len(all.Events), all.Total)
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		repo.listed = 0
+		paged := filter
+		paged.Limit = 4
+
+		var got []*domain.Event
+		for pages := 0; ; pages++ {
+			if pages > len(all.Events) {
+				t.Fatal("paging does not end")
+			}
+			page, err := svc.ListEvents(ctx, paged)
+			if err != nil {
+				t.Fatalf("ListEvents: %v", err)
+			}
+			if len(page.Events) > paged.Limit {
+				t.Fatalf("page has %d events, limit %d", len(page.Events), paged.Limit)
+			}
+			got = append(got, page.Events...)
+			if page.Next == nil {
+				break
+			}
+			paged.Cursor = page.Next
+		}
+		assertSameEvents(t, got, all.Events)
+
+		// Every page reads at most limit+1 stored events
+		if pages := (len(all.Events) + 3) / 4; repo.listed > pages*(paged.Limit+1) {
+			t.Errorf("stored events read = %d over %d pages of %d", repo.listed, pages, paged.Limit)
+		}
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		paged := filter
+		paged.Limit = 5
+
+		var got []*domain.Event
+		for paged.Offset = 0; paged.Offset < len(all.Events); paged.Offset += paged.Limit {
+			page, err := svc.ListEvents(ctx, paged)
+			if err != nil {
+				t.Fatalf("ListEvents: %v", err)
+			}
+			if page.Total == nil || *page.Total != 17 {
+				t.Errorf("total at offset %d = %v, want 17", paged.Offset, page.Total)
+			}
+			got = append(got, page.Events...)
+		}
+		assertSameEvents(t, got, all.Events)
+	})
+}
+
+// assertSameEvents checks that the events are listed in the same order,
+// comparing occurrences by their series and start time.
+func assertSameEvents(t *testing.T, got, want []*domain.Event) {
+	t.Helper()
+
+	key := func(e *domain.Event) string {
+		return e.ID.String() + "/" + e.StartTime.Format(time.RFC3339)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("paged events = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if key(got[i]) != key(want[i]) {
+			t.Errorf("event %d = %s %q, want %s %q", i, key(got[i]), got[i].Subject, key(want[i]), want[i].Subject)
+		}
+	}
+}
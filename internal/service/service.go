@@ -12,6 +12,88 @@ type EventService interface {
 	// GetEvent retrieves an event by its ID.
 	GetEvent(ctx context.Context, id uuid.UUID) (*domain.Event, error)
 
-	// ListEvents retrieves events based on filter criteria.
-	ListEvents(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, int64, error)
+	// ListEvents retrieves a page of events based on filter criteria.
+	ListEvents(ctx context.Context, filter domain.EventFilter) (*domain.EventPage, error)
+
+	// ListCalendarEvents retrieves events for calendar export. Recurring series
+	// are returned as series masters with their exceptions instead of occurrences.
+	ListCalendarEvents(ctx context.Context, filter domain.EventFilter) ([]*domain.Event, error)
+
+	// CreateEvent validates the input, creates the event in the Exchange
+	// calendar and stores it locally. A nil calendar ID selects the only
+	// enabled Exchange calendar.
+	CreateEvent(ctx context.Context, calendarID uuid.UUID, input domain.EventInput) (*domain.Event, error)
+
+	// UpdateEvent applies the set fields of input to the event in Exchange and stores the result.
+	UpdateEvent(ctx context.Context, id uuid.UUID, input domain.EventInput) (*domain.Event, error)
+
+	// DeleteEvent deletes the event in Exchange and removes it locally.
+	DeleteEvent(ctx context.Context, id uuid.UUID) error
+}
+
+// CalendarService defines the interface for calendar business logic.
+type CalendarService interface {
+	// ListCalendars retrieves all calendars.
+	ListCalendars(ctx context.Context) ([]*domain.Calendar, error)
+
+	// EnsureCalendars creates or updates the calendars by name and disables
+	// all other calendars.
+	EnsureCalendars(ctx context.Context, calendars []*domain.Calendar) error
+}
+
+// SyncService defines the interface for sync history, status and on-demand runs.
+type SyncService interface {
+	// ListRuns retrieves sync runs based on filter criteria, latest first.
+	ListRuns(ctx context.Context, filter domain.SyncRunFilter) ([]*domain.SyncRun, int64, error)
+
+	// GetRun retrieves a sync run by its ID.
+	GetRun(ctx context.Context, id uuid.UUID) (*domain.SyncRun, error)
+
+	// Status summarizes the latest sync runs overall and per calendar.
+	Status(ctx context.Context) (*domain.SyncStatus, error)
+
+	// Trigger requests an immediate sync and returns the pending runs, one per
+	// calendar. A request matching an already pending run returns that run.
+	Trigger(ctx context.Context, req domain.SyncRequest) ([]*domain.SyncRun, error)
+}
+
+// ChangeService defines the interface for the event change feed.
+type ChangeService interface {
+	// ListChanges returns a page of changes after filter.Since, oldest first.
+	ListChanges(ctx context.Context, filter domain.ChangeFilter) (*domain.ChangePage, error)
+
+	// Subscribe streams changes matching the filter as they are committed,
+	// preceded by the changes after since when it is set. The channel is closed
+	// when ctx is done, on failure or when the subscriber falls behind; the
+	// subscriber can resume with the Seq of the last change it received.
+	Subscribe(ctx context.Context, filter domain.EventFilter, since *int64) <-chan *domain.EventChange
+}
+
+// WebhookService defines the interface for webhook subscriptions and their deliveries.
+type WebhookService interface {
+	// ListWebhooks retrieves all webhooks.
+	ListWebhooks(ctx context.Context) ([]*domain.Webhook, error)
+
+	// GetWebhook retrieves a webhook by its ID.
+	GetWebhook(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+
+	// CreateWebhook validates the input and stores a new webhook. A secret is
+	// generated unless given.
+	CreateWebhook(ctx context.Context, input domain.WebhookInput) (*domain.Webhook, error)
+
+	// UpdateWebhook applies the set fields of input to the webhook.
+	UpdateWebhook(ctx context.Context, id uuid.UUID, input domain.WebhookInput) (*domain.Webhook, error)
+
+	// DeleteWebhook deletes the webhook together with its deliveries.
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+
+	// ListDeliveries retrieves deliveries of a webhook, latest first.
+	ListDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, int64, error)
+
+	// GetDelivery retrieves a delivery of a webhook by its ID.
+	GetDelivery(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error)
+
+	// Redeliver schedules a delivered or dead delivery to be sent again with
+	// a fresh set of attempts.
+	Redeliver(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error)
 }
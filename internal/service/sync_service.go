@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/anmaslov/calendar/internal/sync"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type syncService struct {
+	runRepo      repository.SyncRunRepository
+	calendarRepo repository.CalendarRepository
+	sources      sync.SourceFactory
+	cfg          config.SyncConfig
+	wake         func()
+	logger       *zap.Logger
+}
+
+// NewSyncService creates a new sync service. wake, if not nil, is called
+// after runs are requested so that a local worker picks them up immediately.
+func NewSyncService(
+	runRepo repository.SyncRunRepository,
+	calendarRepo repository.CalendarRepository,
+	sources sync.SourceFactory,
+	cfg config.SyncConfig,
+	wake func(),
+	logger *zap.Logger,
+) SyncService {
+	return &syncService{
+		runRepo:      runRepo,
+		calendarRepo: calendarRepo,
+		sources:      sources,
+		cfg:          cfg,
+		wake:         wake,
+		logger:       logger,
+	}
+}
+
+func (s *syncService) ListRuns(ctx context.Context, filter domain.SyncRunFilter) ([]*domain.SyncRun, int64, error) {
+	runs, err := s.runRepo.List(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list sync runs", zap.Error(err))
+		return nil, 0, err
+	}
+
+	count, err := s.runRepo.Count(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count sync runs", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return runs, count, nil
+}
+
+func (s *syncService) GetRun(ctx context.Context, id uuid.UUID) (*domain.SyncRun, error) {
+	run, err := s.runRepo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, domain.ErrSyncRunNotFound) {
+			s.logger.Error("failed to get sync run", zap.Error(err), zap.String("id", id.String()))
+		}
+		return nil, err
+	}
+
+	return run, nil
+}
+
+func (s *syncService) Trigger(ctx context.Context, req domain.SyncRequest) ([]*domain.SyncRun, error) {
+	if !s.cfg.Enabled {
+		return nil, fmt.Errorf("%w: sync is disabled", domain.ErrConflict)
+	}
+	if (req.StartDate == nil) != (req.EndDate == nil) {
+		return nil, fmt.Errorf("%w: start_date and end_date must be given together", domain.ErrInvalidInput)
+	}
+	if req.StartDate != nil && !req.EndDate.After(*req.StartDate) {
+		return nil, fmt.Errorf("%w: end_date must be after start_date", domain.ErrInvalidInput)
+	}
+
+	calendars, err := s.triggerCalendars(ctx, req.CalendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Incremental sync covers the default window only
+	mode := s.cfg.Mode
+	if req.StartDate != nil {
+		mode = config.SyncModeFull
+	}
+
+	now := time.Now()
+	runs := make([]*domain.SyncRun, 0, len(calendars))
+	for _, cal := range calendars {
+		run := &domain.SyncRun{
+			CalendarID:   cal.ID,
+			CalendarName: cal.Name,
+			Trigger:      domain.SyncTriggerManual,
+			Mode:         mode,
+			RangeStart:   req.StartDate,
+			RangeEnd:     req.EndDate,
+			StartedAt:    now,
+		}
+		if err := s.runRepo.Enqueue(ctx, run); err != nil {
+			s.logger.Error("failed to enqueue sync run", zap.Error(err), zap.String("calendar", cal.Name))
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	s.logger.Info("sync requested", zap.Int("runs", len(runs)))
+	if s.wake != nil {
+		s.wake()
+	}
+
+	return runs, nil
+}
+
+// triggerCalendars returns the calendars to sync on request: the given
+// calendar or all enabled ones.
+func (s *syncService) triggerCalendars(ctx context.Context, calendarID *uuid.UUID) ([]*domain.Calendar, error) {
+	if calendarID != nil {
+		cal, err := s.calendarRepo.GetByID(ctx, *calendarID)
+		if errors.Is(err, domain.ErrCalendarNotFound) {
+			return nil, fmt.Errorf("%w: unknown calendar %s", domain.ErrInvalidInput, *calendarID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !cal.Enabled {
+			return nil, fmt.Errorf("%w: calendar %s is disabled", domain.ErrConflict, cal.Name)
+		}
+		return []*domain.Calendar{cal}, nil
+	}
+
+	calendars, err := s.calendarRepo.List(ctx)
+	if err != nil {
+		s.logger.Error("failed to list calendars", zap.Error(err))
+		return nil, err
+	}
+
+	enabled := make([]*domain.Calendar, 0, len(calendars))
+	for _, cal := range calendars {
+		if cal.Enabled {
+			enabled = append(enabled, cal)
+		}
+	}
+
+	return enabled, nil
+}
+
+func (s *syncService) Status(ctx context.Context) (*domain.SyncStatus, error) {
+	calendars, err := s.calendarRepo.List(ctx)
+	if err != nil {
+		s.logger.Error("failed to list calendars", zap.Error(err))
+		return nil, err
+	}
+
+	runs, err := s.runRepo.ListLatest(ctx)
+	if err != nil {
+		s.logger.Error("failed to list latest sync runs", zap.Error(err))
+		return nil, err
+	}
+
+	status := &domain.SyncStatus{
+		Enabled:   s.cfg.Enabled,
+		Interval:  s.cfg.Interval,
+		Exchange:  s.sources.ExchangeCircuit(),
+		Calendars: make([]domain.CalendarSyncStatus, len(calendars)),
+	}
+
+	byCalendar := make(map[uuid.UUID]*domain.CalendarSyncStatus, len(calendars))
+	for i, cal := range calendars {
+		status.Calendars[i].Calendar = cal
+		byCalendar[cal.ID] = &status.Calendars[i]
+	}
+
+	var latest *domain.SyncRun
+	for _, run := range runs {
+		// Requested runs do not move the schedule
+		if run.Trigger == domain.SyncTriggerSchedule && (latest == nil || run.StartedAt.After(latest.StartedAt)) {
+			latest = run
+		}
+
+		cal := byCalendar[run.CalendarID]
+		switch run.Status {
+		case domain.SyncRunStatusSucceeded:
+			status.LastSuccess = laterRun(status.LastSuccess, run)
+			if cal != nil {
+				cal.LastSuccess = laterRun(cal.LastSuccess, run)
+			}
+		case domain.SyncRunStatusFailed:
+			status.LastFailure = laterRun(status.LastFailure, run)
+			if cal != nil {
+				cal.LastFailure = laterRun(cal.LastFailure, run)
+			}
+		}
+	}
+
+	// Cycles start every interval, so the next one is due an interval after the latest
+	if s.cfg.Enabled && latest != nil {
+		next := latest.StartedAt.Add(s.cfg.Interval)
+		status.NextRunAt = &next
+	}
+
+	return status, nil
+}
+
+// laterRun returns the run that started later.
+func laterRun(a, b *domain.SyncRun) *domain.SyncRun {
+	if a == nil || b.StartedAt.After(a.StartedAt) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/anmaslov/calendar/internal/webhook"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	maxWebhookURLLength = 2000
+	maxSecretLength     = 255
+	// generatedSecretSize is the number of random bytes of a generated secret.
+	generatedSecretSize = 32
+)
+
+type webhookService struct {
+	repo         repository.WebhookRepository
+	calendarRepo repository.CalendarRepository
+	targets      *webhook.TargetPolicy
+	logger       *zap.Logger
+}
+
+// NewWebhookService creates a new webhook service. Webhook URLs must be
+// allowed by targets.
+func NewWebhookService(repo repository.WebhookRepository, calendarRepo repository.CalendarRepository, targets *webhook.TargetPolicy, logger *zap.Logger) WebhookService {
+	return &webhookService{
+		repo:         repo,
+		calendarRepo: calendarRepo,
+		targets:      targets,
+		logger:       logger,
+	}
+}
+
+func (s *webhookService) ListWebhooks(ctx context.Context) ([]*domain.Webhook, error) {
+	webhooks, err := s.repo.List(ctx)
+	if err != nil {
+		s.logger.Error("failed to list webhooks", zap.Error(err))
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (s *webhookService) GetWebhook(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	webhook, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, domain.ErrWebhookNotFound) {
+			s.logger.Error("failed to get webhook", zap.String("id", id.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, input domain.WebhookInput) (*domain.Webhook, error) {
+	if input.URL == nil {
+		return nil, fmt.Errorf("%w: url is required", domain.ErrInvalidInput)
+	}
+
+	webhook := &domain.Webhook{Enabled: true}
+	input.Apply(webhook)
+
+	if input.Secret == nil {
+		secret, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		webhook.Secret = secret
+	}
+
+	if err := s.validateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		s.logger.Error("failed to create webhook", zap.Error(err))
+		return nil, err
+	}
+
+	s.logger.Info("webhook created", zap.String("id", webhook.ID.String()), zap.String("url", webhook.URL))
+	return webhook, nil
+}
+
+func (s *webhookService) UpdateWebhook(ctx context.Context, id uuid.UUID, input domain.WebhookInput) (*domain.Webhook, error) {
+	webhook, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	input.Apply(webhook)
+	if err := s.validateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, webhook); err != nil {
+		if !errors.Is(err, domain.ErrWebhookNotFound) {
+			s.logger.Error("failed to update webhook", zap.String("id", id.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if !errors.Is(err, domain.ErrWebhookNotFound) {
+			s.logger.Error("failed to delete webhook", zap.String("id", id.String()), zap.Error(err))
+		}
+		return err
+	}
+
+	s.logger.Info("webhook deleted", zap.String("id", id.String()))
+	return nil
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, int64, error) {
+	// Distinguish an unknown webhook from one without deliveries
+	if _, err := s.GetWebhook(ctx, filter.WebhookID); err != nil {
+		return nil, 0, err
+	}
+
+	deliveries, err := s.repo.ListDeliveries(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to list webhook deliveries", zap.Error(err))
+		return nil, 0, err
+	}
+
+	count, err := s.repo.CountDeliveries(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed to count webhook deliveries", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return deliveries, count, nil
+}
+
+func (s *webhookService) GetDelivery(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, webhookID, id)
+	if err != nil {
+		if !errors.Is(err, domain.ErrDeliveryNotFound) {
+			s.logger.Error("failed to get webhook delivery", zap.String("id", id.String()), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (s *webhookService) Redeliver(ctx context.Context, webhookID, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	delivery, err := s.GetDelivery(ctx, webhookID, id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status == domain.WebhookDeliveryPending {
+		return nil, fmt.Errorf("%w: delivery is still pending", domain.ErrConflict)
+	}
+
+	delivery.Status = domain.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.DeliveredAt = nil
+
+	if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+		s.logger.Error("failed to schedule webhook redelivery", zap.String("id", id.String()), zap.Error(err))
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// validateWebhook checks a webhook about to be stored.
+func (s *webhookService) validateWebhook(ctx context.Context, w *domain.Webhook) error {
+	if len(w.URL) > maxWebhookURLLength {
+		return fmt.Errorf("%w: url must be at most %d characters", domain.ErrInvalidInput, maxWebhookURLLength)
+	}
+	if err := s.targets.CheckURL(w.URL); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+	}
+	if w.Secret == "" || len(w.Secret) > maxSecretLength {
+		return fmt.Errorf("%w: secret must be non-empty and at most %d characters", domain.ErrInvalidInput, maxSecretLength)
+	}
+	if utf8.RuneCountInString(w.Subject) > maxSubjectLength {
+		return fmt.Errorf("%w: subject must be at most %d characters", domain.ErrInvalidInput, maxSubjectLength)
+	}
+	for _, c := range w.Categories {
+		if strings.TrimSpace(c) == "" || utf8.RuneCountInString(c) > maxCategoryLength {
+			return fmt.Errorf("%w: categories must be non-empty and at most %d characters", domain.ErrInvalidInput, maxCategoryLength)
+		}
+	}
+
+	if w.CalendarID != nil {
+		_, err := s.calendarRepo.GetByID(ctx, *w.CalendarID)
+		if errors.Is(err, domain.ErrCalendarNotFound) {
+			return fmt.Errorf("%w: unknown calendar %s", domain.ErrInvalidInput, *w.CalendarID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateSecret returns a random hex-encoded webhook secret.
+func generateSecret() (string, error) {
+	b := make([]byte, generatedSecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-ntlmssp"
+	"github.com/anmaslov/calendar/internal/config"
+)
+
+// Supported Exchange authentication types.
+const (
+	AuthTypeNTLM  = "ntlm"
+	AuthTypeBasic = "basic"
+)
+
+// authTransport is an http.RoundTripper that authenticates EWS requests with
+// the configured account.
+//
+// NTLM authenticates a connection rather than a request. The handshake is
+// left to ntlmssp.Negotiator, which sends a request without credentials
+// first, so a connection that is already authenticated is answered directly,
+// and otherwise replays it with the negotiate and authenticate messages,
+// draining every response so the next leg reuses the same connection.
+type authTransport struct {
+	next     http.RoundTripper
+	username string
+	password string
+}
+
+// newAuthTransport wraps next with authentication configured in cfg.
+func newAuthTransport(cfg config.ExchangeConfig, next http.RoundTripper) *authTransport {
+	if cfg.AuthType != AuthTypeBasic {
+		next = ntlmssp.Negotiator{RoundTripper: next, AllowBasicAuth: cfg.BasicFallback}
+	}
+
+	username := cfg.Username
+	if cfg.Domain != "" && !strings.ContainsAny(username, `\@`) {
+		username = cfg.Domain + `\` + username
+	}
+
+	return &authTransport{
+		next:     next,
+		username: username,
+		password: cfg.Password,
+	}
+}
+
+// RoundTrip sets the account's credentials on a copy of the request. The
+// negotiator uses them for the NTLM handshake; with basic auth they are sent
+// as they are.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.SetBasicAuth(t.username, t.password)
+	return t.next.RoundTrip(clone)
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+	"testing"
+
+	"github.com/anmaslov/calendar/internal/config"
+)
+
+// ntlmChallenge is an NTLM challenge message with an empty target name and
+// target info, negotiating Unicode, NTLM and extended session security.
+func ntlmChallenge() []byte {
+	msg := make([]byte, 52)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[12:], 48)
+	binary.LittleEndian.PutUint32(msg[20:], 0x00000001|0x00000200|0x00080000|0x00800000)
+	copy(msg[24:], "srvchall")
+	binary.LittleEndian.PutUint16(msg[40:], 4)
+	binary.LittleEndian.PutUint16(msg[42:], 4)
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return msg
+}
+
+// ntlmServer authenticates connections the way Exchange does: a negotiate
+// and an authenticate message sent on the same connection authenticate it
+// for all later requests.
+type ntlmServer struct {
+	t    *testing.T
+	body string
+
+	mu         gosync.Mutex
+	conns      map[string]string
+	requests   int
+	handshakes int
+}
+
+func (s *ntlmServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if string(body) != s.body {
+		s.t.Errorf("request body = %q, want %q", body, s.body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	msg, _ := base64.StdEncoding.DecodeString(token)
+	switch {
+	case s.conns[r.RemoteAddr] == "authenticated":
+		w.WriteHeader(http.StatusOK)
+	case scheme == "NTLM" && len(msg) > 8 && msg[8] == 1:
+		s.conns[r.RemoteAddr] = "challenged"
+		w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmChallenge()))
+		w.WriteHeader(http.StatusUnauthorized)
+	case scheme == "NTLM" && len(msg) > 8 && msg[8] == 3 && s.conns[r.RemoteAddr] == "challenged":
+		s.conns[r.RemoteAddr] = "authenticated"
+		s.handshakes++
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.Header().Set("WWW-Authenticate", "NTLM")
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func TestAuthTransportNTLM(t *testing.T) {
+	server := &ntlmServer{t: t, body: "<soap:Envelope/>", conns: make(map[string]string)}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	cfg := config.ExchangeConfig{AuthType: AuthTypeNTLM, Domain: "CORP", Username: "ivan.petrov", Password: "secret"}
+	client := &http.Client{Transport: newAuthTransport(cfg, srv.Client().Transport)}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Post(srv.URL, "text/xml", strings.NewReader(server.body))
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, resp.StatusCode)
+		}
+	}
+
+	// The handshake takes three legs on one connection; later requests reuse
+	// the authenticated connection without a 401
+	if server.handshakes != 1 || server.requests != 5 {
+		t.Errorf("handshakes = %d, requests = %d; want 1 and 5", server.handshakes, server.requests)
+	}
+}
+
+func TestAuthTransportBasic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != `CORP\ivan.petrov` || password != "secret" {
+			t.Errorf("basic auth = %q/%q/%t", user, password, ok)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := config.ExchangeConfig{AuthType: AuthTypeBasic, Domain: "CORP", Username: "ivan.petrov", Password: "secret"}
+	client := &http.Client{Transport: newAuthTransport(cfg, srv.Client().Transport)}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+}
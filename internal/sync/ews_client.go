@@ -0,0 +1,485 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	// ewsRequestTimeout bounds a single EWS SOAP call.
+	ewsRequestTimeout = 60 * time.Second
+	// ewsPageSize is the maximum number of items returned by one CalendarView page.
+	ewsPageSize = 500
+	// ewsGetItemBatchSize is the maximum number of item IDs sent in one GetItem call.
+	ewsGetItemBatchSize = 100
+	// ewsSyncBatchSize is the maximum number of changes returned by one SyncFolderItems call.
+	ewsSyncBatchSize = 512
+)
+
+// ewsClient is an ExchangeClient that talks to Exchange Web Services over SOAP.
+type ewsClient struct {
+	cfg        config.ExchangeConfig
+	httpClient *http.Client
+	retrier    *retrier
+	logger     *zap.Logger
+	// mailbox is the SMTP address of the mailbox whose calendar is used,
+	// empty for the account's own mailbox
+	mailbox string
+}
+
+// newHTTPClient creates an HTTP client authenticating with the configured account.
+// NTLM authenticates a connection, which HTTP/2 multiplexes and Exchange
+// does not support, so the client is limited to HTTP/1.1.
+func newHTTPClient(cfg config.ExchangeConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+
+	return &http.Client{
+		Transport: newAuthTransport(cfg, transport),
+		Timeout:   ewsRequestTimeout,
+	}
+}
+
+// newEWSClient creates an EWS client using the given HTTP client.
+func newEWSClient(cfg config.ExchangeConfig, httpClient *http.Client, logger *zap.Logger) *ewsClient {
+	return &ewsClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+		retrier:    newRetrier(cfg, logger),
+		logger:     logger,
+	}
+}
+
+// forMailbox returns a client for the calendar of another mailbox sharing the HTTP client.
+func (c *ewsClient) forMailbox(mailbox string) *ewsClient {
+	client := *c
+	client.mailbox = mailbox
+	client.logger = c.logger.With(zap.String("mailbox", mailbox))
+	return &client
+}
+
+// calendarFolder returns the folder ID of the calendar of the client's mailbox.
+func (c *ewsClient) calendarFolder() parentFolderIDs {
+	folder := distinguishedFolderID{ID: "calendar"}
+	if c.mailbox != "" {
+		folder.Mailbox = &mailboxInput{EmailAddress: c.mailbox}
+	}
+	return parentFolderIDs{DistinguishedFolderID: folder}
+}
+
+func (c *ewsClient) GetCalendarEvents(ctx context.Context, startDate, endDate time.Time) ([]*domain.Event, error) {
+	ids, err := c.findCalendarItems(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Debug("found calendar items in Exchange",
+		zap.Int("count", len(ids)),
+		zap.Time("start_date", startDate),
+		zap.Time("end_date", endDate),
+	)
+
+	items, err := c.getCalendarItems(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.toEvents(ctx, items)
+}
+
+// findCalendarItems returns IDs of all calendar items within the date range.
+// CalendarView does not support offset paging, so pages are requested by
+// moving the view start to the last returned item until the range is exhausted.
+// A page of items returned before cannot move the view any further; the list
+// would be incomplete, so it fails rather than letting sync delete the items
+// it did not see.
+func (c *ewsClient) findCalendarItems(ctx context.Context, startDate, endDate time.Time) ([]requestItemID, error) {
+	var ids []requestItemID
+	seen := make(map[string]struct{})
+	viewStart := startDate
+
+	for {
+		req := &findItemRequest{
+			Traversal: "Shallow",
+			ItemShape: itemShape{
+				BaseShape: "IdOnly",
+				AdditionalProperties: &additionalProperties{
+					FieldURIs: []fieldURI{{FieldURI: "calendar:Start"}},
+				},
+			},
+			CalendarView: calendarView{
+				MaxEntriesReturned: ewsPageSize,
+				StartDate:          viewStart.UTC().Format(time.RFC3339),
+				EndDate:            endDate.UTC().Format(time.RFC3339),
+			},
+			ParentFolderIDs: c.calendarFolder(),
+		}
+
+		var resp soapResponse
+		if err := c.call(ctx, "FindItem", req, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Body.FindItemResponse == nil || len(resp.Body.FindItemResponse.Messages) == 0 {
+			return nil, fmt.Errorf("%w: empty FindItem response", domain.ErrExchangeError)
+		}
+
+		msg := resp.Body.FindItemResponse.Messages[0]
+		if msg.isError() {
+			return nil, fmt.Errorf("%w: FindItem: %s: %s", domain.ErrExchangeError, msg.ResponseCode, msg.MessageText)
+		}
+
+		added := 0
+		for _, item := range msg.RootFolder.Items {
+			if _, ok := seen[item.ItemID.ID]; ok {
+				continue
+			}
+			seen[item.ItemID.ID] = struct{}{}
+			ids = append(ids, requestItemID{ID: item.ItemID.ID})
+			added++
+			if item.Start.After(viewStart) {
+				viewStart = item.Start
+			}
+		}
+
+		if msg.RootFolder.IncludesLastItemInRange {
+			return ids, nil
+		}
+		if added == 0 {
+			return nil, fmt.Errorf("%w: FindItem: calendar view from %s returned no new items, more than %d items may start at that time",
+				domain.ErrExchangeError, viewStart.UTC().Format(time.RFC3339), ewsPageSize)
+		}
+	}
+}
+
+// toEvents converts fetched items into events. A recurring series is
+// represented by its master together with all its exceptions, so occurrences
+// and exceptions found in a calendar view are replaced by their master.
+func (c *ewsClient) toEvents(ctx context.Context, items []ewsCalendarItem) ([]*domain.Event, error) {
+	var (
+		events        []*domain.Event
+		masters       []ewsCalendarItem
+		occurrenceIDs []string
+	)
+	seenSeries := make(map[string]struct{})
+
+	for _, item := range items {
+		switch item.CalendarItemType {
+		case calendarItemRecurringMaster:
+			masters = append(masters, item)
+			seenSeries[item.UID] = struct{}{}
+		case calendarItemOccurrence, calendarItemException:
+			if _, ok := seenSeries[item.UID]; ok && item.UID != "" {
+				continue
+			}
+			seenSeries[item.UID] = struct{}{}
+			occurrenceIDs = append(occurrenceIDs, item.ItemID.ID)
+		default:
+			events = append(events, item.toDomain())
+		}
+	}
+
+	fetched, err := c.getRecurringMasters(ctx, occurrenceIDs)
+	if err != nil {
+		return nil, err
+	}
+	masters = append(masters, fetched...)
+
+	masterIDs := make(map[string]string, len(masters))
+	var exceptionIDs []requestItemID
+	for _, m := range masters {
+		if _, ok := masterIDs[m.UID]; ok {
+			continue
+		}
+		masterIDs[m.UID] = m.ItemID.ID
+
+		event, err := m.seriesMasterToDomain()
+		if err != nil {
+			c.logger.Warn("unsupported recurrence, storing series master as a single event",
+				zap.String("exchange_id", m.ItemID.ID),
+				zap.Error(err),
+			)
+			event = m.toDomain()
+		}
+		events = append(events, event)
+
+		for _, o := range m.ModifiedOccurrences {
+			exceptionIDs = append(exceptionIDs, requestItemID{ID: o.ItemID.ID})
+		}
+	}
+
+	exceptions, err := c.getCalendarItems(ctx, exceptionIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range exceptions {
+		event := e.toDomain()
+		event.IsException = true
+		event.SeriesMasterID = masterIDs[e.UID]
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// getCalendarItems loads full properties for the given items in batches.
+func (c *ewsClient) getCalendarItems(ctx context.Context, ids []requestItemID) ([]ewsCalendarItem, error) {
+	items := make([]ewsCalendarItem, 0, len(ids))
+
+	for start := 0; start < len(ids); start += ewsGetItemBatchSize {
+		end := min(start+ewsGetItemBatchSize, len(ids))
+
+		batch, err := c.getItems(ctx, itemIDs{ItemIDs: ids[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+	}
+
+	return items, nil
+}
+
+// getRecurringMasters loads series masters of the given occurrences in batches.
+func (c *ewsClient) getRecurringMasters(ctx context.Context, occurrenceIDs []string) ([]ewsCalendarItem, error) {
+	items := make([]ewsCalendarItem, 0, len(occurrenceIDs))
+
+	for start := 0; start < len(occurrenceIDs); start += ewsGetItemBatchSize {
+		end := min(start+ewsGetItemBatchSize, len(occurrenceIDs))
+
+		ids := itemIDs{}
+		for _, id := range occurrenceIDs[start:end] {
+			ids.RecurringMasterItemIDs = append(ids.RecurringMasterItemIDs, recurringMasterItemID{OccurrenceID: id})
+		}
+
+		batch, err := c.getItems(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+	}
+
+	return items, nil
+}
+
+// getItems issues one GetItem call with full calendar item properties.
+func (c *ewsClient) getItems(ctx context.Context, ids itemIDs) ([]ewsCalendarItem, error) {
+	req := &getItemRequest{
+		ItemShape: itemShape{
+			BaseShape:            "AllProperties",
+			BodyType:             "Text",
+			AdditionalProperties: &additionalProperties{FieldURIs: calendarItemProperties},
+		},
+		ItemIDs: ids,
+	}
+
+	var resp soapResponse
+	if err := c.call(ctx, "GetItem", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Body.GetItemResponse == nil {
+		return nil, fmt.Errorf("%w: empty GetItem response", domain.ErrExchangeError)
+	}
+
+	var items []ewsCalendarItem
+	for _, msg := range resp.Body.GetItemResponse.Messages {
+		if msg.isError() {
+			// Items may disappear between FindItem and GetItem; skip them.
+			c.logger.Warn("failed to get calendar item",
+				zap.String("code", msg.ResponseCode),
+				zap.String("message", msg.MessageText),
+			)
+			continue
+		}
+		items = append(items, msg.Items...)
+	}
+
+	return items, nil
+}
+
+// call sends a SOAP request that has no side effects, retrying transient failures.
+func (c *ewsClient) call(ctx context.Context, operation string, request interface{}, response *soapResponse) error {
+	return c.retrier.do(ctx, operation, true, func(ctx context.Context) error {
+		return c.send(ctx, request, response)
+	})
+}
+
+// callWrite sends a SOAP request that changes items. It is only repeated if
+// Exchange rejected it unprocessed, so that items are not created twice.
+func (c *ewsClient) callWrite(ctx context.Context, operation string, request interface{}, response *soapResponse) error {
+	return c.retrier.do(ctx, operation, false, func(ctx context.Context) error {
+		return c.send(ctx, request, response)
+	})
+}
+
+// send sends a SOAP request to the EWS endpoint once and decodes the response.
+func (c *ewsClient) send(ctx context.Context, request interface{}, response *soapResponse) error {
+	payload, err := xml.Marshal(newSoapEnvelope(request))
+	if err != nil {
+		return fmt.Errorf("failed to marshal EWS request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(append([]byte(xml.Header), payload...)))
+	if err != nil {
+		return fmt.Errorf("failed to create EWS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("Accept", "text/xml")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", domain.ErrExchangeError, ctx.Err())
+		}
+		return &transientError{err: fmt.Errorf("%w: %v", domain.ErrExchangeError, err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &transientError{err: fmt.Errorf("%w: failed to read response: %v", domain.ErrExchangeError, err)}
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %w: exchange rejected credentials", domain.ErrExchangeError, domain.ErrUnauthorized)
+	}
+
+	*response = soapResponse{}
+	if err := xml.Unmarshal(body, response); err != nil {
+		return statusError(resp, fmt.Errorf("%w: unexpected response (HTTP %d): %v", domain.ErrExchangeError, resp.StatusCode, err))
+	}
+
+	if fault := response.Body.Fault; fault != nil {
+		err := fmt.Errorf("%w: SOAP fault %s: %s", domain.ErrExchangeError, fault.Code, fault.String)
+		code := fault.Detail.ResponseCode
+		if code == "" {
+			// The fault code carries the response code with a namespace prefix
+			_, code, _ = strings.Cut(fault.Code, ":")
+		}
+		if transientEWSCodes[code] {
+			return &transientError{err: err, rejected: code == "ErrorServerBusy", retryAfter: fault.Detail.MessageXML.backOff()}
+		}
+		if resp.StatusCode == http.StatusInternalServerError {
+			// Exchange reports every fault with HTTP 500, the code tells whether it is transient
+			return err
+		}
+		return statusError(resp, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, fmt.Errorf("%w: unexpected HTTP status %d", domain.ErrExchangeError, resp.StatusCode))
+	}
+
+	// Throttling may also be reported per response message
+	for _, msg := range response.Body.messages() {
+		if msg.isError() && transientEWSCodes[msg.ResponseCode] {
+			return &transientError{
+				err:        fmt.Errorf("%w: %s: %s", domain.ErrExchangeError, msg.ResponseCode, msg.MessageText),
+				rejected:   msg.ResponseCode == "ErrorServerBusy",
+				retryAfter: msg.MessageXML.backOff(),
+			}
+		}
+	}
+
+	return nil
+}
+
+// statusError marks err as transient if the HTTP status indicates an overloaded
+// or unavailable server, honouring Retry-After given in seconds.
+func statusError(resp *http.Response, err error) error {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		var retryAfter time.Duration
+		if s, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && s > 0 {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		return &transientError{err: err, rejected: true, retryAfter: retryAfter}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return &transientError{err: err}
+	default:
+		return err
+	}
+}
+
+func (c *ewsClient) SyncCalendarChanges(ctx context.Context, syncState string) (*CalendarChanges, error) {
+	tracking := syncState != ""
+	updated := make(map[string]struct{})
+	deleted := make(map[string]struct{})
+
+	for {
+		req := &syncFolderItemsRequest{
+			ItemShape:          itemShape{BaseShape: "IdOnly"},
+			SyncFolderID:       c.calendarFolder(),
+			SyncState:          syncState,
+			MaxChangesReturned: ewsSyncBatchSize,
+		}
+
+		var resp soapResponse
+		if err := c.call(ctx, "SyncFolderItems", req, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Body.SyncFolderItemsResponse == nil || len(resp.Body.SyncFolderItemsResponse.Messages) == 0 {
+			return nil, fmt.Errorf("%w: empty SyncFolderItems response", domain.ErrExchangeError)
+		}
+
+		msg := resp.Body.SyncFolderItemsResponse.Messages[0]
+		if msg.isError() {
+			if msg.ResponseCode == "ErrorInvalidSyncStateData" {
+				return nil, ErrInvalidSyncState
+			}
+			return nil, fmt.Errorf("%w: SyncFolderItems: %s: %s", domain.ErrExchangeError, msg.ResponseCode, msg.MessageText)
+		}
+
+		if tracking {
+			// Changes are ordered, so a later change overrides an earlier one.
+			for _, change := range msg.Changes.Items {
+				id := change.id()
+				switch change.XMLName.Local {
+				case "Create", "Update":
+					delete(deleted, id)
+					updated[id] = struct{}{}
+				case "Delete":
+					delete(updated, id)
+					deleted[id] = struct{}{}
+				}
+			}
+		}
+
+		syncState = msg.SyncState
+		if msg.IncludesLastItemInRange {
+			break
+		}
+	}
+
+	changes := &CalendarChanges{SyncState: syncState}
+
+	ids := make([]requestItemID, 0, len(updated))
+	for id := range updated {
+		ids = append(ids, requestItemID{ID: id})
+	}
+	items, err := c.getCalendarItems(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	changes.Updated, err = c.toEvents(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range deleted {
+		changes.Deleted = append(changes.Deleted, id)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,343 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+// ewsOperations are the SOAP operations the stub recognises in request bodies.
+var ewsOperations = []string{"FindItem", "GetItem", "SyncFolderItems"}
+
+// ewsResponse is a recorded response served by ewsStub.
+type ewsResponse struct {
+	status int
+	file   string
+}
+
+// ewsStub is an EWS endpoint serving recorded SOAP envelopes from testdata,
+// in order, per operation. It records request bodies for assertions.
+type ewsStub struct {
+	t         *testing.T
+	mu        gosync.Mutex
+	responses map[string][]ewsResponse
+	requests  map[string][]string
+}
+
+func newEWSStub(t *testing.T, responses map[string][]ewsResponse) (*ewsStub, *ewsClient) {
+	t.Helper()
+
+	stub := &ewsStub{t: t, responses: responses, requests: make(map[string][]string)}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	cfg := config.ExchangeConfig{
+		URL: srv.URL + "/EWS/Exchange.asmx",
+		Retry: config.RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+		},
+	}
+	return stub, newEWSClient(cfg, srv.Client(), zap.NewNop())
+}
+
+func (s *ewsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("read request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	operation := ""
+	for _, op := range ewsOperations {
+		if strings.Contains(string(body), "<m:"+op+">") || strings.Contains(string(body), "<m:"+op+" ") {
+			operation = op
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.requests[operation] = append(s.requests[operation], string(body))
+	queue := s.responses[operation]
+	if len(queue) == 0 {
+		s.mu.Unlock()
+		s.t.Errorf("unexpected %q request", operation)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp := queue[0]
+	s.responses[operation] = queue[1:]
+	s.mu.Unlock()
+
+	envelope, err := os.ReadFile(filepath.Join("testdata", resp.file))
+	if err != nil {
+		s.t.Errorf("read recorded response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(envelope)
+}
+
+// sent returns the request bodies received for the operation.
+func (s *ewsStub) sent(operation string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests[operation])
+}
+
+func TestEWSClientGetCalendarEvents(t *testing.T) {
+	stub, client := newEWSStub(t, map[string][]ewsResponse{
+		"FindItem": {
+			{http.StatusOK, "find_item_page1.xml"},
+			{http.StatusOK, "find_item_page2.xml"},
+		},
+		"GetItem": {
+			{http.StatusOK, "get_item.xml"},
+		},
+	})
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	events, err := client.GetCalendarEvents(context.Background(), start, end)
+	if err != nil {
+		t.Fatalf("GetCalendarEvents: %v", err)
+	}
+
+	// The second CalendarView page starts at the last item of the first one
+	findRequests := stub.sent("FindItem")
+	if len(findRequests) != 2 {
+		t.Fatalf("FindItem requests = %d, want 2", len(findRequests))
+	}
+	if !strings.Contains(findRequests[0], `StartDate="2026-03-01T00:00:00Z"`) {
+		t.Errorf("first page does not start at the range start:\n%s", findRequests[0])
+	}
+	if !strings.Contains(findRequests[1], `StartDate="2026-03-03T07:30:00Z"`) {
+		t.Errorf("second page does not start at the last returned item:\n%s", findRequests[1])
+	}
+
+	// Items repeated across pages are requested once
+	getRequests := stub.sent("GetItem")
+	if len(getRequests) != 1 {
+		t.Fatalf("GetItem requests = %d, want 1", len(getRequests))
+	}
+	for _, id := range []string{"AAMkAGI2-item-1", "AAMkAGI2-item-2", "AAMkAGI2-item-3"} {
+		if n := strings.Count(getRequests[0], `Id="`+id+`"`); n != 1 {
+			t.Errorf("GetItem requests %s %d times, want once", id, n)
+		}
+	}
+
+	// item-3 disappeared before GetItem and is skipped
+	if len(events) != 2 {
+		t.Fatalf("events = %d, want 2", len(events))
+	}
+
+	got := events[0]
+	if got.ExchangeID != "AAMkAGI2-item-1" || got.ChangeKey != "DwAAABYAAAA1" {
+		t.Errorf("item ID = %q/%q", got.ExchangeID, got.ChangeKey)
+	}
+	if got.Subject != "Планёрка" {
+		t.Errorf("Subject = %q", got.Subject)
+	}
+	if got.Body != "Обсуждение планов на неделю" {
+		t.Errorf("Body = %q", got.Body)
+	}
+	if got.Location != "Переговорная 3" {
+		t.Errorf("Location = %q", got.Location)
+	}
+	if want := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC); !got.StartTime.Equal(want) || got.StartTime.Location() != time.UTC {
+		t.Errorf("StartTime = %v, want %v", got.StartTime, want)
+	}
+	if want := time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC); !got.EndTime.Equal(want) {
+		t.Errorf("EndTime = %v, want %v", got.EndTime, want)
+	}
+	if got.IsAllDay {
+		t.Error("IsAllDay = true")
+	}
+	if got.Organizer != "ivan.petrov@example.com" {
+		t.Errorf("Organizer = %q", got.Organizer)
+	}
+	if want := []string{"Работа", "Команда"}; !reflect.DeepEqual(got.Categories, want) {
+		t.Errorf("Categories = %v, want %v", got.Categories, want)
+	}
+	if got.Importance != "high" || got.Sensitivity != "private" {
+		t.Errorf("Importance/Sensitivity = %q/%q", got.Importance, got.Sensitivity)
+	}
+	if got.Status != domain.EventStatusConfirmed {
+		t.Errorf("Status = %q", got.Status)
+	}
+	if got.TimeZone != "Europe/Moscow" {
+		t.Errorf("TimeZone = %q", got.TimeZone)
+	}
+	if got.Recurrence != nil || got.IsException || got.OriginalStart != nil {
+		t.Errorf("single item converted as recurring: %+v", got)
+	}
+	wantAttendees := []domain.Attendee{
+		{Email: "ivan.petrov@example.com", Name: "Иван Петров", ResponseStatus: domain.ResponseStatusOrganizer},
+		{Email: "maria.sidorova@example.com", Name: "Мария Сидорова", ResponseStatus: domain.ResponseStatusAccepted},
+		{Email: "oleg.smirnov@example.com", Name: "Олег Смирнов", ResponseStatus: domain.ResponseStatusNone},
+	}
+	if !reflect.DeepEqual(got.Attendees, wantAttendees) {
+		t.Errorf("Attendees = %+v, want %+v", got.Attendees, wantAttendees)
+	}
+
+	if status := events[1].Status; status != domain.EventStatusTentative {
+		t.Errorf("second event Status = %q, want %q", status, domain.EventStatusTentative)
+	}
+}
+
+func TestEWSClientGetCalendarEventsStalledPaging(t *testing.T) {
+	// The second page repeats the first one, so the view cannot move on
+	stub, client := newEWSStub(t, map[string][]ewsResponse{
+		"FindItem": {
+			{http.StatusOK, "find_item_page1.xml"},
+			{http.StatusOK, "find_item_page1.xml"},
+		},
+	})
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	events, err := client.GetCalendarEvents(context.Background(), start, end)
+	if !errors.Is(err, domain.ErrExchangeError) {
+		t.Fatalf("GetCalendarEvents = %d events, %v; want ErrExchangeError", len(events), err)
+	}
+	if n := len(stub.sent("GetItem")); n != 0 {
+		t.Errorf("GetItem requests = %d for an incomplete list, want 0", n)
+	}
+}
+
+func TestEWSClientSyncCalendarChanges(t *testing.T) {
+	stub, client := newEWSStub(t, map[string][]ewsResponse{
+		"SyncFolderItems": {
+			{http.StatusOK, "sync_folder_items_page1.xml"},
+			{http.StatusOK, "sync_folder_items_page2.xml"},
+		},
+		"GetItem": {
+			{http.StatusOK, "get_item.xml"},
+		},
+	})
+
+	changes, err := client.SyncCalendarChanges(context.Background(), "H4sIAAAAAAAEAO29B2AcSZYlJi9tynt/SvV3")
+	if err != nil {
+		t.Fatalf("SyncCalendarChanges: %v", err)
+	}
+
+	// Each page continues from the sync state returned by the previous one
+	syncRequests := stub.sent("SyncFolderItems")
+	if len(syncRequests) != 2 {
+		t.Fatalf("SyncFolderItems requests = %d, want 2", len(syncRequests))
+	}
+	if !strings.Contains(syncRequests[1], "<m:SyncState>H4sIAAAAAAAEAO29B2AcSZYlJi9tynt/SvV4</m:SyncState>") {
+		t.Errorf("second page does not continue from the first sync state:\n%s", syncRequests[1])
+	}
+	if changes.SyncState != "H4sIAAAAAAAEAO29B2AcSZYlJi9tynt/SvV5" {
+		t.Errorf("SyncState = %q", changes.SyncState)
+	}
+
+	// item-4 was updated and then deleted, read flag changes are ignored
+	getRequests := stub.sent("GetItem")
+	if len(getRequests) != 1 {
+		t.Fatalf("GetItem requests = %d, want 1", len(getRequests))
+	}
+	for id, want := range map[string]int{"AAMkAGI2-item-1": 1, "AAMkAGI2-item-2": 1, "AAMkAGI2-item-4": 0, "AAMkAGI2-item-5": 0} {
+		if n := strings.Count(getRequests[0], `Id="`+id+`"`); n != want {
+			t.Errorf("GetItem requests %s %d times, want %d", id, n, want)
+		}
+	}
+
+	var updated []string
+	for _, e := range changes.Updated {
+		updated = append(updated, e.ExchangeID)
+	}
+	if want := []string{"AAMkAGI2-item-1", "AAMkAGI2-item-2"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("Updated = %v, want %v", updated, want)
+	}
+	if want := []string{"AAMkAGI2-item-4"}; !reflect.DeepEqual(changes.Deleted, want) {
+		t.Errorf("Deleted = %v, want %v", changes.Deleted, want)
+	}
+}
+
+func TestEWSClientSOAPFault(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("transient fault is retried", func(t *testing.T) {
+		stub, client := newEWSStub(t, map[string][]ewsResponse{
+			"FindItem": {
+				{http.StatusInternalServerError, "fault_server_busy.xml"},
+				{http.StatusOK, "find_item_page2.xml"},
+			},
+			"GetItem": {
+				{http.StatusOK, "get_item.xml"},
+			},
+		})
+
+		if _, err := client.GetCalendarEvents(context.Background(), start, end); err != nil {
+			t.Fatalf("GetCalendarEvents: %v", err)
+		}
+		if n := len(stub.sent("FindItem")); n != 2 {
+			t.Errorf("FindItem requests = %d, want 2", n)
+		}
+	})
+
+	t.Run("transient fault exhausts attempts", func(t *testing.T) {
+		stub, client := newEWSStub(t, map[string][]ewsResponse{
+			"FindItem": {
+				{http.StatusInternalServerError, "fault_server_busy.xml"},
+				{http.StatusInternalServerError, "fault_server_busy.xml"},
+				{http.StatusInternalServerError, "fault_server_busy.xml"},
+			},
+		})
+
+		_, err := client.GetCalendarEvents(context.Background(), start, end)
+		if !errors.Is(err, domain.ErrExchangeError) {
+			t.Fatalf("error = %v, want %v", err, domain.ErrExchangeError)
+		}
+		if !strings.Contains(err.Error(), "ErrorServerBusy") {
+			t.Errorf("error %q does not carry the fault code", err)
+		}
+		if n := len(stub.sent("FindItem")); n != 3 {
+			t.Errorf("FindItem requests = %d, want 3", n)
+		}
+	})
+
+	t.Run("permanent fault is not retried", func(t *testing.T) {
+		stub, client := newEWSStub(t, map[string][]ewsResponse{
+			"FindItem": {
+				{http.StatusInternalServerError, "fault_schema_validation.xml"},
+			},
+		})
+
+		_, err := client.GetCalendarEvents(context.Background(), start, end)
+		if !errors.Is(err, domain.ErrExchangeError) {
+			t.Fatalf("error = %v, want %v", err, domain.ErrExchangeError)
+		}
+		var te *transientError
+		if errors.As(err, &te) {
+			t.Errorf("permanent fault reported as transient: %v", err)
+		}
+		if n := len(stub.sent("FindItem")); n != 1 {
+			t.Errorf("FindItem requests = %d, want 1", n)
+		}
+	})
+}
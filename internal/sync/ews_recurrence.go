@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ewsRecurrence is the recurrence pattern and range of a series master.
+// Exactly one pattern and one range element is set.
+type ewsRecurrence struct {
+	Daily           *ewsRecurrencePattern `xml:"DailyRecurrence"`
+	Weekly          *ewsRecurrencePattern `xml:"WeeklyRecurrence"`
+	AbsoluteMonthly *ewsRecurrencePattern `xml:"AbsoluteMonthlyRecurrence"`
+	RelativeMonthly *ewsRecurrencePattern `xml:"RelativeMonthlyRecurrence"`
+	AbsoluteYearly  *ewsRecurrencePattern `xml:"AbsoluteYearlyRecurrence"`
+	RelativeYearly  *ewsRecurrencePattern `xml:"RelativeYearlyRecurrence"`
+
+	EndDate *struct {
+		EndDate string `xml:"EndDate"`
+	} `xml:"EndDateRecurrence"`
+	Numbered *struct {
+		NumberOfOccurrences int `xml:"NumberOfOccurrences"`
+	} `xml:"NumberedRecurrence"`
+}
+
+type ewsRecurrencePattern struct {
+	Interval       int    `xml:"Interval"`
+	DaysOfWeek     string `xml:"DaysOfWeek"`
+	FirstDayOfWeek string `xml:"FirstDayOfWeek"`
+	DayOfWeekIndex string `xml:"DayOfWeekIndex"`
+	DayOfMonth     int    `xml:"DayOfMonth"`
+	Month          string `xml:"Month"`
+}
+
+var ewsWeekdays = map[string][]string{
+	"Sunday":     {"SU"},
+	"Monday":     {"MO"},
+	"Tuesday":    {"TU"},
+	"Wednesday":  {"WE"},
+	"Thursday":   {"TH"},
+	"Friday":     {"FR"},
+	"Saturday":   {"SA"},
+	"Day":        {"MO", "TU", "WE", "TH", "FR", "SA", "SU"},
+	"Weekday":    {"MO", "TU", "WE", "TH", "FR"},
+	"WeekendDay": {"SA", "SU"},
+}
+
+var ewsWeekIndexes = map[string]int{
+	"First":  1,
+	"Second": 2,
+	"Third":  3,
+	"Fourth": 4,
+	"Last":   -1,
+}
+
+// rule converts the EWS recurrence to an RFC 5545 RRULE value. loc is the
+// time zone of the series, used to turn the inclusive end date into UNTIL.
+func (r *ewsRecurrence) rule(loc *time.Location) (string, error) {
+	var parts []string
+
+	switch {
+	case r.Daily != nil:
+		parts = append(parts, "FREQ=DAILY", interval(r.Daily.Interval))
+	case r.Weekly != nil:
+		days, err := weekdays(r.Weekly.DaysOfWeek)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "FREQ=WEEKLY", interval(r.Weekly.Interval), "BYDAY="+strings.Join(days, ","))
+		if wkst, err := weekdays(r.Weekly.FirstDayOfWeek); err == nil && len(wkst) == 1 {
+			parts = append(parts, "WKST="+wkst[0])
+		}
+	case r.AbsoluteMonthly != nil:
+		parts = append(parts, "FREQ=MONTHLY", interval(r.AbsoluteMonthly.Interval),
+			"BYMONTHDAY="+strconv.Itoa(r.AbsoluteMonthly.DayOfMonth))
+	case r.RelativeMonthly != nil:
+		byDay, err := relativeDays(r.RelativeMonthly)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "FREQ=MONTHLY", interval(r.RelativeMonthly.Interval))
+		parts = append(parts, byDay...)
+	case r.AbsoluteYearly != nil:
+		month, err := monthNumber(r.AbsoluteYearly.Month)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "FREQ=YEARLY", "BYMONTH="+strconv.Itoa(month),
+			"BYMONTHDAY="+strconv.Itoa(r.AbsoluteYearly.DayOfMonth))
+	case r.RelativeYearly != nil:
+		month, err := monthNumber(r.RelativeYearly.Month)
+		if err != nil {
+			return "", err
+		}
+		byDay, err := relativeDays(r.RelativeYearly)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "FREQ=YEARLY", "BYMONTH="+strconv.Itoa(month))
+		parts = append(parts, byDay...)
+	default:
+		return "", fmt.Errorf("unsupported recurrence pattern")
+	}
+
+	switch {
+	case r.Numbered != nil:
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Numbered.NumberOfOccurrences))
+	case r.EndDate != nil:
+		// EndDate is an xs:date, possibly with a zone offset suffix; it is inclusive.
+		day, err := time.ParseInLocation("2006-01-02", r.EndDate.EndDate[:min(10, len(r.EndDate.EndDate))], loc)
+		if err != nil {
+			return "", fmt.Errorf("invalid recurrence end date %q: %w", r.EndDate.EndDate, err)
+		}
+		until := day.AddDate(0, 0, 1).Add(-time.Second).UTC()
+		parts = append(parts, "UNTIL="+until.Format("20060102T150405Z"))
+	}
+
+	return strings.Join(parts, ";"), nil
+}
+
+func interval(n int) string {
+	return "INTERVAL=" + strconv.Itoa(max(n, 1))
+}
+
+// weekdays converts a space separated list of EWS days to RRULE weekdays.
+func weekdays(value string) ([]string, error) {
+	var result []string
+	for _, day := range strings.Fields(value) {
+		days, ok := ewsWeekdays[day]
+		if !ok {
+			return nil, fmt.Errorf("unknown day of week %q", day)
+		}
+		result = append(result, days...)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no days of week in recurrence")
+	}
+	return result, nil
+}
+
+// relativeDays converts "n-th weekday of the month" patterns to BYDAY/BYSETPOS parts.
+func relativeDays(p *ewsRecurrencePattern) ([]string, error) {
+	index, ok := ewsWeekIndexes[p.DayOfWeekIndex]
+	if !ok {
+		return nil, fmt.Errorf("unknown day of week index %q", p.DayOfWeekIndex)
+	}
+
+	if p.DaysOfWeek == "Day" {
+		return []string{"BYMONTHDAY=" + strconv.Itoa(index)}, nil
+	}
+
+	days, err := weekdays(p.DaysOfWeek)
+	if err != nil {
+		return nil, err
+	}
+	if len(days) == 1 {
+		return []string{"BYDAY=" + strconv.Itoa(index) + days[0]}, nil
+	}
+	return []string{"BYDAY=" + strings.Join(days, ","), "BYSETPOS=" + strconv.Itoa(index)}, nil
+}
+
+func monthNumber(name string) (int, error) {
+	for m := time.January; m <= time.December; m++ {
+		if m.String() == name {
+			return int(m), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown month %q", name)
+}
@@ -0,0 +1,554 @@
+package sync
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+)
+
+// EWS XML namespaces.
+const (
+	nsSoap     = "http://schemas.xmlsoap.org/soap/envelope/"
+	nsTypes    = "http://schemas.microsoft.com/exchange/services/2006/types"
+	nsMessages = "http://schemas.microsoft.com/exchange/services/2006/messages"
+)
+
+// ewsServerVersion is the schema version requested from Exchange.
+const ewsServerVersion = "Exchange2010_SP2"
+
+// Request envelope.
+
+type soapEnvelope struct {
+	XMLName xml.Name   `xml:"soap:Envelope"`
+	Soap    string     `xml:"xmlns:soap,attr"`
+	Types   string     `xml:"xmlns:t,attr"`
+	Msgs    string     `xml:"xmlns:m,attr"`
+	Header  soapHeader `xml:"soap:Header"`
+	Body    soapBody   `xml:"soap:Body"`
+}
+
+type soapHeader struct {
+	RequestServerVersion requestServerVersion `xml:"t:RequestServerVersion"`
+}
+
+type requestServerVersion struct {
+	Version string `xml:"Version,attr"`
+}
+
+type soapBody struct {
+	Content interface{}
+}
+
+func newSoapEnvelope(content interface{}) *soapEnvelope {
+	return &soapEnvelope{
+		Soap:   nsSoap,
+		Types:  nsTypes,
+		Msgs:   nsMessages,
+		Header: soapHeader{RequestServerVersion: requestServerVersion{Version: ewsServerVersion}},
+		Body:   soapBody{Content: content},
+	}
+}
+
+// Shared request types.
+
+type itemShape struct {
+	BaseShape            string                `xml:"t:BaseShape"`
+	BodyType             string                `xml:"t:BodyType,omitempty"`
+	AdditionalProperties *additionalProperties `xml:"t:AdditionalProperties,omitempty"`
+}
+
+type additionalProperties struct {
+	FieldURIs []fieldURI `xml:"t:FieldURI"`
+}
+
+type fieldURI struct {
+	FieldURI string `xml:"FieldURI,attr"`
+}
+
+type distinguishedFolderID struct {
+	ID string `xml:"Id,attr"`
+	// Mailbox selects a shared or delegated mailbox instead of the account's own
+	Mailbox *mailboxInput `xml:"t:Mailbox,omitempty"`
+}
+
+type parentFolderIDs struct {
+	DistinguishedFolderID distinguishedFolderID `xml:"t:DistinguishedFolderId"`
+}
+
+type requestItemID struct {
+	ID        string `xml:"Id,attr"`
+	ChangeKey string `xml:"ChangeKey,attr,omitempty"`
+}
+
+// FindItem request.
+
+type findItemRequest struct {
+	XMLName         xml.Name        `xml:"m:FindItem"`
+	Traversal       string          `xml:"Traversal,attr"`
+	ItemShape       itemShape       `xml:"m:ItemShape"`
+	CalendarView    calendarView    `xml:"m:CalendarView"`
+	ParentFolderIDs parentFolderIDs `xml:"m:ParentFolderIds"`
+}
+
+type calendarView struct {
+	MaxEntriesReturned int    `xml:"MaxEntriesReturned,attr"`
+	StartDate          string `xml:"StartDate,attr"`
+	EndDate            string `xml:"EndDate,attr"`
+}
+
+// GetItem request.
+
+type getItemRequest struct {
+	XMLName   xml.Name  `xml:"m:GetItem"`
+	ItemShape itemShape `xml:"m:ItemShape"`
+	ItemIDs   itemIDs   `xml:"m:ItemIds"`
+}
+
+type itemIDs struct {
+	ItemIDs                []requestItemID         `xml:"t:ItemId"`
+	RecurringMasterItemIDs []recurringMasterItemID `xml:"t:RecurringMasterItemId"`
+}
+
+// recurringMasterItemID addresses the series master of an occurrence or exception.
+type recurringMasterItemID struct {
+	OccurrenceID string `xml:"OccurrenceId,attr"`
+}
+
+// SyncFolderItems request.
+
+type syncFolderItemsRequest struct {
+	XMLName            xml.Name        `xml:"m:SyncFolderItems"`
+	ItemShape          itemShape       `xml:"m:ItemShape"`
+	SyncFolderID       parentFolderIDs `xml:"m:SyncFolderId"`
+	SyncState          string          `xml:"m:SyncState,omitempty"`
+	MaxChangesReturned int             `xml:"m:MaxChangesReturned"`
+}
+
+// CreateItem request.
+
+type createItemRequest struct {
+	XMLName                xml.Name        `xml:"m:CreateItem"`
+	SendMeetingInvitations string          `xml:"SendMeetingInvitations,attr"`
+	SavedItemFolderID      parentFolderIDs `xml:"m:SavedItemFolderId"`
+	Items                  createItems     `xml:"m:Items"`
+}
+
+type createItems struct {
+	CalendarItems []calendarItemInput `xml:"t:CalendarItem"`
+}
+
+// UpdateItem request.
+
+type updateItemRequest struct {
+	XMLName                               xml.Name    `xml:"m:UpdateItem"`
+	ConflictResolution                    string      `xml:"ConflictResolution,attr"`
+	SendMeetingInvitationsOrCancellations string      `xml:"SendMeetingInvitationsOrCancellations,attr"`
+	ItemChanges                           itemChanges `xml:"m:ItemChanges"`
+}
+
+type itemChanges struct {
+	ItemChanges []itemChange `xml:"t:ItemChange"`
+}
+
+type itemChange struct {
+	ItemID  requestItemID `xml:"t:ItemId"`
+	Updates itemUpdates   `xml:"t:Updates"`
+}
+
+type itemUpdates struct {
+	SetItemFields    []setItemField    `xml:"t:SetItemField"`
+	DeleteItemFields []deleteItemField `xml:"t:DeleteItemField"`
+}
+
+// setItemField replaces one property with the value carried by CalendarItem.
+type setItemField struct {
+	FieldURI     fieldURI          `xml:"t:FieldURI"`
+	CalendarItem calendarItemInput `xml:"t:CalendarItem"`
+}
+
+type deleteItemField struct {
+	FieldURI fieldURI `xml:"t:FieldURI"`
+}
+
+// DeleteItem request.
+
+type deleteItemRequest struct {
+	XMLName                  xml.Name `xml:"m:DeleteItem"`
+	DeleteType               string   `xml:"DeleteType,attr"`
+	SendMeetingCancellations string   `xml:"SendMeetingCancellations,attr"`
+	ItemIDs                  itemIDs  `xml:"m:ItemIds"`
+}
+
+// calendarItemInput is a calendar item sent to Exchange. EWS validates
+// element order against the schema, so fields follow the ItemType and
+// CalendarItemType sequence.
+type calendarItemInput struct {
+	Subject           string          `xml:"t:Subject,omitempty"`
+	Sensitivity       string          `xml:"t:Sensitivity,omitempty"`
+	Body              *bodyInput      `xml:"t:Body,omitempty"`
+	Categories        *stringsInput   `xml:"t:Categories,omitempty"`
+	Importance        string          `xml:"t:Importance,omitempty"`
+	Start             string          `xml:"t:Start,omitempty"`
+	End               string          `xml:"t:End,omitempty"`
+	IsAllDayEvent     *bool           `xml:"t:IsAllDayEvent,omitempty"`
+	Location          string          `xml:"t:Location,omitempty"`
+	RequiredAttendees *attendeesInput `xml:"t:RequiredAttendees,omitempty"`
+	StartTimeZone     *timeZoneInput  `xml:"t:StartTimeZone,omitempty"`
+	EndTimeZone       *timeZoneInput  `xml:"t:EndTimeZone,omitempty"`
+}
+
+type bodyInput struct {
+	BodyType string `xml:"BodyType,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type stringsInput struct {
+	Strings []string `xml:"t:String"`
+}
+
+type attendeesInput struct {
+	Attendees []attendeeInput `xml:"t:Attendee"`
+}
+
+type attendeeInput struct {
+	Mailbox mailboxInput `xml:"t:Mailbox"`
+}
+
+type mailboxInput struct {
+	Name         string `xml:"t:Name,omitempty"`
+	EmailAddress string `xml:"t:EmailAddress"`
+}
+
+type timeZoneInput struct {
+	ID string `xml:"Id,attr"`
+}
+
+// Response envelope.
+
+type soapResponse struct {
+	Body soapResponseBody `xml:"Body"`
+}
+
+type soapResponseBody struct {
+	Fault                   *soapFault               `xml:"Fault"`
+	FindItemResponse        *findItemResponse        `xml:"FindItemResponse"`
+	GetItemResponse         *getItemResponse         `xml:"GetItemResponse"`
+	SyncFolderItemsResponse *syncFolderItemsResponse `xml:"SyncFolderItemsResponse"`
+	CreateItemResponse      *createItemResponse      `xml:"CreateItemResponse"`
+	UpdateItemResponse      *updateItemResponse      `xml:"UpdateItemResponse"`
+	DeleteItemResponse      *deleteItemResponse      `xml:"DeleteItemResponse"`
+}
+
+type soapFault struct {
+	Code   string          `xml:"faultcode"`
+	String string          `xml:"faultstring"`
+	Detail soapFaultDetail `xml:"detail"`
+}
+
+// soapFaultDetail holds the EWS response code of a fault, e.g. ErrorServerBusy.
+type soapFaultDetail struct {
+	ResponseCode string     `xml:"ResponseCode"`
+	MessageXML   messageXML `xml:"MessageXml"`
+}
+
+// messageXML holds additional details of an error, such as BackOffMilliseconds.
+type messageXML struct {
+	Values []messageXMLValue `xml:"Value"`
+}
+
+type messageXMLValue struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// backOff returns the back-off requested by the server, or zero.
+func (m messageXML) backOff() time.Duration {
+	for _, v := range m.Values {
+		if v.Name != "BackOffMilliseconds" {
+			continue
+		}
+		if ms, err := strconv.Atoi(strings.TrimSpace(v.Value)); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 0
+}
+
+// responseMessage holds the status fields shared by all EWS response messages.
+type responseMessage struct {
+	ResponseClass string     `xml:"ResponseClass,attr"`
+	MessageText   string     `xml:"MessageText"`
+	ResponseCode  string     `xml:"ResponseCode"`
+	MessageXML    messageXML `xml:"MessageXml"`
+}
+
+func (m responseMessage) isError() bool {
+	return m.ResponseClass == "Error"
+}
+
+// messages returns the status of all response messages of the body.
+func (b *soapResponseBody) messages() []responseMessage {
+	var msgs []responseMessage
+	if r := b.FindItemResponse; r != nil {
+		for _, m := range r.Messages {
+			msgs = append(msgs, m.responseMessage)
+		}
+	}
+	var items []itemResponseMessage
+	if r := b.GetItemResponse; r != nil {
+		items = append(items, r.Messages...)
+	}
+	if r := b.CreateItemResponse; r != nil {
+		items = append(items, r.Messages...)
+	}
+	if r := b.UpdateItemResponse; r != nil {
+		items = append(items, r.Messages...)
+	}
+	for _, m := range items {
+		msgs = append(msgs, m.responseMessage)
+	}
+	if r := b.SyncFolderItemsResponse; r != nil {
+		for _, m := range r.Messages {
+			msgs = append(msgs, m.responseMessage)
+		}
+	}
+	if r := b.DeleteItemResponse; r != nil {
+		msgs = append(msgs, r.Messages...)
+	}
+	return msgs
+}
+
+type findItemResponse struct {
+	Messages []findItemResponseMessage `xml:"ResponseMessages>FindItemResponseMessage"`
+}
+
+type findItemResponseMessage struct {
+	responseMessage
+	RootFolder struct {
+		IncludesLastItemInRange bool              `xml:"IncludesLastItemInRange,attr"`
+		Items                   []ewsCalendarItem `xml:"Items>CalendarItem"`
+	} `xml:"RootFolder"`
+}
+
+type getItemResponse struct {
+	Messages []itemResponseMessage `xml:"ResponseMessages>GetItemResponseMessage"`
+}
+
+// itemResponseMessage is returned for each item by GetItem, CreateItem and UpdateItem.
+type itemResponseMessage struct {
+	responseMessage
+	Items []ewsCalendarItem `xml:"Items>CalendarItem"`
+}
+
+type createItemResponse struct {
+	Messages []itemResponseMessage `xml:"ResponseMessages>CreateItemResponseMessage"`
+}
+
+type updateItemResponse struct {
+	Messages []itemResponseMessage `xml:"ResponseMessages>UpdateItemResponseMessage"`
+}
+
+type deleteItemResponse struct {
+	Messages []responseMessage `xml:"ResponseMessages>DeleteItemResponseMessage"`
+}
+
+type syncFolderItemsResponse struct {
+	Messages []syncFolderItemsResponseMessage `xml:"ResponseMessages>SyncFolderItemsResponseMessage"`
+}
+
+type syncFolderItemsResponseMessage struct {
+	responseMessage
+	SyncState               string `xml:"SyncState"`
+	IncludesLastItemInRange bool   `xml:"IncludesLastItemInRange"`
+	Changes                 struct {
+		Items []syncChange `xml:",any"`
+	} `xml:"Changes"`
+}
+
+// syncChange is a single Create, Update, Delete or ReadFlagChange entry.
+// Create and Update wrap an item, Delete carries the item ID directly.
+type syncChange struct {
+	XMLName      xml.Name
+	ItemID       ewsItemID `xml:"ItemId"`
+	CalendarItem *struct {
+		ItemID ewsItemID `xml:"ItemId"`
+	} `xml:"CalendarItem"`
+}
+
+// id returns the ID of the changed item.
+func (c syncChange) id() string {
+	if c.CalendarItem != nil {
+		return c.CalendarItem.ItemID.ID
+	}
+	return c.ItemID.ID
+}
+
+// Calendar item.
+
+type ewsItemID struct {
+	ID        string `xml:"Id,attr"`
+	ChangeKey string `xml:"ChangeKey,attr"`
+}
+
+type ewsMailbox struct {
+	Name         string `xml:"Name"`
+	EmailAddress string `xml:"EmailAddress"`
+}
+
+type ewsAttendee struct {
+	Mailbox      ewsMailbox `xml:"Mailbox"`
+	ResponseType string     `xml:"ResponseType"`
+}
+
+type ewsCalendarItem struct {
+	ItemID               ewsItemID     `xml:"ItemId"`
+	Subject              string        `xml:"Subject"`
+	Body                 string        `xml:"Body"`
+	Categories           []string      `xml:"Categories>String"`
+	Importance           string        `xml:"Importance"`
+	Sensitivity          string        `xml:"Sensitivity"`
+	Start                time.Time     `xml:"Start"`
+	End                  time.Time     `xml:"End"`
+	IsAllDayEvent        bool          `xml:"IsAllDayEvent"`
+	IsCancelled          bool          `xml:"IsCancelled"`
+	LegacyFreeBusyStatus string        `xml:"LegacyFreeBusyStatus"`
+	Location             string        `xml:"Location"`
+	Organizer            ewsMailbox    `xml:"Organizer>Mailbox"`
+	RequiredAttendees    []ewsAttendee `xml:"RequiredAttendees>Attendee"`
+	OptionalAttendees    []ewsAttendee `xml:"OptionalAttendees>Attendee"`
+
+	UID                 string          `xml:"UID"`
+	CalendarItemType    string          `xml:"CalendarItemType"`
+	RecurrenceID        *time.Time      `xml:"RecurrenceId"`
+	Recurrence          *ewsRecurrence  `xml:"Recurrence"`
+	DeletedOccurrences  []time.Time     `xml:"DeletedOccurrences>DeletedOccurrence>Start"`
+	ModifiedOccurrences []ewsOccurrence `xml:"ModifiedOccurrences>Occurrence"`
+	StartTimeZone       struct {
+		ID string `xml:"Id,attr"`
+	} `xml:"StartTimeZone"`
+}
+
+// ewsOccurrence references a modified occurrence of a series master.
+type ewsOccurrence struct {
+	ItemID        ewsItemID `xml:"ItemId"`
+	OriginalStart time.Time `xml:"OriginalStart"`
+}
+
+// EWS calendar item types.
+const (
+	calendarItemSingle          = "Single"
+	calendarItemOccurrence      = "Occurrence"
+	calendarItemException       = "Exception"
+	calendarItemRecurringMaster = "RecurringMaster"
+)
+
+// calendarItemProperties are requested in addition to AllProperties, which
+// does not include all recurrence related fields on every Exchange version.
+var calendarItemProperties = []fieldURI{
+	{FieldURI: "calendar:UID"},
+	{FieldURI: "calendar:CalendarItemType"},
+	{FieldURI: "calendar:RecurrenceId"},
+	{FieldURI: "calendar:Recurrence"},
+	{FieldURI: "calendar:DeletedOccurrences"},
+	{FieldURI: "calendar:ModifiedOccurrences"},
+	{FieldURI: "calendar:StartTimeZone"},
+}
+
+// toDomain converts an EWS calendar item to a domain event.
+func (i *ewsCalendarItem) toDomain() *domain.Event {
+	event := domain.NewEvent()
+	event.ExchangeID = i.ItemID.ID
+	event.ChangeKey = i.ItemID.ChangeKey
+	event.Subject = i.Subject
+	event.Body = strings.TrimSpace(i.Body)
+	event.Location = i.Location
+	event.StartTime = i.Start.UTC()
+	event.EndTime = i.End.UTC()
+	event.IsAllDay = i.IsAllDayEvent
+	event.Organizer = i.Organizer.EmailAddress
+	event.Categories = i.Categories
+	event.Importance = strings.ToLower(i.Importance)
+	event.Sensitivity = strings.ToLower(i.Sensitivity)
+	event.Status = i.status()
+	event.TimeZone = recurrence.ZoneName(i.StartTimeZone.ID)
+
+	if i.CalendarItemType == calendarItemException || i.CalendarItemType == calendarItemOccurrence {
+		event.IsException = i.CalendarItemType == calendarItemException
+		if i.RecurrenceID != nil {
+			originalStart := i.RecurrenceID.UTC()
+			event.OriginalStart = &originalStart
+		}
+	}
+
+	for _, a := range append(i.RequiredAttendees, i.OptionalAttendees...) {
+		if a.Mailbox.EmailAddress == "" {
+			continue
+		}
+		event.Attendees = append(event.Attendees, domain.Attendee{
+			Email:          a.Mailbox.EmailAddress,
+			Name:           a.Mailbox.Name,
+			ResponseStatus: responseStatus(a.ResponseType),
+		})
+	}
+
+	return event
+}
+
+// seriesMasterToDomain converts a recurring master to a domain event carrying the recurrence rule.
+func (i *ewsCalendarItem) seriesMasterToDomain() (*domain.Event, error) {
+	event := i.toDomain()
+	if i.Recurrence == nil {
+		return event, nil
+	}
+
+	loc, _ := recurrence.LoadLocation(event.TimeZone)
+	rule, err := i.Recurrence.rule(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make([]time.Time, len(i.DeletedOccurrences))
+	for n, d := range i.DeletedOccurrences {
+		excluded[n] = d.UTC()
+	}
+
+	event.Recurrence = &domain.Recurrence{
+		Rule:          rule,
+		ExcludedDates: excluded,
+	}
+	return event, nil
+}
+
+// responseStatus maps an EWS ResponseType to an attendee response status.
+func responseStatus(responseType string) string {
+	switch responseType {
+	case "Organizer":
+		return domain.ResponseStatusOrganizer
+	case "Accept":
+		return domain.ResponseStatusAccepted
+	case "Tentative":
+		return domain.ResponseStatusTentative
+	case "Decline":
+		return domain.ResponseStatusDeclined
+	case "NoResponseReceived":
+		return domain.ResponseStatusNone
+	default:
+		return domain.ResponseStatusUnknown
+	}
+}
+
+// status maps EWS cancellation and free/busy flags to the event status.
+func (i *ewsCalendarItem) status() string {
+	switch {
+	case i.IsCancelled:
+		return domain.EventStatusCancelled
+	case i.LegacyFreeBusyStatus == "Tentative":
+		return domain.EventStatusTentative
+	default:
+		return domain.EventStatusConfirmed
+	}
+}
@@ -0,0 +1,263 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"go.uber.org/zap"
+)
+
+// Meeting notification modes used for write operations.
+const (
+	sendToAll     = "SendToAllAndSaveCopy"
+	sendToChanged = "SendToChangedAndSaveCopy"
+)
+
+func (c *ewsClient) CreateEvent(ctx context.Context, event *domain.Event) (*domain.Event, error) {
+	req := &createItemRequest{
+		SendMeetingInvitations: sendToAll,
+		SavedItemFolderID:      c.calendarFolder(),
+		Items:                  createItems{CalendarItems: []calendarItemInput{newCalendarItemInput(event)}},
+	}
+
+	var resp soapResponse
+	if err := c.callWrite(ctx, "CreateItem", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Body.CreateItemResponse == nil || len(resp.Body.CreateItemResponse.Messages) == 0 {
+		return nil, fmt.Errorf("%w: empty CreateItem response", domain.ErrExchangeError)
+	}
+
+	msg := resp.Body.CreateItemResponse.Messages[0]
+	if msg.isError() {
+		return nil, itemError("CreateItem", msg.responseMessage)
+	}
+	if len(msg.Items) == 0 {
+		return nil, fmt.Errorf("%w: CreateItem returned no item", domain.ErrExchangeError)
+	}
+
+	c.logger.Info("created calendar item in Exchange", zap.String("exchange_id", msg.Items[0].ItemID.ID))
+
+	return c.getEvent(ctx, msg.Items[0].ItemID.ID)
+}
+
+func (c *ewsClient) UpdateEvent(ctx context.Context, exchangeID string, input domain.EventInput) (*domain.Event, error) {
+	updates := newItemUpdates(input)
+	if len(updates.SetItemFields) > 0 || len(updates.DeleteItemFields) > 0 {
+		// Items are overwritten without a change key: the mirror does not
+		// track change keys, so the last writer wins.
+		req := &updateItemRequest{
+			ConflictResolution:                    "AlwaysOverwrite",
+			SendMeetingInvitationsOrCancellations: sendToChanged,
+			ItemChanges: itemChanges{ItemChanges: []itemChange{{
+				ItemID:  requestItemID{ID: exchangeID},
+				Updates: updates,
+			}}},
+		}
+
+		var resp soapResponse
+		if err := c.callWrite(ctx, "UpdateItem", req, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Body.UpdateItemResponse == nil || len(resp.Body.UpdateItemResponse.Messages) == 0 {
+			return nil, fmt.Errorf("%w: empty UpdateItem response", domain.ErrExchangeError)
+		}
+
+		msg := resp.Body.UpdateItemResponse.Messages[0]
+		if msg.isError() {
+			return nil, itemError("UpdateItem", msg.responseMessage)
+		}
+	}
+
+	return c.getEvent(ctx, exchangeID)
+}
+
+func (c *ewsClient) DeleteEvent(ctx context.Context, exchangeID string) error {
+	req := &deleteItemRequest{
+		DeleteType:               "MoveToDeletedItems",
+		SendMeetingCancellations: sendToAll,
+		ItemIDs:                  itemIDs{ItemIDs: []requestItemID{{ID: exchangeID}}},
+	}
+
+	var resp soapResponse
+	if err := c.callWrite(ctx, "DeleteItem", req, &resp); err != nil {
+		return err
+	}
+	if resp.Body.DeleteItemResponse == nil || len(resp.Body.DeleteItemResponse.Messages) == 0 {
+		return fmt.Errorf("%w: empty DeleteItem response", domain.ErrExchangeError)
+	}
+
+	msg := resp.Body.DeleteItemResponse.Messages[0]
+	if msg.isError() {
+		if msg.ResponseCode == "ErrorItemNotFound" {
+			// Already deleted in Exchange.
+			return nil
+		}
+		return itemError("DeleteItem", msg)
+	}
+
+	return nil
+}
+
+// getEvent loads a single calendar item and converts it to a domain event.
+func (c *ewsClient) getEvent(ctx context.Context, exchangeID string) (*domain.Event, error) {
+	items, err := c.getItems(ctx, itemIDs{ItemIDs: []requestItemID{{ID: exchangeID}}})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: %w: item %s", domain.ErrExchangeError, domain.ErrEventNotFound, exchangeID)
+	}
+
+	item := items[0]
+	if item.CalendarItemType != calendarItemRecurringMaster {
+		return item.toDomain(), nil
+	}
+
+	event, err := item.seriesMasterToDomain()
+	if err != nil {
+		c.logger.Warn("unsupported recurrence, storing series master as a single event",
+			zap.String("exchange_id", item.ItemID.ID),
+			zap.Error(err),
+		)
+		return item.toDomain(), nil
+	}
+	return event, nil
+}
+
+// itemError maps a failed item response message to a domain error.
+func itemError(operation string, msg responseMessage) error {
+	var kind error
+	switch msg.ResponseCode {
+	case "ErrorItemNotFound":
+		kind = domain.ErrEventNotFound
+	case "ErrorIrresolvableConflict", "ErrorChangeKeyRequiredForWriteOperations":
+		kind = domain.ErrConflict
+	case "ErrorCalendarEndDateIsEarlierThanStartDate", "ErrorCalendarDurationIsTooLong",
+		"ErrorInvalidRecipients", "ErrorInvalidSmtpAddress", "ErrorTimeZone":
+		kind = domain.ErrInvalidInput
+	default:
+		return fmt.Errorf("%w: %s: %s: %s", domain.ErrExchangeError, operation, msg.ResponseCode, msg.MessageText)
+	}
+	return fmt.Errorf("%w: %w: %s: %s: %s", domain.ErrExchangeError, kind, operation, msg.ResponseCode, msg.MessageText)
+}
+
+// newCalendarItemInput converts a domain event to a calendar item for CreateItem.
+func newCalendarItemInput(e *domain.Event) calendarItemInput {
+	isAllDay := e.IsAllDay
+	item := calendarItemInput{
+		Subject:       e.Subject,
+		Sensitivity:   ewsEnum(e.Sensitivity),
+		Importance:    ewsEnum(e.Importance),
+		Start:         formatEWSTime(e.StartTime),
+		End:           formatEWSTime(e.EndTime),
+		IsAllDayEvent: &isAllDay,
+		Location:      e.Location,
+	}
+	if e.Body != "" {
+		item.Body = &bodyInput{BodyType: "Text", Value: e.Body}
+	}
+	if len(e.Categories) > 0 {
+		item.Categories = &stringsInput{Strings: e.Categories}
+	}
+	if len(e.Attendees) > 0 {
+		item.RequiredAttendees = newAttendeesInput(e.Attendees)
+	}
+	if zone := recurrence.WindowsZoneName(e.TimeZone); zone != "" {
+		item.StartTimeZone = &timeZoneInput{ID: zone}
+		item.EndTimeZone = &timeZoneInput{ID: zone}
+	}
+	return item
+}
+
+// newItemUpdates converts the set fields of input to UpdateItem changes.
+// Fields set to an empty value are deleted from the item.
+func newItemUpdates(input domain.EventInput) itemUpdates {
+	var u itemUpdates
+	set := func(uri string, item calendarItemInput) {
+		u.SetItemFields = append(u.SetItemFields, setItemField{FieldURI: fieldURI{FieldURI: uri}, CalendarItem: item})
+	}
+	remove := func(uri string) {
+		u.DeleteItemFields = append(u.DeleteItemFields, deleteItemField{FieldURI: fieldURI{FieldURI: uri}})
+	}
+
+	if input.Subject != nil {
+		set("item:Subject", calendarItemInput{Subject: *input.Subject})
+	}
+	if input.Sensitivity != nil {
+		set("item:Sensitivity", calendarItemInput{Sensitivity: ewsEnum(*input.Sensitivity)})
+	}
+	if input.Body != nil {
+		if *input.Body == "" {
+			remove("item:Body")
+		} else {
+			set("item:Body", calendarItemInput{Body: &bodyInput{BodyType: "Text", Value: *input.Body}})
+		}
+	}
+	if input.Categories != nil {
+		if len(*input.Categories) == 0 {
+			remove("item:Categories")
+		} else {
+			set("item:Categories", calendarItemInput{Categories: &stringsInput{Strings: *input.Categories}})
+		}
+	}
+	if input.Importance != nil {
+		set("item:Importance", calendarItemInput{Importance: ewsEnum(*input.Importance)})
+	}
+	if input.StartTime != nil {
+		set("calendar:Start", calendarItemInput{Start: formatEWSTime(*input.StartTime)})
+	}
+	if input.EndTime != nil {
+		set("calendar:End", calendarItemInput{End: formatEWSTime(*input.EndTime)})
+	}
+	if input.IsAllDay != nil {
+		isAllDay := *input.IsAllDay
+		set("calendar:IsAllDayEvent", calendarItemInput{IsAllDayEvent: &isAllDay})
+	}
+	if input.Location != nil {
+		if *input.Location == "" {
+			remove("calendar:Location")
+		} else {
+			set("calendar:Location", calendarItemInput{Location: *input.Location})
+		}
+	}
+	if input.Attendees != nil {
+		if len(*input.Attendees) == 0 {
+			remove("calendar:RequiredAttendees")
+		} else {
+			set("calendar:RequiredAttendees", calendarItemInput{RequiredAttendees: newAttendeesInput(*input.Attendees)})
+		}
+	}
+	if input.TimeZone != nil {
+		if zone := recurrence.WindowsZoneName(*input.TimeZone); zone != "" {
+			set("calendar:StartTimeZone", calendarItemInput{StartTimeZone: &timeZoneInput{ID: zone}})
+			set("calendar:EndTimeZone", calendarItemInput{EndTimeZone: &timeZoneInput{ID: zone}})
+		}
+	}
+
+	return u
+}
+
+func newAttendeesInput(attendees []domain.Attendee) *attendeesInput {
+	result := &attendeesInput{Attendees: make([]attendeeInput, len(attendees))}
+	for i, a := range attendees {
+		result.Attendees[i] = attendeeInput{Mailbox: mailboxInput{Name: a.Name, EmailAddress: a.Email}}
+	}
+	return result
+}
+
+// ewsEnum converts a lowercase domain value such as "private" to the EWS enumeration value "Private".
+func ewsEnum(value string) string {
+	if value == "" {
+		return ""
+	}
+	return strings.ToUpper(value[:1]) + value[1:]
+}
+
+func formatEWSTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -2,14 +2,50 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/anmaslov/calendar/internal/domain"
 )
 
+// ErrInvalidSyncState is returned when Exchange no longer accepts a stored sync state.
+var ErrInvalidSyncState = errors.New("invalid sync state")
+
+// Source provides calendar events to the sync worker.
+type Source interface {
+	// GetCalendarEvents fetches events within the date range. Recurring series
+	// are returned as series masters together with their exceptions.
+	GetCalendarEvents(ctx context.Context, startDate, endDate time.Time) ([]*domain.Event, error)
+}
+
 // ExchangeClient defines the interface for Exchange server communication.
 type ExchangeClient interface {
-	// GetCalendarEvents fetches calendar events from Exchange server.
-	GetCalendarEvents(ctx context.Context, startDate, endDate time.Time) ([]*domain.Event, error)
+	Source
+
+	// CreateEvent creates the event in the Exchange calendar and returns it as stored by Exchange.
+	CreateEvent(ctx context.Context, event *domain.Event) (*domain.Event, error)
+
+	// UpdateEvent applies the set fields of input to the Exchange item and returns the updated event.
+	UpdateEvent(ctx context.Context, exchangeID string, input domain.EventInput) (*domain.Event, error)
+
+	// DeleteEvent deletes the Exchange item. Deleting a series master deletes the whole series.
+	DeleteEvent(ctx context.Context, exchangeID string) error
 }
 
+// IncrementalClient is implemented by clients that can report calendar changes
+// since a previously returned sync state.
+type IncrementalClient interface {
+	// SyncCalendarChanges returns changes made since syncState.
+	// An empty syncState returns no changes, only the current state to start tracking from.
+	SyncCalendarChanges(ctx context.Context, syncState string) (*CalendarChanges, error)
+}
+
+// CalendarChanges describes calendar changes since the previous sync state.
+type CalendarChanges struct {
+	// Updated holds created and updated events.
+	Updated []*domain.Event
+	// Deleted holds Exchange IDs of deleted events.
+	Deleted []string
+	// SyncState is the state to pass on the next call.
+	SyncState string
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/ical"
+	"github.com/anmaslov/calendar/internal/recurrence"
+	"go.uber.org/zap"
+)
+
+// icalRequestTimeout bounds downloading an iCalendar feed.
+const icalRequestTimeout = 60 * time.Second
+
+// icalSource is a Source reading an iCalendar feed from an HTTP URL or a local file.
+type icalSource struct {
+	url        string
+	maxSize    int64
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewICalSource creates a source for the iCalendar feed at url. Feeds larger
+// than maxSize bytes are rejected.
+func NewICalSource(url string, maxSize int64, logger *zap.Logger) Source {
+	return &icalSource{
+		url:        url,
+		maxSize:    maxSize,
+		httpClient: &http.Client{Timeout: icalRequestTimeout},
+		logger:     logger,
+	}
+}
+
+// GetCalendarEvents downloads and parses the whole feed and returns events
+// overlapping the date range. Series masters are returned when any part of
+// the series overlaps the range, together with all their exceptions.
+// Malformed events are logged and skipped.
+func (s *icalSource) GetCalendarEvents(ctx context.Context, startDate, endDate time.Time) ([]*domain.Event, error) {
+	body, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	events, skipped, err := ical.NewDecoder(body, s.maxSize).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrSyncFailed, err)
+	}
+	for _, e := range skipped {
+		s.logger.Warn("skipping invalid iCalendar event",
+			zap.String("uid", e.UID),
+			zap.Error(e.Err),
+		)
+	}
+
+	s.logger.Debug("parsed iCalendar feed", zap.Int("count", len(events)))
+
+	return eventsInRange(events, startDate, endDate), nil
+}
+
+// open returns the feed contents. URLs with the webcal scheme are fetched over HTTPS.
+func (s *icalSource) open(ctx context.Context) (io.ReadCloser, error) {
+	url := s.url
+	if rest, ok := strings.CutPrefix(url, "webcal://"); ok {
+		url = "https://" + rest
+	}
+
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		f, err := os.Open(strings.TrimPrefix(url, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to open iCalendar file: %v", domain.ErrSyncFailed, err)
+		}
+		return f, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create iCalendar request: %w", err)
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch iCalendar feed: %v", domain.ErrSyncFailed, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: iCalendar feed returned HTTP %d", domain.ErrSyncFailed, resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// eventsInRange selects events overlapping [startDate, endDate): single
+// events by their own times, series masters by the span of the whole series.
+// Exceptions are kept with their master or when they overlap the range.
+func eventsInRange(events []*domain.Event, startDate, endDate time.Time) []*domain.Event {
+	masters := make(map[string]struct{})
+	for _, e := range events {
+		if e.IsSeriesMaster() && seriesOverlaps(e, startDate, endDate) {
+			masters[e.ExchangeID] = struct{}{}
+		}
+	}
+
+	var result []*domain.Event
+	for _, e := range events {
+		var keep bool
+		switch {
+		case e.IsSeriesMaster():
+			_, keep = masters[e.ExchangeID]
+		case e.SeriesMasterID != "":
+			_, keep = masters[e.SeriesMasterID]
+			keep = keep || overlaps(e.StartTime, e.EndTime, startDate, endDate)
+		default:
+			keep = overlaps(e.StartTime, e.EndTime, startDate, endDate)
+		}
+		if keep {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// seriesOverlaps reports whether any part of the series may fall within the range.
+func seriesOverlaps(master *domain.Event, startDate, endDate time.Time) bool {
+	if !master.StartTime.Before(endDate) {
+		return false
+	}
+
+	loc, _ := recurrence.LoadLocation(master.TimeZone)
+	series := recurrence.Series{Rule: master.Recurrence.Rule, Start: master.StartTime, Location: loc}
+
+	last, bounded, err := series.Last()
+	if err != nil || !bounded {
+		return true
+	}
+	return last.Add(master.EndTime.Sub(master.StartTime)).After(startDate)
+}
+
+// overlaps matches the window used when deleting stale events of a calendar.
+func overlaps(start, end, rangeStart, rangeEnd time.Time) bool {
+	return start.Before(rangeEnd) && end.After(rangeStart)
+}
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+// testFeed has a single event, a series of early January 2024 with an
+// exception moved past it, a weekly series without an end and an event
+// without DTSTART.
+var testFeed = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"VERSION:2.0",
+	"BEGIN:VEVENT",
+	"UID:single",
+	"DTSTART:20240115T100000Z",
+	"DTEND:20240115T110000Z",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:finished",
+	"DTSTART:20240101T090000Z",
+	"DTEND:20240101T091500Z",
+	"RRULE:FREQ=DAILY;COUNT=3",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:finished",
+	"RECURRENCE-ID:20240102T090000Z",
+	"DTSTART:20240120T090000Z",
+	"DTEND:20240120T091500Z",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:open",
+	"DTSTART:20231201T090000Z",
+	"DTEND:20231201T091500Z",
+	"RRULE:FREQ=WEEKLY",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:broken",
+	"SUMMARY:No start",
+	"END:VEVENT",
+	"END:VCALENDAR",
+	"",
+}, "\r\n")
+
+func TestICalSourceGetCalendarEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(testFeed))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "feed.ics")
+	if err := os.WriteFile(path, []byte(testFeed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		from    time.Time
+		to      time.Time
+		want    []string
+		maxSize int64
+		wantErr bool
+	}{
+		{
+			name: "HTTP feed",
+			url:  srv.URL,
+			from: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			// The exception is moved into the range, its series is not in it
+			want:    []string{"single", "finished/20240102T090000Z", "open"},
+			maxSize: int64(len(testFeed)),
+		},
+		{
+			name:    "file",
+			url:     "file://" + path,
+			from:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+			want:    []string{"finished", "finished/20240102T090000Z", "open"},
+			maxSize: int64(len(testFeed)),
+		},
+		{
+			name:    "feed over the size limit",
+			url:     srv.URL,
+			from:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			maxSize: int64(len(testFeed)) - 1,
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			url:     filepath.Join(t.TempDir(), "missing.ics"),
+			maxSize: int64(len(testFeed)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewICalSource(tt.url, tt.maxSize, zap.NewNop())
+
+			events, err := source.GetCalendarEvents(context.Background(), tt.from, tt.to)
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrSyncFailed) {
+					t.Errorf("GetCalendarEvents() error = %v, want %v", err, domain.ErrSyncFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCalendarEvents: %v", err)
+			}
+
+			var got []string
+			for _, e := range events {
+				got = append(got, e.ExchangeID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
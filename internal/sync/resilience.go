@@ -0,0 +1,235 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/backoff"
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without calling Exchange while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("exchange circuit breaker is open")
+
+// transientEWSCodes are EWS response codes of failures that may succeed when retried.
+var transientEWSCodes = map[string]bool{
+	"ErrorServerBusy":                   true,
+	"ErrorInternalServerTransientError": true,
+	"ErrorTimeoutExpired":               true,
+	"ErrorMailboxStoreUnavailable":      true,
+	"ErrorMailboxMoveInProgress":        true,
+	"ErrorConnectionFailed":             true,
+}
+
+// transientError marks a failure that may succeed when retried. Rejected
+// reports that Exchange refused the request without processing it, so that
+// even requests with side effects can be repeated. RetryAfter is the back-off
+// requested by the server, if any.
+type transientError struct {
+	err        error
+	rejected   bool
+	retryAfter time.Duration
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// retrier runs Exchange calls through the circuit breaker and retries
+// transient failures with jittered exponential backoff.
+type retrier struct {
+	cfg     config.RetryConfig
+	breaker *circuitBreaker
+	logger  *zap.Logger
+}
+
+// newRetrier creates a retrier with its own circuit breaker.
+func newRetrier(cfg config.ExchangeConfig, logger *zap.Logger) *retrier {
+	return &retrier{
+		cfg:     cfg.Retry,
+		breaker: &circuitBreaker{cfg: cfg.CircuitBreaker, state: domain.CircuitClosed, logger: logger},
+		logger:  logger,
+	}
+}
+
+// do calls fn until it succeeds, fails permanently or runs out of attempts.
+// Unless idempotent, only requests Exchange rejected unprocessed are repeated.
+// The whole operation counts as one call for the circuit breaker.
+func (r *retrier) do(ctx context.Context, operation string, idempotent bool, fn func(context.Context) error) error {
+	if err := r.breaker.allow(); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+
+		var te *transientError
+		if err == nil || !errors.As(err, &te) {
+			break
+		}
+		if te.retryAfter > r.cfg.MaxBackoff {
+			// Exchange asks to back off longer than a retry may wait, so stop
+			// calling it until then
+			r.breaker.openUntil(time.Now().Add(te.retryAfter))
+			break
+		}
+		if (!idempotent && !te.rejected) || attempt >= r.cfg.MaxAttempts {
+			break
+		}
+
+		delay := max(backoff.Delay(r.cfg, attempt), te.retryAfter)
+
+		r.logger.Warn("exchange call failed, retrying",
+			zap.String("operation", operation),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.breaker.record(ctx, ctx.Err())
+			return err
+		case <-timer.C:
+		}
+	}
+
+	r.breaker.record(ctx, err)
+	return err
+}
+
+// circuitBreaker stops calls to Exchange after cfg.FailureThreshold
+// consecutive transient failures. After cfg.OpenTimeout it lets a single
+// trial call through (half-open): success closes the circuit, failure opens
+// it again. Permanent errors, such as a missing item, show that Exchange is
+// reachable and count as success.
+type circuitBreaker struct {
+	cfg    config.CircuitBreakerConfig
+	logger *zap.Logger
+
+	mu       gosync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	retryAt  time.Time
+	trial    bool
+}
+
+// allow returns an error if the call must not reach Exchange.
+func (b *circuitBreaker) allow() error {
+	if b.cfg.FailureThreshold == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case domain.CircuitOpen:
+		if time.Now().Before(b.retryAt) {
+			return fmt.Errorf("%w: %w until %s", domain.ErrExchangeError, ErrCircuitOpen, b.retryAt.Format(time.RFC3339))
+		}
+		b.state = domain.CircuitHalfOpen
+		b.logger.Info("exchange circuit breaker is half-open, trying a call")
+	case domain.CircuitHalfOpen:
+		if b.trial {
+			return fmt.Errorf("%w: %w, trial call in progress", domain.ErrExchangeError, ErrCircuitOpen)
+		}
+	default:
+		return nil
+	}
+
+	b.trial = true
+	return nil
+}
+
+// record updates the circuit with the result of an allowed call made with ctx.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b.cfg.FailureThreshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+
+	// A call cancelled or timed out by the caller says nothing about Exchange
+	if errors.Is(err, context.Canceled) || (ctx.Err() != nil && errors.Is(err, context.DeadlineExceeded)) {
+		if b.state == domain.CircuitHalfOpen {
+			b.state = domain.CircuitOpen
+		}
+		return
+	}
+
+	var te *transientError
+	if !errors.As(err, &te) {
+		if b.state != domain.CircuitClosed {
+			b.logger.Info("exchange circuit breaker closed")
+		}
+		b.state = domain.CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == domain.CircuitHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.open(time.Now().Add(b.cfg.OpenTimeout))
+	}
+}
+
+// openUntil opens the circuit at least until the given time.
+func (b *circuitBreaker) openUntil(until time.Time) {
+	if b.cfg.FailureThreshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.open(until)
+}
+
+func (b *circuitBreaker) open(until time.Time) {
+	if b.state != domain.CircuitOpen {
+		b.openedAt = time.Now()
+		b.retryAt = until
+		b.logger.Warn("exchange circuit breaker opened",
+			zap.Int("consecutive_failures", b.failures),
+			zap.Time("retry_at", until),
+		)
+	}
+	b.state = domain.CircuitOpen
+	if until.After(b.retryAt) {
+		b.retryAt = until
+	}
+}
+
+// State returns the current state of the circuit.
+func (b *circuitBreaker) State() domain.CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := domain.CircuitState{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != domain.CircuitClosed {
+		openedAt, retryAt := b.openedAt, b.retryAt
+		state.OpenedAt = &openedAt
+		state.RetryAt = &retryAt
+	}
+	return state
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreakerCallerDeadline(t *testing.T) {
+	expired := func(t *testing.T) context.Context {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		t.Cleanup(cancel)
+		return ctx
+	}
+	// timedOut fails the way send does when the caller's context expires
+	timedOut := func(ctx context.Context) error {
+		return fmt.Errorf("%w: %w", domain.ErrExchangeError, ctx.Err())
+	}
+
+	newRetrier := func(state string, failures int) *retrier {
+		return &retrier{
+			cfg: config.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+			breaker: &circuitBreaker{
+				cfg:      config.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute},
+				state:    state,
+				failures: failures,
+				logger:   zap.NewNop(),
+			},
+			logger: zap.NewNop(),
+		}
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		r := newRetrier(domain.CircuitClosed, 1)
+		if err := r.do(expired(t), "GetItem", true, timedOut); err == nil {
+			t.Fatal("do succeeded after the deadline")
+		}
+		if state := r.breaker.State(); state.State != domain.CircuitClosed || state.ConsecutiveFailures != 1 {
+			t.Errorf("breaker = %+v, want closed with the failure kept", state)
+		}
+	})
+
+	t.Run("half-open", func(t *testing.T) {
+		r := newRetrier(domain.CircuitOpen, 2)
+		r.breaker.retryAt = time.Now().Add(-time.Second)
+		if err := r.do(expired(t), "GetItem", true, timedOut); err == nil {
+			t.Fatal("do succeeded after the deadline")
+		}
+		if state := r.breaker.State(); state.State != domain.CircuitOpen {
+			t.Errorf("breaker = %+v, want the trial call to leave it open", state)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SourceFactory creates sources and Exchange clients for calendars.
+type SourceFactory interface {
+	// Source returns the source events of the calendar are synchronized from.
+	Source(cal *domain.Calendar) (Source, error)
+
+	// ExchangeClient returns a client for the mailbox of an Exchange calendar.
+	ExchangeClient(cal *domain.Calendar) (ExchangeClient, error)
+
+	// ExchangeCircuit returns the state of the circuit breaker shared by all Exchange calls.
+	ExchangeCircuit() domain.CircuitState
+}
+
+// sourceFactory creates EWS clients sharing one authenticated HTTP client,
+// so connections to Exchange are reused across mailboxes, and one circuit
+// breaker, so an unavailable server is not called for every mailbox.
+type sourceFactory struct {
+	exchange    *ewsClient
+	icalMaxSize int64
+	logger      *zap.Logger
+}
+
+// NewSourceFactory creates a source factory. Exchange calendars are accessed
+// with the account from cfg, which needs delegate or impersonation rights on
+// mailboxes other than its own. iCalendar feeds are limited to the size
+// from icalCfg.
+func NewSourceFactory(cfg config.ExchangeConfig, icalCfg config.ICalConfig, logger *zap.Logger) SourceFactory {
+	return &sourceFactory{
+		exchange:    newEWSClient(cfg, newHTTPClient(cfg), logger),
+		icalMaxSize: icalCfg.MaxSize,
+		logger:      logger,
+	}
+}
+
+func (f *sourceFactory) Source(cal *domain.Calendar) (Source, error) {
+	switch cal.SourceType {
+	case domain.CalendarSourceExchange:
+		return f.exchange.forMailbox(cal.Mailbox), nil
+	case domain.CalendarSourceICal:
+		return NewICalSource(cal.URL, f.icalMaxSize, f.logger.With(zap.String("calendar", cal.Name))), nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q of calendar %s", cal.SourceType, cal.Name)
+	}
+}
+
+func (f *sourceFactory) ExchangeClient(cal *domain.Calendar) (ExchangeClient, error) {
+	if cal.SourceType != domain.CalendarSourceExchange {
+		return nil, fmt.Errorf("%w: calendar %s is read-only", domain.ErrConflict, cal.Name)
+	}
+	return f.exchange.forMailbox(cal.Mailbox), nil
+}
+
+func (f *sourceFactory) ExchangeCircuit() domain.CircuitState {
+	return f.exchange.retrier.breaker.State()
+}
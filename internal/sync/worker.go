@@ -2,38 +2,75 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	gosync "sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
 	"github.com/anmaslov/calendar/internal/repository"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
-// Worker handles background synchronization with Exchange server.
+// errCalendarDisabled fails requested runs of calendars disabled in the meantime.
+var errCalendarDisabled = errors.New("calendar is disabled")
+
+// errRunTimedOut fails runs left running by a replica that stopped midway.
+var errRunTimedOut = errors.New("sync run did not finish within the run timeout")
+
+// Worker handles background synchronization of all enabled calendars. Each
+// cycle synchronizes the calendars concurrently, at most cfg.Concurrency at a time.
+//
+// With a leader lock only the replica holding it synchronizes. The lock is
+// checked before every cycle; standby replicas retry every
+// cfg.LeaderRetryInterval and take over once the leader is gone.
+//
+// Runs requested through the API are stored as pending; the leader picks them
+// up every cfg.TriggerPollInterval, or immediately after Wake. Runs left
+// running by a crashed leader are marked failed after cfg.RunTimeout. After
+// every cycle the leader deletes runs and event changes older than their
+// retention periods.
 type Worker struct {
-	syncRepo       repository.EventSyncRepository
-	exchangeClient ExchangeClient
-	cfg            config.SyncConfig
-	logger         *zap.Logger
-	stopCh         chan struct{}
-	doneCh         chan struct{}
+	syncRepo     repository.EventSyncRepository
+	calendarRepo repository.CalendarRepository
+	runRepo      repository.SyncRunRepository
+	changeRepo   repository.ChangeRepository
+	sources      SourceFactory
+	lock         repository.LeaderLock
+	leader       atomic.Bool
+	cfg          config.SyncConfig
+	logger       *zap.Logger
+	wakeCh       chan struct{}
+	stopCh       chan struct{}
+	doneCh       chan struct{}
 }
 
-// NewWorker creates a new sync worker.
+// NewWorker creates a new sync worker. A nil lock disables leader election.
 func NewWorker(
 	syncRepo repository.EventSyncRepository,
-	exchangeClient ExchangeClient,
+	calendarRepo repository.CalendarRepository,
+	runRepo repository.SyncRunRepository,
+	changeRepo repository.ChangeRepository,
+	sources SourceFactory,
+	lock repository.LeaderLock,
 	cfg config.SyncConfig,
 	logger *zap.Logger,
 ) *Worker {
 	return &Worker{
-		syncRepo:       syncRepo,
-		exchangeClient: exchangeClient,
-		cfg:            cfg,
-		logger:         logger,
-		stopCh:         make(chan struct{}),
-		doneCh:         make(chan struct{}),
+		syncRepo:     syncRepo,
+		calendarRepo: calendarRepo,
+		runRepo:      runRepo,
+		changeRepo:   changeRepo,
+		sources:      sources,
+		lock:         lock,
+		cfg:          cfg,
+		logger:       logger,
+		wakeCh:       make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+		doneCh:       make(chan struct{}),
 	}
 }
 
@@ -42,11 +79,28 @@ func (w *Worker) Start(ctx context.Context) {
 	w.logger.Info("starting sync worker",
 		zap.Duration("interval", w.cfg.Interval),
 		zap.Int("sync_days", w.cfg.SyncDays),
+		zap.String("mode", w.cfg.Mode),
+		zap.Int("concurrency", w.cfg.Concurrency),
+		zap.Bool("leader_election", w.lock != nil),
 	)
 
 	go w.run(ctx)
 }
 
+// IsLeader returns true if this replica currently runs sync cycles.
+func (w *Worker) IsLeader() bool {
+	return w.leader.Load()
+}
+
+// Wake makes the worker check for pending runs without waiting for the next
+// poll. Calls made while a check is already due are coalesced.
+func (w *Worker) Wake() {
+	select {
+	case w.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
 // Stop stops the sync worker gracefully.
 func (w *Worker) Stop() {
 	w.logger.Info("stopping sync worker...")
@@ -57,6 +111,7 @@ func (w *Worker) Stop() {
 
 func (w *Worker) run(ctx context.Context) {
 	defer close(w.doneCh)
+	defer w.releaseLeadership()
 
 	// Run initial sync
 	w.sync(ctx)
@@ -64,6 +119,17 @@ func (w *Worker) run(ctx context.Context) {
 	ticker := time.NewTicker(w.cfg.Interval)
 	defer ticker.Stop()
 
+	// Standby replicas check for a vacant lock more often than the sync interval
+	var retry <-chan time.Time
+	if w.lock != nil {
+		retryTicker := time.NewTicker(w.cfg.LeaderRetryInterval)
+		defer retryTicker.Stop()
+		retry = retryTicker.C
+	}
+
+	poll := time.NewTicker(w.cfg.TriggerPollInterval)
+	defer poll.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -72,54 +138,412 @@ func (w *Worker) run(ctx context.Context) {
 			return
 		case <-ticker.C:
 			w.sync(ctx)
+		case <-retry:
+			if !w.IsLeader() {
+				w.sync(ctx)
+			}
+		case <-poll.C:
+			w.syncPending(ctx)
+		case <-w.wakeCh:
+			w.syncPending(ctx)
+		}
+	}
+}
+
+// acquireLeadership takes or confirms the leader lock and logs leadership changes.
+func (w *Worker) acquireLeadership(ctx context.Context) bool {
+	if w.lock == nil {
+		w.leader.Store(true)
+		return true
+	}
+
+	leader, err := w.lock.TryAcquire(ctx)
+	if err != nil {
+		w.logger.Error("failed to acquire sync leader lock", zap.Error(err))
+		leader = false
+	}
+
+	if was := w.leader.Swap(leader); was != leader {
+		if leader {
+			w.logger.Info("acquired sync leadership")
+		} else {
+			w.logger.Warn("lost sync leadership")
 		}
 	}
+
+	return leader
+}
+
+// releaseLeadership releases the leader lock so that another replica can take over immediately.
+func (w *Worker) releaseLeadership() {
+	if w.lock == nil || !w.leader.Swap(false) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.lock.Release(ctx); err != nil {
+		w.logger.Error("failed to release sync leader lock", zap.Error(err))
+		return
+	}
+	w.logger.Info("released sync leadership")
 }
 
 func (w *Worker) sync(ctx context.Context) {
-	w.logger.Info("starting sync cycle")
-	startTime := time.Now()
+	if !w.acquireLeadership(ctx) {
+		w.logger.Debug("another replica holds the sync leader lock, skipping sync cycle")
+		return
+	}
 
-	// Calculate date range for sync
-	startDate := time.Now()
-	endDate := startDate.AddDate(0, 0, w.cfg.SyncDays)
+	w.failStaleRuns(ctx)
 
-	// Fetch events from Exchange
-	events, err := w.exchangeClient.GetCalendarEvents(ctx, startDate, endDate)
+	calendars, err := w.calendarRepo.List(ctx)
 	if err != nil {
-		w.logger.Error("failed to fetch events from Exchange", zap.Error(err))
+		w.logger.Error("failed to list calendars", zap.Error(err))
 		return
 	}
 
-	w.logger.Info("fetched events from Exchange", zap.Int("count", len(events)))
+	runs := make([]*domain.SyncRun, 0, len(calendars))
+	for _, cal := range calendars {
+		if !cal.Enabled {
+			continue
+		}
+		runs = append(runs, &domain.SyncRun{
+			CalendarID:   cal.ID,
+			CalendarName: cal.Name,
+			Trigger:      domain.SyncTriggerSchedule,
+			Mode:         w.cfg.Mode,
+		})
+	}
 
-	// Collect Exchange IDs for cleanup
-	exchangeIDs := make([]string, 0, len(events))
+	w.logger.Info("starting sync cycle", zap.String("mode", w.cfg.Mode), zap.Int("calendars", len(runs)))
+	w.syncRuns(ctx, calendars, runs)
 
-	// Upsert events
-	for _, event := range events {
-		// Generate UUID if not set
-		if event.ID == uuid.Nil {
-			event.ID = uuid.New()
+	if w.cfg.RunRetention > 0 {
+		if err := w.runRepo.DeleteBefore(ctx, time.Now().Add(-w.cfg.RunRetention)); err != nil {
+			w.logger.Error("failed to delete old sync runs", zap.Error(err))
 		}
+	}
+	if w.cfg.ChangeRetention > 0 {
+		if err := w.changeRepo.DeleteBefore(ctx, time.Now().Add(-w.cfg.ChangeRetention)); err != nil {
+			w.logger.Error("failed to delete old event changes", zap.Error(err))
+		}
+	}
+}
+
+// failStaleRuns marks runs left running longer than cfg.RunTimeout as failed.
+// It runs when leadership is acquired and before every cycle. The leader runs
+// cycles one at a time, so none of these runs is still running in this
+// replica; they were started by a replica that stopped or lost leadership.
+func (w *Worker) failStaleRuns(ctx context.Context) {
+	n, err := w.runRepo.FailStale(ctx, time.Now().Add(-w.cfg.RunTimeout), errRunTimedOut.Error())
+	if err != nil {
+		w.logger.Error("failed to fail stale sync runs", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		w.logger.Warn("marked stale sync runs as failed",
+			zap.Int64("runs", n),
+			zap.Duration("run_timeout", w.cfg.RunTimeout),
+		)
+	}
+}
+
+// syncPending runs the pending runs requested through the API. Only the
+// current leader picks them up; standby replicas take over through the
+// regular leader retry.
+func (w *Worker) syncPending(ctx context.Context) {
+	if !w.IsLeader() || !w.acquireLeadership(ctx) {
+		return
+	}
+
+	runs, err := w.runRepo.ClaimPending(ctx)
+	if err != nil {
+		w.logger.Error("failed to claim pending sync runs", zap.Error(err))
+		return
+	}
+	if len(runs) == 0 {
+		return
+	}
 
-		if err := w.syncRepo.Upsert(ctx, event); err != nil {
-			w.logger.Error("failed to upsert event",
-				zap.String("exchange_id", event.ExchangeID),
-				zap.Error(err),
-			)
+	calendars, err := w.calendarRepo.List(ctx)
+	if err != nil {
+		w.logger.Error("failed to list calendars", zap.Error(err))
+		w.failRuns(ctx, runs, err)
+		return
+	}
+
+	w.logger.Info("starting requested sync cycle", zap.Int("runs", len(runs)))
+	w.syncRuns(ctx, calendars, runs)
+}
+
+// syncRuns synchronizes the calendars of the runs concurrently.
+func (w *Worker) syncRuns(ctx context.Context, calendars []*domain.Calendar, runs []*domain.SyncRun) {
+	startTime := time.Now()
+
+	byID := make(map[uuid.UUID]*domain.Calendar, len(calendars))
+	for _, cal := range calendars {
+		byID[cal.ID] = cal
+	}
+
+	var (
+		wg     gosync.WaitGroup
+		synced atomic.Int64
+		failed atomic.Int64
+	)
+	sem := make(chan struct{}, max(w.cfg.Concurrency, 1))
+
+	for _, run := range runs {
+		// A calendar may be disabled after a run was requested for it
+		cal, ok := byID[run.CalendarID]
+		if !ok || !cal.Enabled {
+			w.failRuns(ctx, []*domain.SyncRun{run}, errCalendarDisabled)
+			failed.Add(1)
 			continue
 		}
-		exchangeIDs = append(exchangeIDs, event.ExchangeID)
-	}
 
-	// Delete events that no longer exist in Exchange
-	if err := w.syncRepo.DeleteNotInExchangeIDs(ctx, exchangeIDs); err != nil {
-		w.logger.Error("failed to delete old events", zap.Error(err))
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			w.syncCalendar(ctx, cal, run)
+			synced.Add(int64(run.Created + run.Updated + run.Deleted))
+			if run.Status == domain.SyncRunStatusFailed {
+				failed.Add(1)
+			}
+		}()
 	}
+	wg.Wait()
 
 	w.logger.Info("sync cycle completed",
 		zap.Duration("duration", time.Since(startTime)),
-		zap.Int("synced_events", len(exchangeIDs)),
+		zap.Int64("synced_events", synced.Load()),
+		zap.Int64("failed_calendars", failed.Load()),
 	)
 }
+
+// failRuns records claimed runs that could not be started as failed.
+func (w *Worker) failRuns(ctx context.Context, runs []*domain.SyncRun, cause error) {
+	now := time.Now()
+	for _, run := range runs {
+		run.Status = domain.SyncRunStatusFailed
+		run.FinishedAt = &now
+		run.Error = cause.Error()
+		if err := w.runRepo.Update(ctx, run); err != nil {
+			w.logger.Error("failed to record sync run", zap.Error(err))
+		}
+	}
+}
+
+// syncCalendar synchronizes one calendar and records the run. Runs claimed
+// from the pending queue are already stored; scheduled runs are created here.
+func (w *Worker) syncCalendar(ctx context.Context, cal *domain.Calendar, run *domain.SyncRun) {
+	logger := w.logger.With(zap.String("calendar", cal.Name), zap.String("trigger", run.Trigger))
+
+	// Incremental sync needs a capable source and covers the default window only
+	source, err := w.sources.Source(cal)
+	if _, ok := source.(IncrementalClient); !ok || run.RangeStart != nil || run.RangeEnd != nil {
+		run.Mode = config.SyncModeFull
+	}
+
+	if run.Status != domain.SyncRunStatusRunning {
+		run.Status = domain.SyncRunStatusRunning
+		run.StartedAt = time.Now()
+
+		// History is best effort and must not block synchronization
+		if err := w.runRepo.Create(ctx, run); err != nil {
+			logger.Error("failed to record sync run", zap.Error(err))
+		}
+	}
+
+	if err == nil {
+		err = w.syncSource(ctx, cal, source, run, logger)
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = domain.SyncRunStatusSucceeded
+	if err != nil {
+		run.Status = domain.SyncRunStatusFailed
+		run.Error = err.Error()
+		logger.Error("calendar sync failed", zap.Error(err))
+	}
+
+	if err := w.runRepo.Update(ctx, run); err != nil {
+		logger.Error("failed to record sync run", zap.Error(err))
+	}
+
+	logger.Info("calendar sync completed",
+		zap.String("status", run.Status),
+		zap.Duration("duration", finishedAt.Sub(run.StartedAt)),
+		zap.Int("fetched", run.Fetched),
+		zap.Int("created", run.Created),
+		zap.Int("updated", run.Updated),
+		zap.Int("unchanged", run.Unchanged),
+		zap.Int("deleted", run.Deleted),
+		zap.Int("failed", run.Failed),
+	)
+}
+
+// syncSource synchronizes the calendar from its source in the mode of the run.
+func (w *Worker) syncSource(ctx context.Context, cal *domain.Calendar, source Source, run *domain.SyncRun, logger *zap.Logger) error {
+	syncDays := w.cfg.SyncDays
+	if cal.SyncDays > 0 {
+		syncDays = cal.SyncDays
+	}
+
+	// The window starts now and spans syncDays unless the run requests its own
+	startDate := time.Now()
+	endDate := startDate.AddDate(0, 0, syncDays)
+	if run.RangeStart != nil {
+		startDate = *run.RangeStart
+	}
+	if run.RangeEnd != nil {
+		endDate = *run.RangeEnd
+	}
+
+	cs := &calendarSync{
+		syncRepo:  w.syncRepo,
+		calendar:  cal,
+		source:    source,
+		startDate: startDate,
+		endDate:   endDate,
+		run:       run,
+		logger:    logger,
+	}
+
+	if client, ok := source.(IncrementalClient); ok && run.Mode == config.SyncModeIncremental {
+		return cs.syncIncremental(ctx, client)
+	}
+	return cs.syncFull(ctx, "")
+}
+
+// calendarSync synchronizes the events of one calendar from its source,
+// counting changes in run.
+type calendarSync struct {
+	syncRepo  repository.EventSyncRepository
+	calendar  *domain.Calendar
+	source    Source
+	startDate time.Time
+	endDate   time.Time
+	run       *domain.SyncRun
+	logger    *zap.Logger
+}
+
+// syncFull fetches the whole sync window and replaces the local copy with it.
+// A non-empty syncState is stored together with the events.
+func (cs *calendarSync) syncFull(ctx context.Context, syncState string) error {
+	startDate, endDate := cs.startDate, cs.endDate
+
+	// Fetch events from the source
+	events, err := cs.source.GetCalendarEvents(ctx, startDate, endDate)
+	if err != nil {
+		return fmt.Errorf("failed to fetch events: %w", err)
+	}
+
+	cs.logger.Info("fetched events from source", zap.Int("count", len(events)))
+	cs.run.Fetched += len(events)
+
+	batch := &domain.EventBatch{
+		CalendarID: cs.calendar.ID,
+		Events:     events,
+		SyncState:  syncState,
+	}
+
+	// Delete events that no longer exist in the source. An empty result is far
+	// more likely an upstream hiccup than a cleared calendar, so never wipe the
+	// window because of it.
+	if len(events) > 0 {
+		batch.WindowStart = &startDate
+		batch.WindowEnd = &endDate
+	} else {
+		cs.logger.Warn("source returned no events, skipping deletion of local events",
+			zap.Time("start_date", startDate),
+			zap.Time("end_date", endDate),
+		)
+	}
+
+	_, err = cs.applyBatch(ctx, batch)
+	return err
+}
+
+// syncIncremental applies changes since the stored sync state. Without a
+// usable state it starts tracking from the current state and falls back to a
+// full resync of the window.
+func (cs *calendarSync) syncIncremental(ctx context.Context, client IncrementalClient) error {
+	state, err := cs.syncRepo.GetSyncState(ctx, cs.calendar.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	if state != "" {
+		changes, err := client.SyncCalendarChanges(ctx, state)
+		if err == nil {
+			return cs.applyChanges(ctx, changes)
+		}
+		if !errors.Is(err, ErrInvalidSyncState) {
+			return fmt.Errorf("failed to fetch changes from Exchange: %w", err)
+		}
+		cs.logger.Warn("sync state was invalidated by Exchange, falling back to full resync")
+	}
+
+	// Take the state before the full resync so that changes made during it are picked up next cycle.
+	changes, err := client.SyncCalendarChanges(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to obtain sync state: %w", err)
+	}
+
+	return cs.syncFull(ctx, changes.SyncState)
+}
+
+// applyChanges upserts updated events, removes deleted ones and stores the new sync state.
+func (cs *calendarSync) applyChanges(ctx context.Context, changes *CalendarChanges) error {
+	cs.logger.Info("fetched changes from Exchange",
+		zap.Int("updated", len(changes.Updated)),
+		zap.Int("deleted", len(changes.Deleted)),
+	)
+	cs.run.Fetched += len(changes.Updated) + len(changes.Deleted)
+
+	result, err := cs.applyBatch(ctx, &domain.EventBatch{
+		CalendarID: cs.calendar.ID,
+		Events:     changes.Updated,
+		DeletedIDs: changes.Deleted,
+		SyncState:  changes.SyncState,
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		// The old state was kept so that failed events are retried next cycle.
+		return fmt.Errorf("failed to upsert %d events", len(result.Failed))
+	}
+
+	return nil
+}
+
+// applyBatch stores the changes of the cycle in one transaction and counts them in the run.
+func (cs *calendarSync) applyBatch(ctx context.Context, batch *domain.EventBatch) (*domain.EventBatchResult, error) {
+	result, err := cs.syncRepo.ApplyBatch(ctx, batch)
+	if err != nil {
+		cs.run.Failed += len(batch.Events)
+		return nil, fmt.Errorf("failed to store events: %w", err)
+	}
+
+	for exchangeID, err := range result.Failed {
+		cs.logger.Error("failed to upsert event",
+			zap.String("exchange_id", exchangeID),
+			zap.Error(err),
+		)
+	}
+
+	cs.run.Created += result.Created
+	cs.run.Updated += result.Updated
+	cs.run.Unchanged += result.Unchanged
+	cs.run.Deleted += result.Deleted
+	cs.run.Failed += len(result.Failed)
+
+	return result, nil
+}
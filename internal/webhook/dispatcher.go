@@ -0,0 +1,285 @@
+// Package webhook delivers event changes to webhook subscriptions.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/backoff"
+	"github.com/anmaslov/calendar/internal/config"
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/anmaslov/calendar/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// dispatchPageSize is the number of changes turned into deliveries at
+	// once; it also bounds the number of changes in a delivery.
+	dispatchPageSize = 500
+	// claimBatchSize is the number of deliveries sent concurrently.
+	claimBatchSize = 20
+	// cleanupInterval defines how often old deliveries are deleted.
+	cleanupInterval = time.Hour
+	// maxErrorBodySize limits the part of a failed response kept as the error.
+	maxErrorBodySize = 512
+	userAgent        = "calendar-webhooks"
+)
+
+// Dispatcher turns event changes into webhook deliveries and sends them. Every
+// cfg.PollInterval it reads the changes committed since the previous check,
+// which makes one delivery per webhook for the changes of a sync cycle, and
+// sends due deliveries. Failed deliveries are retried with backoff until
+// cfg.Retry.MaxAttempts and are dead-lettered after that.
+//
+// Dispatchers on several replicas share the work: changes are dispatched once
+// and a claimed delivery is not sent by another replica until its attempt has
+// timed out.
+type Dispatcher struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+	cfg    config.WebhookConfig
+	logger *zap.Logger
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewDispatcher creates a new webhook dispatcher.
+func NewDispatcher(repo repository.WebhookRepository, cfg config.WebhookConfig, logger *zap.Logger) *Dispatcher {
+	// Deliveries connect directly rather than through a proxy, so that the
+	// addresses they reach can be checked
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = NewTargetPolicy(cfg.AllowedHosts).DialContext
+
+	return &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		cfg:    cfg,
+		logger: logger,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+// Start starts the background dispatcher.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.logger.Info("starting webhook dispatcher",
+		zap.Duration("poll_interval", d.cfg.PollInterval),
+		zap.Int("max_attempts", d.cfg.Retry.MaxAttempts),
+	)
+
+	go d.run(ctx)
+}
+
+// Stop stops the dispatcher gracefully, waiting for attempts in progress.
+func (d *Dispatcher) Stop() {
+	d.logger.Info("stopping webhook dispatcher...")
+	close(d.stopCh)
+	<-d.doneCh
+	d.logger.Info("webhook dispatcher stopped")
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer close(d.doneCh)
+
+	poll := time.NewTicker(d.cfg.PollInterval)
+	defer poll.Stop()
+
+	cleanup := time.NewTicker(cleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopCh:
+			return
+		case <-poll.C:
+			d.dispatch(ctx)
+			d.deliver(ctx)
+		case <-cleanup.C:
+			d.cleanup(ctx)
+		}
+	}
+}
+
+// dispatch creates deliveries for all changes since the previous dispatch.
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	for {
+		n, err := d.repo.Dispatch(ctx, dispatchPageSize, d.build)
+		if err != nil {
+			d.logger.Error("failed to dispatch event changes", zap.Error(err))
+			return
+		}
+		if n < dispatchPageSize {
+			return
+		}
+	}
+}
+
+// build creates a delivery for every webhook matching any of the changes.
+// Changes logged before a webhook was created are not delivered to it.
+func (d *Dispatcher) build(webhooks []*domain.Webhook, changes []*domain.EventChange) ([]*domain.WebhookDelivery, error) {
+	now := time.Now()
+
+	var deliveries []*domain.WebhookDelivery
+	for _, w := range webhooks {
+		var matched []payloadChange
+		for _, c := range changes {
+			if c.Seq <= w.StartSeq || !w.Matches(c) {
+				continue
+			}
+			matched = append(matched, toPayloadChange(c))
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		delivery := &domain.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     w.ID,
+			Status:        domain.WebhookDeliveryPending,
+			FirstSeq:      matched[0].Seq,
+			LastSeq:       matched[len(matched)-1].Seq,
+			Changes:       len(matched),
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		}
+
+		body, err := json.Marshal(payload{
+			ID:        delivery.ID,
+			WebhookID: w.ID,
+			CreatedAt: now,
+			Changes:   matched,
+		})
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = body
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// deliver sends all due deliveries, claimBatchSize at a time.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	for {
+		// A claimed delivery is retried by any replica once its attempt could
+		// no longer be running
+		deliveries, err := d.repo.ClaimDeliveries(ctx, claimBatchSize, 2*d.cfg.Timeout)
+		if err != nil {
+			d.logger.Error("failed to claim webhook deliveries", zap.Error(err))
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.attempt(ctx, delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// attempt sends a claimed delivery and records the result.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *domain.WebhookDelivery) {
+	logger := d.logger.With(
+		zap.String("webhook_id", delivery.WebhookID.String()),
+		zap.String("delivery_id", delivery.ID.String()),
+		zap.Int("attempt", delivery.Attempts),
+	)
+
+	status, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// Interrupted by shutdown; the attempt is repeated once the claim expires
+		return
+	}
+
+	now := time.Now()
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.Error = ""
+		logger.Debug("webhook delivered", zap.Int("status", status))
+	case delivery.Attempts >= d.cfg.Retry.MaxAttempts:
+		delivery.Status = domain.WebhookDeliveryDead
+		delivery.Error = err.Error()
+		logger.Warn("webhook delivery failed permanently", zap.Error(err))
+	default:
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = now.Add(backoff.Delay(d.cfg.Retry, delivery.Attempts))
+		logger.Info("webhook delivery failed, retrying",
+			zap.Time("next_attempt_at", delivery.NextAttemptAt),
+			zap.Error(err),
+		)
+	}
+
+	if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+		logger.Error("failed to record webhook delivery", zap.Error(err))
+	}
+}
+
+// send POSTs the signed payload of a delivery and returns the response status.
+func (d *Dispatcher) send(ctx context.Context, delivery *domain.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderWebhookID, delivery.WebhookID.String())
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+		return resp.StatusCode, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, msg)
+	}
+	return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// cleanup deletes delivered and dead deliveries older than the retention period.
+func (d *Dispatcher) cleanup(ctx context.Context) {
+	if d.cfg.DeliveryRetention <= 0 {
+		return
+	}
+	if err := d.repo.DeleteDeliveriesBefore(ctx, time.Now().Add(-d.cfg.DeliveryRetention)); err != nil {
+		d.logger.Error("failed to delete old webhook deliveries", zap.Error(err))
+	}
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func TestDispatcherBuildSkipsEarlierChanges(t *testing.T) {
+	d := &Dispatcher{logger: zap.NewNop()}
+	calendarID := uuid.New()
+
+	// The clock of the database may be behind the one of the application, so
+	// change times say nothing about the creation of the webhook
+	created := time.Now()
+	w := &domain.Webhook{ID: uuid.New(), Enabled: true, StartSeq: 11, CreatedAt: created}
+
+	var changes []*domain.EventChange
+	for seq := int64(10); seq <= 13; seq++ {
+		changes = append(changes, &domain.EventChange{
+			Seq:        seq,
+			Operation:  domain.ChangeOperationDelete,
+			EventID:    uuid.New(),
+			CalendarID: calendarID,
+			ChangedAt:  created.Add(-time.Minute),
+		})
+	}
+
+	deliveries, err := d.build([]*domain.Webhook{w}, changes)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	if got := deliveries[0]; got.FirstSeq != 12 || got.LastSeq != 13 || got.Changes != 2 {
+		t.Errorf("delivery has changes %d-%d (%d), want 12-13 (2)", got.FirstSeq, got.LastSeq, got.Changes)
+	}
+
+	if deliveries, _ := d.build([]*domain.Webhook{w}, changes[:2]); len(deliveries) != 0 {
+		t.Errorf("got %d deliveries of changes logged before the webhook, want 0", len(deliveries))
+	}
+}
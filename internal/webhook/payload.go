@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/anmaslov/calendar/internal/domain"
+	"github.com/google/uuid"
+)
+
+// payload is the JSON body of a delivery.
+type payload struct {
+	ID        uuid.UUID       `json:"id"`
+	WebhookID uuid.UUID       `json:"webhook_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Changes   []payloadChange `json:"changes"`
+}
+
+// payloadChange is an event change in a delivery. Event is the state of the
+// event when the delivery was created; it is omitted for deletions.
+type payloadChange struct {
+	Seq        int64         `json:"seq"`
+	Operation  string        `json:"operation"`
+	EventID    uuid.UUID     `json:"event_id"`
+	CalendarID uuid.UUID     `json:"calendar_id"`
+	ExchangeID string        `json:"exchange_id"`
+	ChangedAt  time.Time     `json:"changed_at"`
+	Event      *payloadEvent `json:"event,omitempty"`
+}
+
+// payloadEvent is an event in a delivery, without its body.
+type payloadEvent struct {
+	ID             uuid.UUID         `json:"id"`
+	ExchangeID     string            `json:"exchange_id"`
+	CalendarID     uuid.UUID         `json:"calendar_id"`
+	Subject        string            `json:"subject"`
+	Location       string            `json:"location,omitempty"`
+	StartTime      time.Time         `json:"start_time"`
+	EndTime        time.Time         `json:"end_time"`
+	IsAllDay       bool              `json:"is_all_day"`
+	Organizer      string            `json:"organizer,omitempty"`
+	Attendees      []payloadAttendee `json:"attendees,omitempty"`
+	Categories     []string          `json:"categories,omitempty"`
+	Importance     string            `json:"importance,omitempty"`
+	Sensitivity    string            `json:"sensitivity,omitempty"`
+	Status         string            `json:"status"`
+	TimeZone       string            `json:"time_zone,omitempty"`
+	RecurrenceRule string            `json:"recurrence_rule,omitempty"`
+	SeriesMasterID string            `json:"series_master_id,omitempty"`
+	OriginalStart  *time.Time        `json:"original_start,omitempty"`
+	IsException    bool              `json:"is_exception,omitempty"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// payloadAttendee is an event attendee in a delivery.
+type payloadAttendee struct {
+	Email          string `json:"email"`
+	Name           string `json:"name,omitempty"`
+	ResponseStatus string `json:"response_status,omitempty"`
+}
+
+// toPayloadChange converts domain event change to a delivery change.
+func toPayloadChange(c *domain.EventChange) payloadChange {
+	change := payloadChange{
+		Seq:        c.Seq,
+		Operation:  c.Operation,
+		EventID:    c.EventID,
+		CalendarID: c.CalendarID,
+		ExchangeID: c.ExchangeID,
+		ChangedAt:  c.ChangedAt,
+	}
+	if c.Event == nil {
+		return change
+	}
+
+	e := c.Event
+	change.Event = &payloadEvent{
+		ID:             e.ID,
+		ExchangeID:     e.ExchangeID,
+		CalendarID:     e.CalendarID,
+		Subject:        e.Subject,
+		Location:       e.Location,
+		StartTime:      e.StartTime,
+		EndTime:        e.EndTime,
+		IsAllDay:       e.IsAllDay,
+		Organizer:      e.Organizer,
+		Categories:     e.Categories,
+		Importance:     e.Importance,
+		Sensitivity:    e.Sensitivity,
+		Status:         e.Status,
+		TimeZone:       e.TimeZone,
+		SeriesMasterID: e.SeriesMasterID,
+		OriginalStart:  e.OriginalStart,
+		IsException:    e.IsException,
+		UpdatedAt:      e.UpdatedAt,
+	}
+	if e.IsSeriesMaster() {
+		change.Event.RecurrenceRule = e.Recurrence.Rule
+	}
+	for _, a := range e.Attendees {
+		change.Event.Attendees = append(change.Event.Attendees, payloadAttendee{
+			Email:          a.Email,
+			Name:           a.Name,
+			ResponseStatus: a.ResponseStatus,
+		})
+	}
+	return change
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// dialTimeout limits establishing a connection to a webhook.
+	dialTimeout = 30 * time.Second
+	// dialKeepAlive is the keep-alive period of webhook connections.
+	dialKeepAlive = 30 * time.Second
+)
+
+// TargetPolicy restricts the hosts webhooks are delivered to. Webhook URLs
+// are chosen by API clients, so unless a host is allow-listed, deliveries only
+// reach public addresses and cannot be aimed at the loopback interface, the
+// cloud metadata endpoint or other services of the private network.
+type TargetPolicy struct {
+	allowedHosts map[string]bool
+	dialer       *net.Dialer
+	checked      *net.Dialer
+}
+
+// NewTargetPolicy creates a policy allowing public addresses and the given
+// hosts, whatever addresses they resolve to.
+func NewTargetPolicy(allowedHosts []string) *TargetPolicy {
+	p := &TargetPolicy{
+		allowedHosts: make(map[string]bool, len(allowedHosts)),
+		dialer:       &net.Dialer{Timeout: dialTimeout, KeepAlive: dialKeepAlive},
+	}
+	for _, h := range allowedHosts {
+		p.allowedHosts[normalizeHost(h)] = true
+	}
+
+	checked := *p.dialer
+	checked.Control = checkAddress
+	p.checked = &checked
+
+	return p
+}
+
+// CheckURL returns an error if the URL is not an absolute http or https URL
+// or names a forbidden address. Host names are only checked when deliveries
+// connect, against the addresses they resolve to then.
+func (p *TargetPolicy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	host := normalizeHost(u.Hostname())
+	if p.allowedHosts[host] {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url host %s is a loopback address", host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && forbiddenAddr(ip) {
+		return fmt.Errorf("url host %s is not a public address", host)
+	}
+
+	return nil
+}
+
+// DialContext connects to the address of a webhook, refusing addresses that
+// are not public unless the host is allow-listed. The check is made on the
+// resolved address, so that a host name cannot point deliveries elsewhere.
+func (p *TargetPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if p.allowedHosts[normalizeHost(host)] {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+	return p.checked.DialContext(ctx, network, address)
+}
+
+// checkAddress is a net.Dialer control function refusing connections to
+// addresses that are not public.
+func checkAddress(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if forbiddenAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is not a public address", addrPort.Addr())
+	}
+	return nil
+}
+
+// forbiddenAddr returns true for loopback, link-local, private, multicast and
+// unspecified addresses.
+func forbiddenAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// normalizeHost returns the host in the form used for comparisons.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+}
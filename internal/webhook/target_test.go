@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTargetPolicyCheckURL(t *testing.T) {
+	policy := NewTargetPolicy([]string{"hooks.internal", "10.0.0.5"})
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://example.com/hook"},
+		{url: "http://203.0.113.10:8080/hook"},
+		{url: "https://hooks.internal/hook"},
+		{url: "https://HOOKS.internal./hook"},
+		{url: "http://10.0.0.5/hook"},
+		{url: "ftp://example.com/hook", wantErr: true},
+		{url: "/hook", wantErr: true},
+		{url: "http://localhost:8080/hook", wantErr: true},
+		{url: "http://api.localhost/hook", wantErr: true},
+		{url: "http://127.0.0.1/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://10.0.0.6/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := policy.CheckURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTargetPolicyDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(policy *TargetPolicy) error {
+		client := &http.Client{Transport: &http.Transport{DialContext: policy.DialContext}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(NewTargetPolicy(nil)); err == nil {
+		t.Error("connected to a loopback address that is not allowed")
+	}
+	if err := get(NewTargetPolicy([]string{u.Hostname()})); err != nil {
+		t.Errorf("connecting to an allowed host: %v", err)
+	}
+}
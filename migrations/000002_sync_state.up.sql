@@ -0,0 +1,6 @@
+-- Create sync_states table for incremental synchronization
+CREATE TABLE IF NOT EXISTS sync_states (
+    source VARCHAR(255) PRIMARY KEY,
+    sync_state TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_events_source_start_time;
+
+-- Drop columns
+ALTER TABLE events DROP COLUMN IF EXISTS source;
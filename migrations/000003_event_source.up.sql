@@ -0,0 +1,7 @@
+-- Track which sync source each event came from
+ALTER TABLE events ADD COLUMN IF NOT EXISTS source VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Existing synced events come from the Exchange calendar
+UPDATE events SET source = 'exchange' WHERE exchange_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_events_source_start_time ON events(source, start_time);
@@ -0,0 +1,14 @@
+-- Drop tables
+DROP TABLE IF EXISTS event_excluded_dates;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_events_series_masters;
+DROP INDEX IF EXISTS idx_events_series_master_id;
+
+-- Drop columns
+ALTER TABLE events DROP COLUMN IF EXISTS is_exception;
+ALTER TABLE events DROP COLUMN IF EXISTS original_start;
+ALTER TABLE events DROP COLUMN IF EXISTS series_master_id;
+ALTER TABLE events DROP COLUMN IF EXISTS recurrence_end;
+ALTER TABLE events DROP COLUMN IF EXISTS recurrence_rule;
+ALTER TABLE events DROP COLUMN IF EXISTS time_zone;
@@ -0,0 +1,20 @@
+-- Recurring series: masters carry the rule, exceptions reference their master
+ALTER TABLE events ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recurrence_rule TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recurrence_end TIMESTAMP WITH TIME ZONE;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS series_master_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS original_start TIMESTAMP WITH TIME ZONE;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS is_exception BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_events_series_master_id ON events(series_master_id) WHERE series_master_id <> '';
+CREATE INDEX IF NOT EXISTS idx_events_series_masters ON events(start_time, recurrence_end) WHERE recurrence_rule <> '';
+
+-- Create event_excluded_dates table for deleted occurrences of a series
+CREATE TABLE IF NOT EXISTS event_excluded_dates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id UUID NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    excluded_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_excluded_dates_event_id ON event_excluded_dates(event_id);
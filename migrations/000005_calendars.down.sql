@@ -0,0 +1,19 @@
+-- Restore source-keyed sync states
+ALTER TABLE sync_states ADD COLUMN IF NOT EXISTS source VARCHAR(255);
+UPDATE sync_states s SET source = c.name FROM calendars c WHERE c.id = s.calendar_id;
+ALTER TABLE sync_states DROP CONSTRAINT IF EXISTS sync_states_pkey;
+ALTER TABLE sync_states DROP COLUMN IF EXISTS calendar_id;
+ALTER TABLE sync_states ADD PRIMARY KEY (source);
+
+-- Restore source names of events; Exchange IDs must be globally unique again
+ALTER TABLE events ADD COLUMN IF NOT EXISTS source VARCHAR(255) NOT NULL DEFAULT '';
+UPDATE events e SET source = c.source_type FROM calendars c WHERE c.id = e.calendar_id;
+CREATE INDEX IF NOT EXISTS idx_events_source_start_time ON events(source, start_time);
+
+DROP INDEX IF EXISTS idx_events_calendar_start_time;
+DROP INDEX IF EXISTS idx_events_calendar_exchange_id;
+ALTER TABLE events DROP COLUMN IF EXISTS calendar_id;
+ALTER TABLE events ADD CONSTRAINT events_exchange_id_key UNIQUE (exchange_id);
+
+-- Drop tables
+DROP TABLE IF EXISTS calendars;
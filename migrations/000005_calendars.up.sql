@@ -0,0 +1,42 @@
+-- Create calendars table: every synchronized Exchange mailbox or iCalendar feed
+CREATE TABLE IF NOT EXISTS calendars (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    source_type VARCHAR(50) NOT NULL,
+    mailbox VARCHAR(255) NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    sync_days INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Existing events and sync states were keyed by source name; move them to
+-- calendars named after the source, which the configured default calendar reuses
+UPDATE events SET source = 'exchange' WHERE source = '';
+
+INSERT INTO calendars (name, source_type)
+SELECT source, source FROM events
+UNION
+SELECT source, source FROM sync_states
+ON CONFLICT (name) DO NOTHING;
+
+-- Events belong to a calendar; Exchange IDs are unique within it
+ALTER TABLE events ADD COLUMN IF NOT EXISTS calendar_id UUID REFERENCES calendars(id) ON DELETE CASCADE;
+UPDATE events e SET calendar_id = c.id FROM calendars c WHERE c.name = e.source;
+ALTER TABLE events ALTER COLUMN calendar_id SET NOT NULL;
+
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_exchange_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_events_calendar_exchange_id ON events(calendar_id, exchange_id);
+CREATE INDEX IF NOT EXISTS idx_events_calendar_start_time ON events(calendar_id, start_time);
+
+DROP INDEX IF EXISTS idx_events_source_start_time;
+ALTER TABLE events DROP COLUMN IF EXISTS source;
+
+-- Sync states are kept per calendar
+ALTER TABLE sync_states ADD COLUMN IF NOT EXISTS calendar_id UUID REFERENCES calendars(id) ON DELETE CASCADE;
+UPDATE sync_states s SET calendar_id = c.id FROM calendars c WHERE c.name = s.source;
+ALTER TABLE sync_states DROP CONSTRAINT IF EXISTS sync_states_pkey;
+ALTER TABLE sync_states DROP COLUMN IF EXISTS source;
+ALTER TABLE sync_states ADD PRIMARY KEY (calendar_id);
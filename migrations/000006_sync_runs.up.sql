@@ -0,0 +1,18 @@
+-- Create sync_runs table: one row per calendar per sync cycle
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    calendar_id UUID NOT NULL REFERENCES calendars(id) ON DELETE CASCADE,
+    mode VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    fetched INTEGER NOT NULL DEFAULT 0,
+    created INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    deleted INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_runs_started_at ON sync_runs(started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sync_runs_calendar_status ON sync_runs(calendar_id, status, started_at DESC);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_sync_runs_pending;
+
+DELETE FROM sync_runs WHERE status = 'pending';
+
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS range_end;
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS range_start;
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS triggered_by;
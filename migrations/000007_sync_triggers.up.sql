@@ -0,0 +1,11 @@
+-- Runs requested through the API and their optional sync window
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS triggered_by VARCHAR(50) NOT NULL DEFAULT 'schedule';
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS range_start TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS range_end TIMESTAMP WITH TIME ZONE;
+
+-- At most one pending run per calendar and window, so concurrent requests are coalesced
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_runs_pending ON sync_runs (
+    calendar_id,
+    COALESCE(range_start, '-infinity'::timestamptz),
+    COALESCE(range_end, 'infinity'::timestamptz)
+) WHERE status = 'pending';
@@ -0,0 +1,4 @@
+ALTER TABLE sync_runs DROP COLUMN IF EXISTS unchanged;
+
+ALTER TABLE events DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE events DROP COLUMN IF EXISTS change_key;
@@ -0,0 +1,6 @@
+-- Exchange ChangeKey and a hash of the stored content, so unchanged events are not rewritten
+ALTER TABLE events ADD COLUMN IF NOT EXISTS change_key VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Events left unchanged by a sync run
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS unchanged INTEGER NOT NULL DEFAULT 0;
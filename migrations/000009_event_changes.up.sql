@@ -0,0 +1,10 @@
+-- Change log of events for downstream consumers, ordered by seq. Rows are kept
+-- after the event is deleted, so there is no foreign key to events.
+CREATE TABLE IF NOT EXISTS event_changes (
+    seq BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL,
+    calendar_id UUID NOT NULL,
+    exchange_id VARCHAR(255) NOT NULL,
+    operation VARCHAR(16) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
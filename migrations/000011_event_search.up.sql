@@ -0,0 +1,11 @@
+-- Full-text search over subject, location, organizer and body. The russian
+-- configuration stems Cyrillic words as Russian and Latin ones as English;
+-- weights rank matches in the subject above the other fields.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', coalesce(subject, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(location, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(organizer, '')), 'C') ||
+    setweight(to_tsvector('russian', coalesce(body, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_events_search_vector ON events USING GIN (search_vector);
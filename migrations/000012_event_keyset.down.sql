@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_events_start_time ON events(start_time);
+DROP INDEX IF EXISTS idx_events_start_time_id;
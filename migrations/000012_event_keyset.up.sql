@@ -0,0 +1,3 @@
+-- Events are listed in (start_time, id) order and paged by keyset
+CREATE INDEX IF NOT EXISTS idx_events_start_time_id ON events(start_time, id);
+DROP INDEX IF EXISTS idx_events_start_time;
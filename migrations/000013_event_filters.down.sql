@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_event_categories_category;
+DROP INDEX IF EXISTS idx_event_attendees_email;
+DROP INDEX IF EXISTS idx_events_organizer;
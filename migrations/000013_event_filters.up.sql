@@ -0,0 +1,6 @@
+-- Case-insensitive lookups of events by organizer, attendee and category.
+-- Importance, sensitivity and is_all_day have too few distinct values for an
+-- index to pay off; they narrow down rows found by the other conditions.
+CREATE INDEX IF NOT EXISTS idx_events_organizer ON events(lower(organizer));
+CREATE INDEX IF NOT EXISTS idx_event_attendees_email ON event_attendees(lower(email), event_id);
+CREATE INDEX IF NOT EXISTS idx_event_categories_category ON event_categories(lower(category), event_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_events_period;
+
+ALTER TABLE events DROP COLUMN IF EXISTS period;
@@ -0,0 +1,11 @@
+-- The time an event takes place as a range, for overlap queries. An event
+-- without duration is the instant it happens; an end before the start (not
+-- produced by Exchange or the API) is treated the same way.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS period tstzrange GENERATED ALWAYS AS (
+    CASE WHEN end_time > start_time
+        THEN tstzrange(start_time, end_time, '[)')
+        ELSE tstzrange(start_time, start_time, '[]')
+    END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_events_period ON events USING GIST (period);
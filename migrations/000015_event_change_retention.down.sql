@@ -0,0 +1,2 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_event_changes_changed_at;
@@ -0,0 +1,2 @@
+-- Old changes are deleted by age
+CREATE INDEX IF NOT EXISTS idx_event_changes_changed_at ON event_changes(changed_at);
@@ -0,0 +1,7 @@
+-- Position in the change log after which changes are delivered to a webhook
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS start_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Existing webhooks start after the changes logged before they were created
+UPDATE webhooks w SET start_seq = COALESCE(
+    (SELECT MAX(c.seq) FROM event_changes c WHERE c.changed_at < w.created_at), 0
+);